@@ -0,0 +1,168 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/CPU-commits/USACH.dev-Server/forms"
+	"github.com/CPU-commits/USACH.dev-Server/res"
+	"github.com/CPU-commits/USACH.dev-Server/services"
+	"github.com/gin-gonic/gin"
+)
+
+type AdminController struct{}
+
+func (*AdminController) GetUsers(c *gin.Context) {
+	// Page has 20 elements
+	page := c.DefaultQuery("page", "0")
+	pageNumber, err := strconv.Atoi(page)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, &res.Response{
+			Message: "page must be a int",
+		})
+		return
+	}
+	// Return total of elements?
+	total := c.DefaultQuery("total", "false")
+
+	search := c.DefaultQuery("search", "")
+
+	users, totalElements, errRes := adminService.GetUsers(
+		search,
+		pageNumber,
+		total == "true",
+	)
+	if errRes != nil {
+		c.AbortWithStatusJSON(errRes.StatusCode, &res.Response{
+			Message: errRes.Err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, &res.Response{
+		Data: map[string]interface{}{
+			"users": users,
+			"total": totalElements,
+		},
+	})
+}
+
+func (*AdminController) SetUserStatus(c *gin.Context) {
+	idUser := c.Param("idUser")
+
+	var statusForm *forms.UserStatusForm
+	if err := c.BindJSON(&statusForm); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, &res.Response{
+			Message: err.Error(),
+		})
+		return
+	}
+	claims, _ := services.NewClaimsFromContext(c)
+
+	err := adminService.SetUserStatus(claims.UserID, idUser, statusForm)
+	if err != nil {
+		c.AbortWithStatusJSON(err.StatusCode, &res.Response{
+			Message: err.Err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, &res.Response{})
+}
+
+func (*AdminController) SetUserRole(c *gin.Context) {
+	idUser := c.Param("idUser")
+
+	var roleForm *forms.UserRoleForm
+	if err := c.BindJSON(&roleForm); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, &res.Response{
+			Message: err.Error(),
+		})
+		return
+	}
+	claims, _ := services.NewClaimsFromContext(c)
+
+	err := adminService.SetUserRole(claims.UserID, idUser, roleForm)
+	if err != nil {
+		c.AbortWithStatusJSON(err.StatusCode, &res.Response{
+			Message: err.Err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, &res.Response{})
+}
+
+func (*AdminController) DeleteRepository(c *gin.Context) {
+	idRepository := c.Param("idRepository")
+	reason := c.DefaultQuery("reason", "")
+	claims, _ := services.NewClaimsFromContext(c)
+
+	err := adminService.DeleteRepository(claims.UserID, idRepository, reason)
+	if err != nil {
+		c.AbortWithStatusJSON(err.StatusCode, &res.Response{
+			Message: err.Err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, &res.Response{})
+}
+
+func (*AdminController) DeleteDiscussion(c *gin.Context) {
+	idDiscussion := c.Param("idDiscussion")
+	reason := c.DefaultQuery("reason", "")
+	claims, _ := services.NewClaimsFromContext(c)
+
+	err := adminService.DeleteDiscussion(claims.UserID, idDiscussion, reason)
+	if err != nil {
+		c.AbortWithStatusJSON(err.StatusCode, &res.Response{
+			Message: err.Err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, &res.Response{})
+}
+
+func (*AdminController) DeleteComment(c *gin.Context) {
+	idComment := c.Param("idComment")
+	reason := c.DefaultQuery("reason", "")
+	claims, _ := services.NewClaimsFromContext(c)
+
+	err := adminService.DeleteComment(claims.UserID, idComment, reason)
+	if err != nil {
+		c.AbortWithStatusJSON(err.StatusCode, &res.Response{
+			Message: err.Err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, &res.Response{})
+}
+
+func (*AdminController) GetAudits(c *gin.Context) {
+	// Page has 20 elements
+	page := c.DefaultQuery("page", "0")
+	pageNumber, err := strconv.Atoi(page)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, &res.Response{
+			Message: "page must be a int",
+		})
+		return
+	}
+
+	audits, errRes := adminService.GetAudits(pageNumber)
+	if errRes != nil {
+		c.AbortWithStatusJSON(errRes.StatusCode, &res.Response{
+			Message: errRes.Err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, &res.Response{
+		Data: map[string]interface{}{
+			"audits": audits,
+		},
+	})
+}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/CPU-commits/USACH.dev-Server/forms"
 	"github.com/CPU-commits/USACH.dev-Server/res"
+	"github.com/CPU-commits/USACH.dev-Server/services"
 	"github.com/gin-gonic/gin"
 )
 
@@ -63,7 +64,11 @@ func (a *AuthController) Login(c *gin.Context) {
 		return
 	}
 	// Login
-	response, err := authService.Login(loginForm)
+	response, err := authService.Login(
+		loginForm,
+		c.Request.UserAgent(),
+		c.ClientIP(),
+	)
 	if err != nil {
 		c.AbortWithStatusJSON(err.StatusCode, &res.Response{
 			Message: err.Err.Error(),
@@ -76,8 +81,143 @@ func (a *AuthController) Login(c *gin.Context) {
 	})
 }
 
+func (a *AuthController) LoginTwoFactor(c *gin.Context) {
+	var twoFactorForm *forms.TwoFactorLoginForm
+
+	if err := c.BindJSON(&twoFactorForm); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, &res.Response{
+			Message: err.Error(),
+		})
+		return
+	}
+	// Exchange challenge
+	response, err := authService.LoginTwoFactor(
+		twoFactorForm,
+		c.Request.UserAgent(),
+		c.ClientIP(),
+	)
+	if err != nil {
+		c.AbortWithStatusJSON(err.StatusCode, &res.Response{
+			Message: err.Err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, &res.Response{
+		Data: response,
+	})
+}
+
+func (a *AuthController) EnrollTwoFactor(c *gin.Context) {
+	claims, _ := services.NewClaimsFromContext(c)
+
+	response, err := twoFactorService.Enroll(claims.UserID)
+	if err != nil {
+		c.AbortWithStatusJSON(err.StatusCode, &res.Response{
+			Message: err.Err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, &res.Response{
+		Data: response,
+	})
+}
+
+func (a *AuthController) ConfirmTwoFactor(c *gin.Context) {
+	var codeForm *forms.TwoFactorCodeForm
+
+	if err := c.BindJSON(&codeForm); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, &res.Response{
+			Message: err.Error(),
+		})
+		return
+	}
+	claims, _ := services.NewClaimsFromContext(c)
+	// Confirm
+	recoveryCodes, err := twoFactorService.Confirm(claims.UserID, codeForm)
+	if err != nil {
+		c.AbortWithStatusJSON(err.StatusCode, &res.Response{
+			Message: err.Err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, &res.Response{
+		Data: map[string]interface{}{
+			"recovery_codes": recoveryCodes,
+		},
+	})
+}
+
+func (a *AuthController) DisableTwoFactor(c *gin.Context) {
+	var disableForm *forms.TwoFactorDisableForm
+
+	if err := c.BindJSON(&disableForm); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, &res.Response{
+			Message: err.Error(),
+		})
+		return
+	}
+	claims, _ := services.NewClaimsFromContext(c)
+	// Disable
+	err := twoFactorService.Disable(claims.UserID, disableForm)
+	if err != nil {
+		c.AbortWithStatusJSON(err.StatusCode, &res.Response{
+			Message: err.Err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, &res.Response{})
+}
+
 func (a *AuthController) RefreshToken(c *gin.Context) {
-	accessToken, err := authService.RefreshToken(c.Request)
+	tokens, err := authService.RefreshToken(c.Request)
+	if err != nil {
+		c.AbortWithStatusJSON(err.StatusCode, &res.Response{
+			Message: err.Err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, &res.Response{
+		Data: tokens,
+	})
+}
+
+func (a *AuthController) Logout(c *gin.Context) {
+	claims, _ := services.NewClaimsFromContext(c)
+
+	err := authService.Logout(claims)
+	if err != nil {
+		c.AbortWithStatusJSON(err.StatusCode, &res.Response{
+			Message: err.Err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, &res.Response{})
+}
+
+func (a *AuthController) LogoutAll(c *gin.Context) {
+	claims, _ := services.NewClaimsFromContext(c)
+
+	err := authService.LogoutAll(claims)
+	if err != nil {
+		c.AbortWithStatusJSON(err.StatusCode, &res.Response{
+			Message: err.Err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, &res.Response{})
+}
+
+func (a *AuthController) GetSessions(c *gin.Context) {
+	claims, _ := services.NewClaimsFromContext(c)
+
+	sessions, err := authService.GetSessions(claims)
 	if err != nil {
 		c.AbortWithStatusJSON(err.StatusCode, &res.Response{
 			Message: err.Err.Error(),
@@ -87,7 +227,65 @@ func (a *AuthController) RefreshToken(c *gin.Context) {
 
 	c.JSON(http.StatusOK, &res.Response{
 		Data: map[string]interface{}{
-			"token": accessToken,
+			"sessions": sessions,
 		},
 	})
 }
+
+func (a *AuthController) DeleteSession(c *gin.Context) {
+	idSession := c.Param("id")
+
+	claims, _ := services.NewClaimsFromContext(c)
+	// Revoke session
+	err := authService.DeleteSession(claims, idSession)
+	if err != nil {
+		c.AbortWithStatusJSON(err.StatusCode, &res.Response{
+			Message: err.Err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, &res.Response{})
+}
+
+func (a *AuthController) ForgotPassword(c *gin.Context) {
+	var forgotForm *forms.ForgotPasswordForm
+
+	if err := c.BindJSON(&forgotForm); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, &res.Response{
+			Message: err.Error(),
+		})
+		return
+	}
+	// Send reset email
+	err := usersService.ForgotPassword(forgotForm)
+	if err != nil {
+		c.AbortWithStatusJSON(err.StatusCode, &res.Response{
+			Message: err.Err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, &res.Response{})
+}
+
+func (a *AuthController) ResetPassword(c *gin.Context) {
+	var resetForm *forms.ResetPasswordForm
+
+	if err := c.BindJSON(&resetForm); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, &res.Response{
+			Message: err.Error(),
+		})
+		return
+	}
+	// Reset password
+	err := usersService.ResetPassword(resetForm)
+	if err != nil {
+		c.AbortWithStatusJSON(err.StatusCode, &res.Response{
+			Message: err.Err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, &res.Response{})
+}
@@ -0,0 +1,162 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/CPU-commits/USACH.dev-Server/forms"
+	"github.com/CPU-commits/USACH.dev-Server/res"
+	"github.com/CPU-commits/USACH.dev-Server/services"
+	"github.com/gin-gonic/gin"
+)
+
+type CollaboratorController struct{}
+
+func (*CollaboratorController) GetCollaborators(c *gin.Context) {
+	repository := c.Param("repository")
+	claims, _ := services.NewClaimsFromContext(c)
+
+	collaborators, err := collaboratorService.GetCollaborators(
+		repository,
+		claims.UserID,
+	)
+	if err != nil {
+		c.AbortWithStatusJSON(err.StatusCode, &res.Response{
+			Message: err.Err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, &res.Response{
+		Data: map[string]interface{}{
+			"collaborators": collaborators,
+		},
+	})
+}
+
+func (*CollaboratorController) InviteCollaborator(c *gin.Context) {
+	repository := c.Param("repository")
+
+	var collaboratorForm *forms.CollaboratorForm
+	if err := c.BindJSON(&collaboratorForm); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, &res.Response{
+			Message: err.Error(),
+		})
+		return
+	}
+	claims, _ := services.NewClaimsFromContext(c)
+
+	idInvitation, err := collaboratorService.InviteCollaborator(
+		repository,
+		claims.UserID,
+		collaboratorForm,
+	)
+	if err != nil {
+		c.AbortWithStatusJSON(err.StatusCode, &res.Response{
+			Message: err.Err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, &res.Response{
+		Data: map[string]interface{}{
+			"_id": idInvitation,
+		},
+	})
+}
+
+func (*CollaboratorController) UpdateCollaboratorRole(c *gin.Context) {
+	repository := c.Param("repository")
+	idCollaborator := c.Param("idUser")
+
+	var roleForm *forms.CollaboratorRoleForm
+	if err := c.BindJSON(&roleForm); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, &res.Response{
+			Message: err.Error(),
+		})
+		return
+	}
+	claims, _ := services.NewClaimsFromContext(c)
+
+	err := collaboratorService.UpdateCollaboratorRole(
+		repository,
+		idCollaborator,
+		claims.UserID,
+		roleForm,
+	)
+	if err != nil {
+		c.AbortWithStatusJSON(err.StatusCode, &res.Response{
+			Message: err.Err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, &res.Response{})
+}
+
+func (*CollaboratorController) RemoveCollaborator(c *gin.Context) {
+	repository := c.Param("repository")
+	idCollaborator := c.Param("idUser")
+	claims, _ := services.NewClaimsFromContext(c)
+
+	err := collaboratorService.RemoveCollaborator(
+		repository,
+		idCollaborator,
+		claims.UserID,
+	)
+	if err != nil {
+		c.AbortWithStatusJSON(err.StatusCode, &res.Response{
+			Message: err.Err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, &res.Response{})
+}
+
+func (*CollaboratorController) GetInvitations(c *gin.Context) {
+	claims, _ := services.NewClaimsFromContext(c)
+
+	invitations, err := collaboratorService.GetInvitations(claims.UserID)
+	if err != nil {
+		c.AbortWithStatusJSON(err.StatusCode, &res.Response{
+			Message: err.Err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, &res.Response{
+		Data: map[string]interface{}{
+			"invitations": invitations,
+		},
+	})
+}
+
+func (*CollaboratorController) AcceptInvitation(c *gin.Context) {
+	idInvitation := c.Param("idInvitation")
+	claims, _ := services.NewClaimsFromContext(c)
+
+	err := collaboratorService.AcceptInvitation(idInvitation, claims.UserID)
+	if err != nil {
+		c.AbortWithStatusJSON(err.StatusCode, &res.Response{
+			Message: err.Err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, &res.Response{})
+}
+
+func (*CollaboratorController) DeclineInvitation(c *gin.Context) {
+	idInvitation := c.Param("idInvitation")
+	claims, _ := services.NewClaimsFromContext(c)
+
+	err := collaboratorService.DeclineInvitation(idInvitation, claims.UserID)
+	if err != nil {
+		c.AbortWithStatusJSON(err.StatusCode, &res.Response{
+			Message: err.Err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, &res.Response{})
+}
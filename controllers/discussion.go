@@ -2,7 +2,6 @@ package controllers
 
 import (
 	"errors"
-	"io"
 	"mime/multipart"
 	"net/http"
 	"strconv"
@@ -101,21 +100,15 @@ func (d *DiscussionController) GetImage(c *gin.Context) {
 	discussion := c.Param("discussion")
 	image := c.Param("image")
 
-	c.Stream(func(w io.Writer) bool {
-		err := discussionService.GetImage(
-			discussion,
-			image,
-			w,
-		)
-		if err != nil {
-			c.AbortWithStatusJSON(err.StatusCode, &res.Response{
-				Message: err.Err.Error(),
-			})
-			return false
-		}
-
-		return false
-	})
+	file, err := discussionService.GetImage(discussion, image)
+	if err != nil {
+		c.AbortWithStatusJSON(err.StatusCode, &res.Response{
+			Message: err.Err.Error(),
+		})
+		return
+	}
+
+	serveFile(c, file)
 }
 
 func (d *DiscussionController) UploadDiscussion(c *gin.Context) {
@@ -0,0 +1,92 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/CPU-commits/USACH.dev-Server/forms"
+	"github.com/CPU-commits/USACH.dev-Server/res"
+	"github.com/CPU-commits/USACH.dev-Server/services"
+	"github.com/gin-gonic/gin"
+)
+
+type PersonalAccessTokenController struct{}
+
+func (*PersonalAccessTokenController) GetTokens(c *gin.Context) {
+	claims, _ := services.NewClaimsFromContext(c)
+
+	tokens, err := personalAccessTokenService.GetTokens(claims.UserID)
+	if err != nil {
+		c.AbortWithStatusJSON(err.StatusCode, &res.Response{
+			Message: err.Err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, &res.Response{
+		Data: map[string]interface{}{
+			"tokens": tokens,
+		},
+	})
+}
+
+func (*PersonalAccessTokenController) CreateToken(c *gin.Context) {
+	var tokenForm *forms.PersonalAccessTokenForm
+	if err := c.BindJSON(&tokenForm); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, &res.Response{
+			Message: err.Error(),
+		})
+		return
+	}
+	claims, _ := services.NewClaimsFromContext(c)
+	// Create token
+	response, err := personalAccessTokenService.CreateToken(claims.UserID, tokenForm)
+	if err != nil {
+		c.AbortWithStatusJSON(err.StatusCode, &res.Response{
+			Message: err.Err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, &res.Response{
+		Data: response,
+	})
+}
+
+func (*PersonalAccessTokenController) UpdateToken(c *gin.Context) {
+	idToken := c.Param("idToken")
+
+	var tokenForm *forms.UpdatePersonalAccessTokenForm
+	if err := c.BindJSON(&tokenForm); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, &res.Response{
+			Message: err.Error(),
+		})
+		return
+	}
+	claims, _ := services.NewClaimsFromContext(c)
+	// Update token
+	err := personalAccessTokenService.UpdateToken(claims.UserID, idToken, tokenForm)
+	if err != nil {
+		c.AbortWithStatusJSON(err.StatusCode, &res.Response{
+			Message: err.Err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, &res.Response{})
+}
+
+func (*PersonalAccessTokenController) DeleteToken(c *gin.Context) {
+	idToken := c.Param("idToken")
+
+	claims, _ := services.NewClaimsFromContext(c)
+	// Delete token
+	err := personalAccessTokenService.DeleteToken(claims.UserID, idToken)
+	if err != nil {
+		c.AbortWithStatusJSON(err.StatusCode, &res.Response{
+			Message: err.Err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, &res.Response{})
+}
@@ -3,6 +3,7 @@ package controllers
 import (
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
 	"strconv"
 
@@ -10,6 +11,7 @@ import (
 	"github.com/CPU-commits/USACH.dev-Server/middlewares"
 	"github.com/CPU-commits/USACH.dev-Server/res"
 	"github.com/CPU-commits/USACH.dev-Server/services"
+	"github.com/CPU-commits/USACH.dev-Server/utils"
 	"github.com/gin-gonic/gin"
 )
 
@@ -104,40 +106,107 @@ func (r *RepositoryController) GetUserRepositories(c *gin.Context) {
 	})
 }
 
+func (r *RepositoryController) ForkRepository(c *gin.Context) {
+	repository := c.Param("repository")
+
+	var forkForm forms.ForkRepositoryForm
+	if err := c.ShouldBindQuery(&forkForm); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, &res.Response{
+			Message: err.Error(),
+		})
+		return
+	}
+	claims, _ := services.NewClaimsFromContext(c)
+
+	fork, err := repoService.ForkRepository(repository, claims.UserID, &forkForm)
+	if err != nil {
+		c.AbortWithStatusJSON(err.StatusCode, &res.Response{
+			Message: err.Err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, &res.Response{
+		Data: fork,
+	})
+}
+
+// DownloadRepository is also used to download a folder, given as the
+// folder param or as the child query
 func (r *RepositoryController) DownloadRepository(c *gin.Context) {
 	repository := c.Param("repository")
-	child := c.DefaultQuery("child", "")
+	child := c.Param("folder")
+	if child == "" {
+		child = c.DefaultQuery("child", "")
+	}
+	var downloadForm forms.DownloadForm
+	if err := c.ShouldBindQuery(&downloadForm); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, &res.Response{
+			Message: err.Error(),
+		})
+		return
+	}
+	format := downloadForm.Format
+	if format == "" {
+		format = utils.ARCHIVE_ZIP
+	}
 	// Set headers
-	var fileName string
-	var contentType string
+	fileName := fmt.Sprintf("repositorio.%s", format)
+	contentType := utils.ArchiveContentType(format)
+	claims, _ := services.NewClaimsFromContext(c)
 	if child != "" {
-		var err *res.ErrorRes
+		// Files are downloaded as they are
+		file, err := repoService.GetChildFile(repository, child, claims.UserID)
+		if err != nil {
+			c.AbortWithStatusJSON(err.StatusCode, &res.Response{
+				Message: err.Err.Error(),
+			})
+			return
+		}
+		if file != nil {
+			if redirectFile(c, file) {
+				return
+			}
+			c.Header("Content-Disposition", mime.FormatMediaType(
+				"attachment",
+				map[string]string{"filename": file.Name},
+			))
+			serveFile(c, file)
+			return
+		}
 		// Name
-		fileName, contentType, err = repoService.GetChildFileNameAndContentType(child)
+		fileName, contentType, err = repoService.GetChildFileNameAndContentType(
+			repository,
+			child,
+			format,
+			claims.UserID,
+		)
 		if err != nil {
+			c.AbortWithStatusJSON(err.StatusCode, &res.Response{
+				Message: err.Err.Error(),
+			})
 			return
 		}
-	} else {
-		contentType = "application/octet-stream"
-		fileName = "repositorio.zip"
 	}
-	fmt.Printf("fileName: %v\n", fileName)
 	c.Writer.Header().Set(
 		"Content-Type",
 		contentType,
 	)
 	c.Writer.Header().Set(
 		"Content-Disposition",
-		fmt.Sprintf("attachment; filename='%s'", fileName),
+		mime.FormatMediaType("attachment", map[string]string{"filename": fileName}),
 	)
 
 	c.Stream(func(w io.Writer) bool {
-		err := repoService.DownloadRepository(repository, child, w)
+		err := repoService.DownloadRepository(
+			repository,
+			child,
+			format,
+			claims.UserID,
+			w,
+		)
 		if err != nil {
-			c.AbortWithStatusJSON(err.StatusCode, &res.Response{
-				Message: err.Err.Error(),
-			})
-			return false
+			abortStream(c, err)
 		}
 
 		return false
@@ -268,3 +337,82 @@ func (r *RepositoryController) DeleteRepository(c *gin.Context) {
 	}
 	c.JSON(http.StatusOK, &res.Response{})
 }
+
+func (r *RepositoryController) TransferRepository(c *gin.Context) {
+	idRepository := c.Param("repository")
+
+	var transferForm *forms.TransferRepositoryForm
+	if err := c.BindJSON(&transferForm); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, &res.Response{
+			Message: err.Error(),
+		})
+		return
+	}
+	claims, _ := services.NewClaimsFromContext(c)
+
+	idTransfer, err := transferService.TransferRepository(
+		idRepository,
+		claims.UserID,
+		transferForm,
+	)
+	if err != nil {
+		c.AbortWithStatusJSON(err.StatusCode, &res.Response{
+			Message: err.Err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, &res.Response{
+		Data: map[string]interface{}{
+			"_id": idTransfer,
+		},
+	})
+}
+
+func (r *RepositoryController) GetTransfers(c *gin.Context) {
+	claims, _ := services.NewClaimsFromContext(c)
+
+	transfers, err := transferService.GetTransfers(claims.UserID)
+	if err != nil {
+		c.AbortWithStatusJSON(err.StatusCode, &res.Response{
+			Message: err.Err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, &res.Response{
+		Data: map[string]interface{}{
+			"transfers": transfers,
+		},
+	})
+}
+
+func (r *RepositoryController) AcceptTransfer(c *gin.Context) {
+	idTransfer := c.Param("idTransfer")
+	claims, _ := services.NewClaimsFromContext(c)
+
+	err := transferService.AcceptTransfer(idTransfer, claims.UserID)
+	if err != nil {
+		c.AbortWithStatusJSON(err.StatusCode, &res.Response{
+			Message: err.Err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, &res.Response{})
+}
+
+func (r *RepositoryController) DeclineTransfer(c *gin.Context) {
+	idTransfer := c.Param("idTransfer")
+	claims, _ := services.NewClaimsFromContext(c)
+
+	err := transferService.DeclineTransfer(idTransfer, claims.UserID)
+	if err != nil {
+		c.AbortWithStatusJSON(err.StatusCode, &res.Response{
+			Message: err.Err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, &res.Response{})
+}
@@ -7,13 +7,22 @@ import (
 
 // Services
 var (
-	usersService      = services.NewUserService()
-	authService       = services.NewAuthService()
-	repoService       = services.NewRepositoryService()
-	systemFileService = services.NewSystemFileService()
-	linkService       = services.NewLinkService()
-	discussionService = services.NewDiscussionService()
-	commentService    = services.NewCommentService()
+	usersService        = services.NewUserService()
+	authService         = services.NewAuthService()
+	repoService         = services.NewRepositoryService()
+	systemFileService   = services.NewSystemFileService()
+	linkService         = services.NewLinkService()
+	discussionService   = services.NewDiscussionService()
+	commentService      = services.NewCommentService()
+	twoFactorService    = services.NewTwoFactorService()
+	adminService        = services.NewAdminService()
+	followService       = services.NewFollowService()
+	collaboratorService = services.NewCollaboratorService()
+	transferService     = services.NewTransferService()
+	snapshotService     = services.NewSnapshotService()
+	uploadService       = services.NewUploadService()
+
+	personalAccessTokenService = services.NewPersonalAccessTokenService()
 )
 
 // Settings
@@ -0,0 +1,156 @@
+package controllers
+
+import (
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/CPU-commits/USACH.dev-Server/forms"
+	"github.com/CPU-commits/USACH.dev-Server/res"
+	"github.com/CPU-commits/USACH.dev-Server/services"
+	"github.com/CPU-commits/USACH.dev-Server/utils"
+	"github.com/gin-gonic/gin"
+)
+
+type SnapshotController struct{}
+
+func (*SnapshotController) CreateSnapshot(c *gin.Context) {
+	repository := c.Param("repository")
+
+	var snapshotForm *forms.SnapshotForm
+	if err := c.BindJSON(&snapshotForm); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, &res.Response{
+			Message: err.Error(),
+		})
+		return
+	}
+	claims, _ := services.NewClaimsFromContext(c)
+
+	idSnapshot, err := snapshotService.CreateSnapshot(
+		repository,
+		claims.UserID,
+		snapshotForm,
+	)
+	if err != nil {
+		c.AbortWithStatusJSON(err.StatusCode, &res.Response{
+			Message: err.Err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, &res.Response{
+		Data: map[string]interface{}{
+			"_id": idSnapshot,
+		},
+	})
+}
+
+func (*SnapshotController) GetSnapshot(c *gin.Context) {
+	repository := c.Param("repository")
+	tag := c.Param("tag")
+	claims, _ := services.NewClaimsFromContext(c)
+
+	snapshot, err := snapshotService.GetSnapshot(repository, tag, claims.UserID)
+	if err != nil {
+		c.AbortWithStatusJSON(err.StatusCode, &res.Response{
+			Message: err.Err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, &res.Response{
+		Data: map[string]interface{}{
+			"snapshot": snapshot,
+		},
+	})
+}
+
+func (*SnapshotController) DownloadSnapshot(c *gin.Context) {
+	repository := c.Param("repository")
+	tag := c.Param("tag")
+
+	var downloadForm forms.DownloadForm
+	if err := c.ShouldBindQuery(&downloadForm); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, &res.Response{
+			Message: err.Error(),
+		})
+		return
+	}
+	format := downloadForm.Format
+	if format == "" {
+		format = utils.ARCHIVE_ZIP
+	}
+	claims, _ := services.NewClaimsFromContext(c)
+
+	snapshot, err := snapshotService.GetDownloadSnapshot(
+		repository,
+		tag,
+		claims.UserID,
+	)
+	if err != nil {
+		c.AbortWithStatusJSON(err.StatusCode, &res.Response{
+			Message: err.Err.Error(),
+		})
+		return
+	}
+	c.Writer.Header().Set("Content-Type", utils.ArchiveContentType(format))
+	c.Writer.Header().Set("Content-Disposition", mime.FormatMediaType(
+		"attachment",
+		map[string]string{"filename": tag + "." + format},
+	))
+
+	c.Stream(func(w io.Writer) bool {
+		err := snapshotService.DownloadSnapshot(snapshot, format, w)
+		if err != nil {
+			abortStream(c, err)
+		}
+
+		return false
+	})
+}
+
+func (*SnapshotController) Compare(c *gin.Context) {
+	username := c.Param("username")
+	repositoryName := c.Param("repository")
+	from := c.Query("from")
+	to := c.Query("to")
+
+	idObjRepository, err := repoService.GetRepositoryId(username, repositoryName)
+	if err != nil {
+		c.AbortWithStatusJSON(err.StatusCode, &res.Response{
+			Message: err.Err.Error(),
+		})
+		return
+	}
+	claims, _ := services.NewClaimsFromContext(c)
+
+	compare, err := snapshotService.Compare(*idObjRepository, from, to, claims.UserID)
+	if err != nil {
+		c.AbortWithStatusJSON(err.StatusCode, &res.Response{
+			Message: err.Err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, &res.Response{
+		Data: map[string]interface{}{
+			"compare": compare,
+		},
+	})
+}
+
+func (*SnapshotController) DeleteSnapshot(c *gin.Context) {
+	repository := c.Param("repository")
+	tag := c.Param("tag")
+	claims, _ := services.NewClaimsFromContext(c)
+
+	err := snapshotService.DeleteSnapshot(repository, tag, claims.UserID)
+	if err != nil {
+		c.AbortWithStatusJSON(err.StatusCode, &res.Response{
+			Message: err.Err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, &res.Response{})
+}
@@ -1,13 +1,17 @@
 package controllers
 
 import (
+	"encoding/json"
+	"mime"
 	"mime/multipart"
 	"net/http"
 
 	"github.com/CPU-commits/USACH.dev-Server/forms"
 	"github.com/CPU-commits/USACH.dev-Server/middlewares"
+	"github.com/CPU-commits/USACH.dev-Server/models"
 	"github.com/CPU-commits/USACH.dev-Server/res"
 	"github.com/CPU-commits/USACH.dev-Server/services"
+	"github.com/CPU-commits/USACH.dev-Server/utils"
 	"github.com/gin-gonic/gin"
 )
 
@@ -49,6 +53,103 @@ func (s *SystemFileController) GetFolder(c *gin.Context) {
 	})
 }
 
+func (s *SystemFileController) GetTree(c *gin.Context) {
+	username := c.Param("username")
+	repositoryName := c.Param("repository")
+	path := c.Param("path")
+
+	idObjRepository, err := repoService.GetRepositoryId(username, repositoryName)
+	if err != nil {
+		c.AbortWithStatusJSON(err.StatusCode, &res.Response{
+			Message: err.Err.Error(),
+		})
+		return
+	}
+	claims, _ := services.NewClaimsFromContext(c)
+
+	tree, err := systemFileService.GetTree(*idObjRepository, path, claims.UserID)
+	if err != nil {
+		c.AbortWithStatusJSON(err.StatusCode, &res.Response{
+			Message: err.Err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, &res.Response{
+		Data: map[string]interface{}{
+			"tree": tree,
+		},
+	})
+}
+
+func (s *SystemFileController) GetRawFile(c *gin.Context) {
+	username := c.Param("username")
+	repositoryName := c.Param("repository")
+	path := c.Param("path")
+
+	idObjRepository, err := repoService.GetRepositoryId(username, repositoryName)
+	if err != nil {
+		c.AbortWithStatusJSON(err.StatusCode, &res.Response{
+			Message: err.Err.Error(),
+		})
+		return
+	}
+	claims, _ := services.NewClaimsFromContext(c)
+
+	file, err := systemFileService.GetRawFile(*idObjRepository, path, claims.UserID)
+	if err != nil {
+		c.AbortWithStatusJSON(err.StatusCode, &res.Response{
+			Message: err.Err.Error(),
+		})
+		return
+	}
+	// Uploaded files must not run as pages of the API
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Content-Security-Policy", "sandbox")
+
+	serveFile(c, file)
+}
+
+// serveFile answers with the stored file, by ranges and conditional
+// requests
+func serveFile(c *gin.Context, file *utils.ServedFile) {
+	if err := utils.ServeFile(c.Writer, c.Request, file); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, &res.Response{
+			Message: err.Error(),
+		})
+	}
+}
+
+// abortStream answers the error if nothing was sent yet, otherwise the
+// connection is closed so the client sees the download failed
+func abortStream(c *gin.Context, err *res.ErrorRes) {
+	if !c.Writer.Written() {
+		c.AbortWithStatusJSON(err.StatusCode, &res.Response{
+			Message: err.Err.Error(),
+		})
+		return
+	}
+	c.Set(middlewares.ABORT_CONNECTION_KEY, true)
+	c.Abort()
+}
+
+// redirectFile sends the client to the storage if it serves the file by
+// itself, true if the request was answered
+func redirectFile(c *gin.Context, file *utils.ServedFile) bool {
+	url, err := systemFileService.FileURL(file)
+	if err != nil {
+		c.AbortWithStatusJSON(err.StatusCode, &res.Response{
+			Message: err.Err.Error(),
+		})
+		return true
+	}
+	if url == "" {
+		return false
+	}
+	c.Redirect(http.StatusTemporaryRedirect, url)
+	return true
+}
+
 func (s *SystemFileController) NewRepoElement(c *gin.Context) {
 	// Route
 	repository := c.Param("idRepository")
@@ -104,6 +205,196 @@ func (s *SystemFileController) NewRepoElement(c *gin.Context) {
 	})
 }
 
+func (s *SystemFileController) ImportArchive(c *gin.Context) {
+	repository := c.Param("idRepository")
+	parent := c.DefaultQuery("parent", "")
+
+	file, err := c.FormFile("file")
+	if err != nil || file == nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, &res.Response{
+			Message: "No ha envíado ningún archivo",
+		})
+		return
+	}
+	claims, _ := services.NewClaimsFromContext(c)
+	// Progress is streamed as a JSON object by line
+	started := false
+	encoder := json.NewEncoder(c.Writer)
+	send := func(event interface{}) {
+		if !started {
+			c.Header("Content-Type", "application/x-ndjson")
+			c.Status(http.StatusOK)
+			started = true
+		}
+		encoder.Encode(event)
+		c.Writer.Flush()
+	}
+
+	result, errRes := systemFileService.ImportArchive(
+		repository,
+		parent,
+		claims.UserID,
+		file,
+		func(event *models.ImportEvent) {
+			send(event)
+		},
+	)
+	if errRes != nil {
+		if !started {
+			c.AbortWithStatusJSON(errRes.StatusCode, &res.Response{
+				Message: errRes.Err.Error(),
+			})
+			return
+		}
+		send(&res.Response{
+			Message: errRes.Err.Error(),
+		})
+		return
+	}
+	send(result)
+}
+
+func (s *SystemFileController) MoveElement(c *gin.Context) {
+	repository := c.Param("idRepository")
+	element := c.Param("element")
+
+	var moveForm forms.MoveElementForm
+	if err := c.ShouldBindJSON(&moveForm); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, &res.Response{
+			Message: err.Error(),
+		})
+		return
+	}
+	claims, _ := services.NewClaimsFromContext(c)
+	// Move element
+	err := systemFileService.MoveElement(
+		repository,
+		element,
+		claims.UserID,
+		&moveForm,
+	)
+	if err != nil {
+		c.AbortWithStatusJSON(err.StatusCode, &res.Response{
+			Message: err.Err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, &res.Response{})
+}
+
+func (s *SystemFileController) ReplaceFile(c *gin.Context) {
+	repository := c.Param("idRepository")
+	element := c.Param("element")
+
+	file, err := c.FormFile("file")
+	if err != nil || file == nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, &res.Response{
+			Message: "No ha envíado ningún archivo",
+		})
+		return
+	}
+	claims, _ := services.NewClaimsFromContext(c)
+	// Upload version
+	version, errRes := systemFileService.ReplaceFile(
+		repository,
+		element,
+		claims.UserID,
+		file,
+	)
+	if errRes != nil {
+		c.AbortWithStatusJSON(errRes.StatusCode, &res.Response{
+			Message: errRes.Err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, &res.Response{
+		Data: map[string]interface{}{
+			"version": version,
+		},
+	})
+}
+
+func (s *SystemFileController) GetVersions(c *gin.Context) {
+	repository := c.Param("repository")
+	element := c.Param("element")
+
+	claims, _ := services.NewClaimsFromContext(c)
+
+	versions, err := systemFileService.GetVersions(repository, element, claims.UserID)
+	if err != nil {
+		c.AbortWithStatusJSON(err.StatusCode, &res.Response{
+			Message: err.Err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, &res.Response{
+		Data: map[string]interface{}{
+			"versions": versions,
+		},
+	})
+}
+
+func (s *SystemFileController) GetVersionFile(c *gin.Context) {
+	repository := c.Param("repository")
+	element := c.Param("element")
+	version := c.Param("version")
+	claims, _ := services.NewClaimsFromContext(c)
+
+	file, err := systemFileService.GetVersionFile(
+		repository,
+		element,
+		version,
+		claims.UserID,
+	)
+	if err != nil {
+		c.AbortWithStatusJSON(err.StatusCode, &res.Response{
+			Message: err.Err.Error(),
+		})
+		return
+	}
+	if redirectFile(c, file) {
+		return
+	}
+	// Uploaded files must not run as pages of the API
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Content-Security-Policy", "sandbox")
+	c.Header("Content-Disposition", mime.FormatMediaType(
+		"attachment",
+		map[string]string{"filename": file.Name},
+	))
+
+	serveFile(c, file)
+}
+
+func (s *SystemFileController) RestoreVersion(c *gin.Context) {
+	repository := c.Param("repository")
+	element := c.Param("element")
+	idVersion := c.Param("version")
+	claims, _ := services.NewClaimsFromContext(c)
+
+	version, err := systemFileService.RestoreVersion(
+		repository,
+		element,
+		idVersion,
+		claims.UserID,
+	)
+	if err != nil {
+		c.AbortWithStatusJSON(err.StatusCode, &res.Response{
+			Message: err.Err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, &res.Response{
+		Data: map[string]interface{}{
+			"version": version,
+		},
+	})
+}
+
 func (s *SystemFileController) DeleteElement(c *gin.Context) {
 	repository := c.Param("repository")
 	element := c.Param("element")
@@ -0,0 +1,217 @@
+package controllers
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/CPU-commits/USACH.dev-Server/models"
+	"github.com/CPU-commits/USACH.dev-Server/res"
+	"github.com/CPU-commits/USACH.dev-Server/services"
+	"github.com/gin-gonic/gin"
+)
+
+// UploadController implements the tus protocol for resumable uploads,
+// https://tus.io/protocols/resumable-upload
+type UploadController struct{}
+
+// parseUploadMetadata decodes the Upload-Metadata header, pairs of key
+// and base64 value separated by commas
+func parseUploadMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	if header == "" {
+		return metadata, nil
+	}
+	for _, pair := range strings.Split(header, ",") {
+		fields := strings.Fields(pair)
+		if len(fields) == 0 || len(fields) > 2 {
+			return nil, errors.New("Upload-Metadata no es válido")
+		}
+		var value []byte
+		if len(fields) == 2 {
+			var err error
+			value, err = base64.StdEncoding.DecodeString(fields[1])
+			if err != nil {
+				return nil, errors.New("Upload-Metadata no es válido")
+			}
+		}
+		metadata[fields[0]] = string(value)
+	}
+	return metadata, nil
+}
+
+// checkTusResumable answers the requests of other versions of the
+// protocol, only the discovery is free of it
+func (*UploadController) checkTusResumable(c *gin.Context) bool {
+	c.Header("Tus-Resumable", services.TUS_VERSION)
+	if c.GetHeader("Tus-Resumable") != services.TUS_VERSION {
+		c.Header("Tus-Version", services.TUS_VERSION)
+		c.AbortWithStatusJSON(http.StatusPreconditionFailed, &res.Response{
+			Message: "versión de tus no soportada",
+		})
+		return false
+	}
+	return true
+}
+
+func (*UploadController) setUploadHeaders(c *gin.Context, upload *models.Upload) {
+	c.Header("Upload-Offset", fmt.Sprint(upload.Offset))
+	c.Header("Upload-Expires", upload.Expires.Time().UTC().Format(http.TimeFormat))
+	c.Header("Cache-Control", "no-store")
+}
+
+func (*UploadController) Options(c *gin.Context) {
+	c.Header("Tus-Resumable", services.TUS_VERSION)
+	c.Header("Tus-Version", services.TUS_VERSION)
+	c.Header("Tus-Extension", services.TUS_EXTENSIONS)
+	c.Header("Tus-Max-Size", fmt.Sprint(services.UPLOAD_MAX_SIZE))
+
+	c.Status(http.StatusNoContent)
+}
+
+// CreateUpload answers with the id of the element if the file is empty,
+// as it is complete at once
+func (u *UploadController) CreateUpload(c *gin.Context) {
+	if !u.checkTusResumable(c) {
+		return
+	}
+	repository := c.Param("idRepository")
+	claims, _ := services.NewClaimsFromContext(c)
+
+	length, err := strconv.ParseInt(c.GetHeader("Upload-Length"), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, &res.Response{
+			Message: "Upload-Length no es válido",
+		})
+		return
+	}
+	metadata, err := parseUploadMetadata(c.GetHeader("Upload-Metadata"))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, &res.Response{
+			Message: err.Error(),
+		})
+		return
+	}
+
+	upload, element, errRes := uploadService.CreateUpload(
+		repository,
+		claims.UserID,
+		length,
+		metadata,
+	)
+	if errRes != nil {
+		c.AbortWithStatusJSON(errRes.StatusCode, &res.Response{
+			Message: errRes.Err.Error(),
+		})
+		return
+	}
+	// A complete upload has nothing left to resume
+	if element != nil {
+		c.Header("Upload-Offset", fmt.Sprint(upload.Offset))
+		c.Header("Upload-Element", element.ID.Hex())
+	} else {
+		c.Header("Location", fmt.Sprintf("%s/%s", c.Request.URL.Path, upload.ID.Hex()))
+		c.Header("Upload-Expires", upload.Expires.Time().UTC().Format(http.TimeFormat))
+	}
+
+	c.Status(http.StatusCreated)
+}
+
+func (u *UploadController) GetUploadOffset(c *gin.Context) {
+	if !u.checkTusResumable(c) {
+		return
+	}
+	repository := c.Param("idRepository")
+	idUpload := c.Param("upload")
+	claims, _ := services.NewClaimsFromContext(c)
+
+	upload, err := uploadService.GetUpload(repository, idUpload, claims.UserID)
+	if err != nil {
+		c.AbortWithStatusJSON(err.StatusCode, &res.Response{
+			Message: err.Err.Error(),
+		})
+		return
+	}
+	u.setUploadHeaders(c, upload)
+	c.Header("Upload-Length", fmt.Sprint(upload.Length))
+
+	c.Status(http.StatusOK)
+}
+
+// WritePart answers with the id of the element once the upload is
+// complete
+func (u *UploadController) WritePart(c *gin.Context) {
+	if !u.checkTusResumable(c) {
+		return
+	}
+	if c.ContentType() != "application/offset+octet-stream" {
+		c.AbortWithStatusJSON(http.StatusUnsupportedMediaType, &res.Response{
+			Message: "Content-Type debe ser application/offset+octet-stream",
+		})
+		return
+	}
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, &res.Response{
+			Message: "Upload-Offset no es válido",
+		})
+		return
+	}
+	repository := c.Param("idRepository")
+	idUpload := c.Param("upload")
+	claims, _ := services.NewClaimsFromContext(c)
+
+	upload, errRes := uploadService.GetUpload(repository, idUpload, claims.UserID)
+	if errRes != nil {
+		c.AbortWithStatusJSON(errRes.StatusCode, &res.Response{
+			Message: errRes.Err.Error(),
+		})
+		return
+	}
+	element, errRes := uploadService.WritePart(
+		upload,
+		offset,
+		c.Request.ContentLength,
+		c.Request.Body,
+	)
+	u.setUploadHeaders(c, upload)
+	if errRes != nil {
+		c.AbortWithStatusJSON(errRes.StatusCode, &res.Response{
+			Message: errRes.Err.Error(),
+		})
+		return
+	}
+	if element != nil {
+		c.Header("Upload-Element", element.ID.Hex())
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (u *UploadController) DeleteUpload(c *gin.Context) {
+	if !u.checkTusResumable(c) {
+		return
+	}
+	repository := c.Param("idRepository")
+	idUpload := c.Param("upload")
+	claims, _ := services.NewClaimsFromContext(c)
+
+	upload, err := uploadService.GetUpload(repository, idUpload, claims.UserID)
+	if err != nil {
+		c.AbortWithStatusJSON(err.StatusCode, &res.Response{
+			Message: err.Err.Error(),
+		})
+		return
+	}
+	if err := uploadService.DeleteUpload(upload); err != nil {
+		c.AbortWithStatusJSON(err.StatusCode, &res.Response{
+			Message: err.Err.Error(),
+		})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -2,9 +2,8 @@ package controllers
 
 import (
 	"errors"
-	"fmt"
-	"io"
 	"net/http"
+	"strconv"
 
 	"github.com/CPU-commits/USACH.dev-Server/forms"
 	"github.com/CPU-commits/USACH.dev-Server/res"
@@ -38,32 +37,35 @@ func (u *UserController) GetUser(c *gin.Context) {
 
 func (*UserController) GetAvatar(c *gin.Context) {
 	username := c.Param("username")
+	size, err := strconv.Atoi(c.DefaultQuery("size", "128"))
+	if err != nil || size <= 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, &res.Response{
+			Message: "size must be a positive int",
+		})
+		return
+	}
 
-	c.Stream(func(w io.Writer) bool {
-		err := usersService.GetAvatar(username, w)
-		if err != nil {
-			c.AbortWithStatusJSON(err.StatusCode, &res.Response{
-				Message: err.Err.Error(),
-			})
-			return false
-		}
+	avatar, errRes := usersService.GetAvatar(username, size)
+	if errRes != nil {
+		c.AbortWithStatusJSON(errRes.StatusCode, &res.Response{
+			Message: errRes.Err.Error(),
+		})
+		return
+	}
 
-		return false
-	})
+	c.Header("Cache-Control", "public, max-age=3600")
+	serveFile(c, avatar)
 }
 
 func (*UserController) UpdateProfile(c *gin.Context) {
 	claims, _ := services.NewClaimsFromContext(c)
 
-	var profile *forms.ProfileForm
-	if c.PostForm("description") != "" {
-		if err := c.ShouldBind(&profile); err != nil {
-			fmt.Printf("err: %v\n", err)
-			c.AbortWithStatusJSON(http.StatusBadRequest, &res.Response{
-				Message: err.Error(),
-			})
-			return
-		}
+	var profile forms.ProfileForm
+	if err := c.ShouldBind(&profile); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, &res.Response{
+			Message: err.Error(),
+		})
+		return
 	}
 	// Form
 	avatar, err := c.FormFile("avatar")
@@ -74,7 +76,7 @@ func (*UserController) UpdateProfile(c *gin.Context) {
 		}
 	}
 	// Update profile
-	errRes := usersService.UpdateProfile(claims.UserID, profile, avatar)
+	errRes := usersService.UpdateProfile(claims.UserID, &profile, avatar)
 	if errRes != nil {
 		c.AbortWithStatusJSON(errRes.StatusCode, &res.Response{
 			Message: errRes.Err.Error(),
@@ -84,3 +86,109 @@ func (*UserController) UpdateProfile(c *gin.Context) {
 
 	c.JSON(http.StatusOK, &res.Response{})
 }
+
+func (*UserController) Follow(c *gin.Context) {
+	username := c.Param("username")
+	claims, _ := services.NewClaimsFromContext(c)
+
+	err := followService.Follow(claims.UserID, username)
+	if err != nil {
+		c.AbortWithStatusJSON(err.StatusCode, &res.Response{
+			Message: err.Err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, &res.Response{})
+}
+
+func (*UserController) Unfollow(c *gin.Context) {
+	username := c.Param("username")
+	claims, _ := services.NewClaimsFromContext(c)
+
+	err := followService.Unfollow(claims.UserID, username)
+	if err != nil {
+		c.AbortWithStatusJSON(err.StatusCode, &res.Response{
+			Message: err.Err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, &res.Response{})
+}
+
+func (*UserController) GetFollowers(c *gin.Context) {
+	username := c.Param("idUser")
+	// Page has 20 elements
+	page := c.DefaultQuery("page", "0")
+	pageNumber, err := strconv.Atoi(page)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, &res.Response{
+			Message: "page must be a int",
+		})
+		return
+	}
+
+	users, total, errRes := followService.GetFollowers(username, pageNumber)
+	if errRes != nil {
+		c.AbortWithStatusJSON(errRes.StatusCode, &res.Response{
+			Message: errRes.Err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, &res.Response{
+		Data: map[string]interface{}{
+			"users": users,
+			"total": total,
+		},
+	})
+}
+
+func (*UserController) GetFollowing(c *gin.Context) {
+	username := c.Param("idUser")
+	// Page has 20 elements
+	page := c.DefaultQuery("page", "0")
+	pageNumber, err := strconv.Atoi(page)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, &res.Response{
+			Message: "page must be a int",
+		})
+		return
+	}
+
+	users, total, errRes := followService.GetFollowing(username, pageNumber)
+	if errRes != nil {
+		c.AbortWithStatusJSON(errRes.StatusCode, &res.Response{
+			Message: errRes.Err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, &res.Response{
+		Data: map[string]interface{}{
+			"users": users,
+			"total": total,
+		},
+	})
+}
+
+func (*UserController) GetFeed(c *gin.Context) {
+	cursor := c.DefaultQuery("cursor", "")
+	claims, _ := services.NewClaimsFromContext(c)
+
+	feed, next, err := followService.GetFeed(claims.UserID, cursor)
+	if err != nil {
+		c.AbortWithStatusJSON(err.StatusCode, &res.Response{
+			Message: err.Err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, &res.Response{
+		Data: map[string]interface{}{
+			"feed": feed,
+			"next": next,
+		},
+	})
+}
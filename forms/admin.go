@@ -0,0 +1,10 @@
+package forms
+
+type UserStatusForm struct {
+	Status *bool  `json:"status" binding:"required"`
+	Reason string `json:"reason" binding:"max=300"`
+}
+
+type UserRoleForm struct {
+	Role string `json:"role" binding:"required,oneof=a b"`
+}
@@ -0,0 +1,10 @@
+package forms
+
+type CollaboratorForm struct {
+	Username string `json:"username" binding:"required,max=100"`
+	Role     string `json:"role" binding:"required,oneof=read write admin"`
+}
+
+type CollaboratorRoleForm struct {
+	Role string `json:"role" binding:"required,oneof=read write admin"`
+}
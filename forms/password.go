@@ -0,0 +1,10 @@
+package forms
+
+type ForgotPasswordForm struct {
+	Email string `json:"email" binding:"required,max=100,email"`
+}
+
+type ResetPasswordForm struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required,min=8,max=50"`
+}
@@ -0,0 +1,12 @@
+package forms
+
+type PersonalAccessTokenForm struct {
+	Name      string   `json:"name" binding:"required,max=100"`
+	Scopes    []string `json:"scopes" binding:"required,min=1"`
+	ExpiresIn int      `json:"expires_in" binding:"required,min=1,max=365"`
+}
+
+type UpdatePersonalAccessTokenForm struct {
+	Name   string   `json:"name" binding:"max=100"`
+	Scopes []string `json:"scopes" binding:"omitempty,min=1"`
+}
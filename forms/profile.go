@@ -1,5 +1,63 @@
 package forms
 
+import (
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// Optional fields are pointers, sending them empty removes them
 type ProfileForm struct {
-	Description string `form:"description" binding:"max=500"`
+	Description string    `form:"description" binding:"max=500"`
+	Instagram   *string   `form:"instagram" binding:"omitempty,isInstagram"`
+	Github      *string   `form:"github" binding:"omitempty,isGithub"`
+	Twitter     *string   `form:"twitter" binding:"omitempty,isTwitter"`
+	Career      *string   `form:"career" binding:"omitempty,max=100"`
+	EntryYear   *int      `form:"entry_year" binding:"omitempty,isEntryYear"`
+	Website     *string   `form:"website" binding:"omitempty,max=200,isWebsite"`
+	Pinned      *[]string `form:"pinned" binding:"omitempty,max=6,dive,omitempty,isMongoId"`
+}
+
+var (
+	instagramRegex = regexp.MustCompile(`^[A-Za-z0-9._]{1,30}$`)
+	githubRegex    = regexp.MustCompile(`^[A-Za-z0-9](?:[A-Za-z0-9]|-[A-Za-z0-9]){0,38}$`)
+	twitterRegex   = regexp.MustCompile(`^[A-Za-z0-9_]{1,15}$`)
+)
+
+func socialHandle(regex *regexp.Regexp) validator.Func {
+	return func(fl validator.FieldLevel) bool {
+		handle, ok := fl.Field().Interface().(string)
+		if ok && handle != "" {
+			return regex.MatchString(strings.TrimPrefix(handle, "@"))
+		}
+		return true
+	}
+}
+
+var isInstagram = socialHandle(instagramRegex)
+var isGithub = socialHandle(githubRegex)
+var isTwitter = socialHandle(twitterRegex)
+
+var isEntryYear validator.Func = func(fl validator.FieldLevel) bool {
+	year, ok := fl.Field().Interface().(int)
+	if ok && year != 0 {
+		// Year the university was founded
+		return year >= 1849 && year <= time.Now().Year()
+	}
+	return true
+}
+
+var isWebsite validator.Func = func(fl validator.FieldLevel) bool {
+	website, ok := fl.Field().Interface().(string)
+	if ok && website != "" {
+		u, err := url.Parse(website)
+		if err != nil {
+			return false
+		}
+		return (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+	}
+	return true
 }
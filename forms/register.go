@@ -12,5 +12,12 @@ func Init() {
 		v.RegisterValidation("isLinkType", isLinkType)
 		v.RegisterValidation("isMongoId", isMongoId)
 		v.RegisterValidation("isReaction", isReaction)
+		v.RegisterValidation("isInstagram", isInstagram)
+		v.RegisterValidation("isGithub", isGithub)
+		v.RegisterValidation("isTwitter", isTwitter)
+		v.RegisterValidation("isEntryYear", isEntryYear)
+		v.RegisterValidation("isWebsite", isWebsite)
+		v.RegisterValidation("isSnapshotTag", isSnapshotTag)
+		v.RegisterValidation("isElementName", isElementName)
 	}
 }
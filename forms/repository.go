@@ -13,7 +13,16 @@ type RepositoryForm struct {
 	Access      string `json:"access" binding:"required,isValidAccess"`
 }
 
+type ForkRepositoryForm struct {
+	Name string `form:"name" binding:"omitempty,max=100,isRepositoryName"`
+}
+
+type TransferRepositoryForm struct {
+	Username string `json:"username" binding:"required,max=100"`
+}
+
 type UpdateRepositoryForm struct {
+	Name         string   `json:"name" binding:"omitempty,max=100,isRepositoryName"`
 	Description  string   `json:"description" binding:"max=300"`
 	Content      string   `json:"content"`
 	Access       string   `json:"access" binding:"isValidAccess"`
@@ -0,0 +1,22 @@
+package forms
+
+import (
+	"regexp"
+
+	"github.com/go-playground/validator/v10"
+)
+
+type SnapshotForm struct {
+	Tag   string `json:"tag" binding:"required,max=50,isSnapshotTag"`
+	Notes string `json:"notes" binding:"max=5000"`
+}
+
+var snapshotTagRegex = regexp.MustCompile(`^[0-9A-Za-z][0-9A-Za-z._-]*$`)
+
+var isSnapshotTag validator.Func = func(fl validator.FieldLevel) bool {
+	tag, ok := fl.Field().Interface().(string)
+	if ok {
+		return snapshotTagRegex.MatchString(tag)
+	}
+	return true
+}
@@ -1,6 +1,32 @@
 package forms
 
+import (
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
 type SystemFileForm struct {
-	Name        string `form:"name" binding:"max=100"`
+	Name        string `form:"name" binding:"omitempty,max=100,isElementName"`
 	IsDirectory *bool  `form:"is_directory" binding:"required"`
 }
+
+type DownloadForm struct {
+	Format string `form:"format" binding:"omitempty,oneof=zip tar.gz"`
+}
+
+// A nil parent keeps the element in its folder, an empty one moves it to
+// the root of the repository
+type MoveElementForm struct {
+	Name   string  `json:"name" binding:"omitempty,max=100,isElementName"`
+	Parent *string `json:"parent"`
+}
+
+// isElementName keeps names reachable by their path
+var isElementName validator.Func = func(fl validator.FieldLevel) bool {
+	name, ok := fl.Field().Interface().(string)
+	if ok {
+		return name != "." && name != ".." && !strings.ContainsAny(name, "/\\")
+	}
+	return true
+}
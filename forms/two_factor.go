@@ -0,0 +1,15 @@
+package forms
+
+type TwoFactorCodeForm struct {
+	Code string `json:"code" binding:"required,max=20"`
+}
+
+type TwoFactorDisableForm struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code" binding:"required,max=20"`
+}
+
+type TwoFactorLoginForm struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	Code           string `json:"code" binding:"required,max=20"`
+}
@@ -15,7 +15,8 @@ var (
 
 // Services
 var (
-	systemFileService = services.NewSystemFileService()
+	storedFileService = services.NewStoredFileService()
+	uploadService     = services.NewUploadService()
 )
 
 // Settings
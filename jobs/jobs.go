@@ -2,13 +2,10 @@ package jobs
 
 import (
 	"context"
-	"io/fs"
 	"log"
-	"os"
 	"time"
 
 	"github.com/CPU-commits/USACH.dev-Server/db"
-	"github.com/CPU-commits/USACH.dev-Server/utils"
 	"github.com/robfig/cron/v3"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -44,35 +41,40 @@ func Init() {
 			log.Printf("No se completó exitosamente el job Delete expired tokens")
 		}
 	})
+	// Count references of files stored before, without the counts the
+	// job would delete files in use
+	if err := storedFileService.Backfill(); err != nil {
+		panic(err)
+	}
 	// Delete unref files
 	jobService.NewJob("0 3 * * *", func() {
-		entries, err := os.ReadDir(settingsData.MEDIA_FOLDER)
+		names, err := storedFileService.GetUnref()
 		if err != nil {
 			log.Println("1. No se completó exitosamente el job Delete unref files")
+			return
 		}
 		// Delete
 		var sem = semaphore.NewWeighted(int64(10))
 		ctx := context.Background()
 
-		for _, file := range entries {
+		for _, name := range names {
 			if err := sem.Acquire(ctx, 1); err != nil {
 				log.Println("2. No se completó exitosamente el job Delete unref files")
 				break
 			}
-			go func(file fs.DirEntry) {
-				if !file.IsDir() {
-					hasRef, err := systemFileService.FileHasRef(file.Name())
-					if err != nil {
-						log.Println("3. No se completó exitosamente el job Delete unref files")
-						return
-					}
-					if !hasRef {
-						utils.DeleteFile(file.Name())
-					}
-				}
+			go func(name string) {
+				defer sem.Release(1)
 
-				sem.Release(1)
-			}(file)
+				if err := storedFileService.DeleteStoredFile(name); err != nil {
+					log.Println("3. No se completó exitosamente el job Delete unref files")
+				}
+			}(name)
+		}
+	})
+	// Delete abandoned uploads
+	jobService.NewJob("30 * * * *", func() {
+		if err := uploadService.DeleteExpired(); err != nil {
+			log.Println("No se completó exitosamente el job Delete expired uploads")
 		}
 	})
 }
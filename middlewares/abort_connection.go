@@ -0,0 +1,22 @@
+package middlewares
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+const ABORT_CONNECTION_KEY = "ABORT_CONNECTION"
+
+// AbortConnection closes the connection of a response that failed after
+// it was started, so the client does not take it as complete. It must
+// go before the recoveries, as net/http has to get the panic
+func AbortConnection() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.Next()
+
+		if ctx.GetBool(ABORT_CONNECTION_KEY) {
+			panic(http.ErrAbortHandler)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package middlewares
+
+import (
+	"github.com/CPU-commits/USACH.dev-Server/res"
+	"github.com/CPU-commits/USACH.dev-Server/services"
+	"github.com/gin-gonic/gin"
+)
+
+// AdminMiddleware must run after RolesMiddleware, it checks the role against
+// the database and that the admin has two factor enabled
+func AdminMiddleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		claims, _ := services.NewClaimsFromContext(ctx)
+		if errRes := adminService.CanModerate(claims.UserID); errRes != nil {
+			ctx.AbortWithStatusJSON(errRes.StatusCode, res.Response{
+				Message: errRes.Err.Error(),
+			})
+			return
+		}
+		ctx.Next()
+	}
+}
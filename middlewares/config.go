@@ -4,5 +4,8 @@ import "github.com/CPU-commits/USACH.dev-Server/services"
 
 // Services
 var (
-	repoService = services.NewRepositoryService()
+	repoService                = services.NewRepositoryService()
+	sessionService             = services.NewSessionService()
+	personalAccessTokenService = services.NewPersonalAccessTokenService()
+	adminService               = services.NewAdminService()
 )
@@ -36,6 +36,23 @@ func JWTMiddleware(isPublic bool) gin.HandlerFunc {
 			})
 			return
 		}
+		// Revoked sessions
+		isActive, err := sessionService.IsActive(metadata.ID)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusServiceUnavailable, res.Response{
+				Message: err.Error(),
+			})
+			return
+		}
+		if !isActive && isPublic {
+			ctx.Next()
+			return
+		} else if !isActive {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, res.Response{
+				Message: "Unauthorized",
+			})
+			return
+		}
 		ctx.Set("user", metadata)
 		ctx.Next()
 	}
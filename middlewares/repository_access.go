@@ -2,7 +2,10 @@ package middlewares
 
 import (
 	"net/http"
+	"net/url"
+	"strings"
 
+	"github.com/CPU-commits/USACH.dev-Server/models"
 	"github.com/CPU-commits/USACH.dev-Server/res"
 	"github.com/CPU-commits/USACH.dev-Server/services"
 	"github.com/gin-gonic/gin"
@@ -12,22 +15,31 @@ import (
 func RepoAccess(maybe bool) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		var idRepository string
+		var currentPath *models.RepositoryPath
 
 		username := ctx.Param("username")
 		repository := ctx.Param("repository")
-		if ctx.DefaultQuery("repository", "") != "" {
-			idRepository = ctx.Query("repository")
-		} else if username != "" {
-			idObjRepository, errRes := repoService.GetRepositoryId(username, repository)
+		if username != "" {
+			idObjRepository, path, errRes := repoService.ResolveRepository(
+				username,
+				repository,
+			)
 			if errRes != nil {
+				ctx.AbortWithStatusJSON(errRes.StatusCode, &res.Response{
+					Message: errRes.Err.Error(),
+				})
 				return
 			}
 			idRepository = idObjRepository.Hex()
-		} else {
+			currentPath = path
+		} else if repository != "" {
 			idRepository = repository
+		} else {
+			// Only routes without the repository take it from the query
+			idRepository = ctx.Query("repository")
 		}
 		// Maybe = true
-		if maybe && repository == "" {
+		if maybe && idRepository == "" {
 			ctx.Next()
 			return
 		}
@@ -58,6 +70,46 @@ func RepoAccess(maybe bool) gin.HandlerFunc {
 			})
 			return
 		}
+		// Old path, only revealed to users with access
+		if currentPath != nil {
+			redirectRepository(ctx, currentPath)
+			return
+		}
 		ctx.Next()
 	}
 }
+
+// redirectRepository answers with a permanent redirect to the same route
+// under the current username and name of the repository
+func redirectRepository(ctx *gin.Context, path *models.RepositoryPath) {
+	location := ctx.FullPath()
+	for _, param := range ctx.Params {
+		value := param.Value
+		switch param.Key {
+		case "username":
+			value = path.Username
+		case "repository":
+			value = path.Name
+		}
+		location = strings.Replace(location, ":"+param.Key, url.PathEscape(value), 1)
+		// Catch all values start with a slash and keep them
+		location = strings.Replace(
+			location,
+			"/*"+param.Key,
+			(&url.URL{Path: value}).EscapedPath(),
+			1,
+		)
+	}
+	if ctx.Request.URL.RawQuery != "" {
+		location += "?" + ctx.Request.URL.RawQuery
+	}
+
+	ctx.Header("Location", location)
+	ctx.AbortWithStatusJSON(http.StatusPermanentRedirect, &res.Response{
+		Message: "el repositorio cambió de nombre o de dueño",
+		Data: map[string]interface{}{
+			"username": path.Username,
+			"name":     path.Name,
+		},
+	})
+}
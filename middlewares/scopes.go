@@ -0,0 +1,29 @@
+package middlewares
+
+import (
+	"github.com/CPU-commits/USACH.dev-Server/res"
+	"github.com/CPU-commits/USACH.dev-Server/services"
+	"github.com/gin-gonic/gin"
+)
+
+// ScopedJWTMiddleware works as JWTMiddleware but also accepts personal
+// access tokens that were granted scope
+func ScopedJWTMiddleware(isPublic bool, scope string) gin.HandlerFunc {
+	jwtMiddleware := JWTMiddleware(isPublic)
+
+	return func(ctx *gin.Context) {
+		if !services.IsPersonalAccessToken(ctx.Request) {
+			jwtMiddleware(ctx)
+			return
+		}
+		claims, errRes := personalAccessTokenService.Authenticate(ctx.Request, scope)
+		if errRes != nil {
+			ctx.AbortWithStatusJSON(errRes.StatusCode, res.Response{
+				Message: errRes.Err.Error(),
+			})
+			return
+		}
+		ctx.Set("user", claims)
+		ctx.Next()
+	}
+}
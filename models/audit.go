@@ -0,0 +1,137 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const AUDIT_COLLECTION = "audits"
+
+// Audit actions
+const (
+	AUDIT_SUSPEND_USER      = "suspend_user"
+	AUDIT_REACTIVATE_USER   = "reactivate_user"
+	AUDIT_CHANGE_ROLE       = "change_role"
+	AUDIT_DELETE_REPOSITORY = "delete_repository"
+	AUDIT_DELETE_DISCUSSION = "delete_discussion"
+	AUDIT_DELETE_COMMENT    = "delete_comment"
+)
+
+// Audited entities
+const (
+	AUDIT_ENTITY_USER       = "user"
+	AUDIT_ENTITY_REPOSITORY = "repository"
+	AUDIT_ENTITY_DISCUSSION = "discussion"
+	AUDIT_ENTITY_COMMENT    = "comment"
+)
+
+// Model
+type Audit struct {
+	ID         primitive.ObjectID `json:"_id" bson:"_id,omitempty"`
+	Admin      primitive.ObjectID `json:"admin" bson:"admin"`
+	Action     string             `json:"action" bson:"action"`
+	EntityType string             `json:"entity_type" bson:"entity_type"`
+	Entity     primitive.ObjectID `json:"entity" bson:"entity"`
+	Details    string             `json:"details,omitempty" bson:"details,omitempty"`
+	Date       primitive.DateTime `json:"date" bson:"date"`
+}
+
+// Responses
+type AuditRes struct {
+	ID         primitive.ObjectID `json:"_id" bson:"_id,omitempty"`
+	Admin      SimpleUser         `json:"admin" bson:"admin"`
+	Action     string             `json:"action" bson:"action"`
+	EntityType string             `json:"entity_type" bson:"entity_type"`
+	Entity     primitive.ObjectID `json:"entity" bson:"entity"`
+	Details    string             `json:"details,omitempty" bson:"details,omitempty"`
+	Date       primitive.DateTime `json:"date" bson:"date"`
+}
+
+type AuditModel struct{}
+
+func (*AuditModel) Use() *mongo.Collection {
+	return DbConnect.GetCollection(AUDIT_COLLECTION)
+}
+
+func (*AuditModel) NewModel(
+	idAdmin primitive.ObjectID,
+	action,
+	entityType string,
+	entity primitive.ObjectID,
+	details string,
+) *Audit {
+	return &Audit{
+		Admin:      idAdmin,
+		Action:     action,
+		EntityType: entityType,
+		Entity:     entity,
+		Details:    details,
+		Date:       primitive.NewDateTimeFromTime(time.Now()),
+	}
+}
+
+func init() {
+	collections, errC := DbConnect.GetCollections()
+	if errC != nil {
+		panic(errC)
+	}
+	for _, collection := range collections {
+		if collection == AUDIT_COLLECTION {
+			return
+		}
+	}
+	var jsonSchema = bson.M{
+		"bsonType": "object",
+		"required": []string{
+			"admin",
+			"action",
+			"entity_type",
+			"entity",
+			"date",
+		},
+		"properties": bson.M{
+			"admin": bson.M{"bsonType": "objectId"},
+			"action": bson.M{
+				"bsonType": "string",
+				"enum": bson.A{
+					AUDIT_SUSPEND_USER,
+					AUDIT_REACTIVATE_USER,
+					AUDIT_CHANGE_ROLE,
+					AUDIT_DELETE_REPOSITORY,
+					AUDIT_DELETE_DISCUSSION,
+					AUDIT_DELETE_COMMENT,
+				},
+			},
+			"entity_type": bson.M{
+				"bsonType": "string",
+				"enum": bson.A{
+					AUDIT_ENTITY_USER,
+					AUDIT_ENTITY_REPOSITORY,
+					AUDIT_ENTITY_DISCUSSION,
+					AUDIT_ENTITY_COMMENT,
+				},
+			},
+			"entity":  bson.M{"bsonType": "objectId"},
+			"details": bson.M{"bsonType": "string"},
+			"date":    bson.M{"bsonType": "date"},
+		},
+	}
+	var validators = bson.M{
+		"$jsonSchema": jsonSchema,
+	}
+	opts := &options.CreateCollectionOptions{
+		Validator: validators,
+	}
+	err := DbConnect.CreateCollection(AUDIT_COLLECTION, opts)
+	if err != nil {
+		panic(err)
+	}
+}
+
+func NewAuditModel() *AuditModel {
+	return &AuditModel{}
+}
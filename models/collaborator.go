@@ -0,0 +1,157 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"github.com/CPU-commits/USACH.dev-Server/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const COLLABORATOR_COLLECTION = "collaborators"
+
+// Collaborator roles
+const (
+	COLLABORATOR_READ  = "read"
+	COLLABORATOR_WRITE = "write"
+	COLLABORATOR_ADMIN = "admin"
+	// Only used to check permissions, the owner is not a collaborator
+	COLLABORATOR_OWNER = "owner"
+)
+
+// Collaborator status
+const (
+	COLLABORATOR_PENDING  = "pending"
+	COLLABORATOR_ACCEPTED = "accepted"
+)
+
+// Model
+type Collaborator struct {
+	ID         primitive.ObjectID `json:"_id" bson:"_id,omitempty"`
+	Repository primitive.ObjectID `json:"repository" bson:"repository"`
+	User       primitive.ObjectID `json:"user" bson:"user"`
+	Role       string             `json:"role" bson:"role"`
+	Status     string             `json:"status" bson:"status"`
+	InvitedBy  primitive.ObjectID `json:"invited_by" bson:"invited_by"`
+	Date       primitive.DateTime `json:"date" bson:"date"`
+}
+
+// Responses
+type CollaboratorRes struct {
+	ID         primitive.ObjectID `json:"_id" bson:"_id"`
+	Repository primitive.ObjectID `json:"repository" bson:"repository"`
+	User       SimpleUser         `json:"user" bson:"user"`
+	Role       string             `json:"role" bson:"role"`
+	Status     string             `json:"status" bson:"status"`
+	Date       primitive.DateTime `json:"date" bson:"date"`
+}
+
+type InvitationRes struct {
+	ID         primitive.ObjectID `json:"_id" bson:"_id"`
+	Repository UpstreamRes        `json:"repository" bson:"repository"`
+	InvitedBy  SimpleUser         `json:"invited_by" bson:"invited_by"`
+	Role       string             `json:"role" bson:"role"`
+	Date       primitive.DateTime `json:"date" bson:"date"`
+}
+
+type CollaboratorModel struct{}
+
+func (*CollaboratorModel) Use() *mongo.Collection {
+	return DbConnect.GetCollection(COLLABORATOR_COLLECTION)
+}
+
+func (c *CollaboratorModel) Exists(filter bson.D) (bool, error) {
+	var collaborator *Collaborator
+
+	options := options.FindOne().SetProjection(bson.D{{
+		Key:   "_id",
+		Value: 1,
+	}})
+	cursor := c.Use().FindOne(db.Ctx, filter, options)
+
+	if err := cursor.Decode(&collaborator); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (*CollaboratorModel) NewModel(
+	idRepository,
+	idUser,
+	idInvitedBy primitive.ObjectID,
+	role string,
+) *Collaborator {
+	return &Collaborator{
+		Repository: idRepository,
+		User:       idUser,
+		Role:       role,
+		Status:     COLLABORATOR_PENDING,
+		InvitedBy:  idInvitedBy,
+		Date:       primitive.NewDateTimeFromTime(time.Now()),
+	}
+}
+
+func init() {
+	collections, errC := DbConnect.GetCollections()
+	if errC != nil {
+		panic(errC)
+	}
+	for _, collection := range collections {
+		if collection == COLLABORATOR_COLLECTION {
+			return
+		}
+	}
+	var jsonSchema = bson.M{
+		"bsonType": "object",
+		"required": []string{
+			"repository",
+			"user",
+			"role",
+			"status",
+			"invited_by",
+			"date",
+		},
+		"properties": bson.M{
+			"repository": bson.M{"bsonType": "objectId"},
+			"user":       bson.M{"bsonType": "objectId"},
+			"role": bson.M{
+				"bsonType": "string",
+				"enum": bson.A{
+					COLLABORATOR_READ,
+					COLLABORATOR_WRITE,
+					COLLABORATOR_ADMIN,
+				},
+			},
+			"status": bson.M{
+				"bsonType": "string",
+				"enum": bson.A{
+					COLLABORATOR_PENDING,
+					COLLABORATOR_ACCEPTED,
+				},
+			},
+			"invited_by": bson.M{"bsonType": "objectId"},
+			"date":       bson.M{"bsonType": "date"},
+		},
+	}
+	var validators = bson.M{
+		"$jsonSchema": jsonSchema,
+	}
+	opts := &options.CreateCollectionOptions{
+		Validator: validators,
+	}
+	err := DbConnect.CreateCollection(COLLABORATOR_COLLECTION, opts)
+	if err != nil {
+		panic(err)
+	}
+}
+
+func NewCollaboratorModel() *CollaboratorModel {
+	return &CollaboratorModel{}
+}
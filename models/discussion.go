@@ -2,12 +2,10 @@ package models
 
 import (
 	"errors"
-	"mime/multipart"
 	"time"
 
 	"github.com/CPU-commits/USACH.dev-Server/db"
 	"github.com/CPU-commits/USACH.dev-Server/forms"
-	"github.com/CPU-commits/USACH.dev-Server/utils"
 	"github.com/thanhpk/randstr"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -55,8 +53,8 @@ type DiscussionModel struct{}
 func (*DiscussionModel) NewModel(
 	discussion *forms.DiscussionForm,
 	idUser primitive.ObjectID,
-	image *multipart.FileHeader,
-) (*Discussion, error) {
+	image string,
+) *Discussion {
 	now := primitive.NewDateTimeFromTime(time.Now())
 	discussionModel := &Discussion{
 		Title:     discussion.Title,
@@ -72,15 +70,11 @@ func (*DiscussionModel) NewModel(
 		idObjRepository, _ := primitive.ObjectIDFromHex(discussion.Repository)
 		discussionModel.Repository = idObjRepository
 	}
-	if image != nil {
-		route, err := utils.UploadFile(image)
-		if err != nil {
-			return nil, err
-		}
-		discussionModel.Image = route
+	if image != "" {
+		discussionModel.Image = image
 	}
 
-	return discussionModel, nil
+	return discussionModel
 }
 
 func (d *DiscussionModel) Exists(filter bson.D) (bool, error) {
@@ -1,6 +1,8 @@
 package models
 
 import (
+	"time"
+
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -11,18 +13,47 @@ const FOLLOWS_COLLECTION = "follows"
 
 // Model
 type Follows struct {
-	ID           primitive.ObjectID `json:"_id" bson:"_id"`
+	ID           primitive.ObjectID `json:"_id" bson:"_id,omitempty"`
 	FollowedUser primitive.ObjectID `json:"followed_user" bson:"followed_user"`
 	FollowerUser primitive.ObjectID `json:"follower_user" bson:"follower_user"`
 	Date         primitive.DateTime `json:"date" bson:"date"`
 }
 
+// Feed item types
+const (
+	FEED_REPOSITORY = "repository"
+	FEED_DISCUSSION = "discussion"
+	FEED_COMMENT    = "comment"
+)
+
+// Responses
+type FeedItem struct {
+	ID         primitive.ObjectID  `json:"_id" bson:"_id"`
+	Type       string              `json:"type" bson:"type"`
+	Actor      SimpleUser          `json:"actor" bson:"actor"`
+	Title      string              `json:"title" bson:"title"`
+	Text       string              `json:"text,omitempty" bson:"text,omitempty"`
+	Discussion *primitive.ObjectID `json:"discussion,omitempty" bson:"discussion,omitempty"`
+	Date       primitive.DateTime  `json:"date" bson:"date"`
+}
+
 type FollowsModel struct{}
 
 func (follow *FollowsModel) Use() *mongo.Collection {
 	return DbConnect.GetCollection(FOLLOWS_COLLECTION)
 }
 
+func (*FollowsModel) NewModel(
+	followedUser,
+	followerUser primitive.ObjectID,
+) *Follows {
+	return &Follows{
+		FollowedUser: followedUser,
+		FollowerUser: followerUser,
+		Date:         primitive.NewDateTimeFromTime(time.Now()),
+	}
+}
+
 func init() {
 	collections, errC := DbConnect.GetCollections()
 	if errC != nil {
@@ -57,3 +88,7 @@ func init() {
 		panic(err)
 	}
 }
+
+func NewFollowsModel() *FollowsModel {
+	return &FollowsModel{}
+}
@@ -0,0 +1,93 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"github.com/CPU-commits/USACH.dev-Server/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const MIGRATION_COLLECTION = "migrations"
+
+// Migrations
+const (
+	// References of the files stored before reference counts existed
+	MIGRATION_STORED_FILE_REFS = "stored_file_refs"
+)
+
+// Model
+// Marks a change of the data that was completed, so it runs once
+type Migration struct {
+	Name string             `json:"name" bson:"_id"`
+	Date primitive.DateTime `json:"date" bson:"date"`
+}
+
+type MigrationModel struct{}
+
+func (*MigrationModel) Use() *mongo.Collection {
+	return DbConnect.GetCollection(MIGRATION_COLLECTION)
+}
+
+func (m *MigrationModel) Exists(filter bson.D) (bool, error) {
+	var migration *Migration
+
+	options := options.FindOne().SetProjection(bson.D{{
+		Key:   "_id",
+		Value: 1,
+	}})
+	cursor := m.Use().FindOne(db.Ctx, filter, options)
+
+	if err := cursor.Decode(&migration); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (*MigrationModel) NewModel(name string) *Migration {
+	return &Migration{
+		Name: name,
+		Date: primitive.NewDateTimeFromTime(time.Now()),
+	}
+}
+
+func init() {
+	collections, errC := DbConnect.GetCollections()
+	if errC != nil {
+		panic(errC)
+	}
+	for _, collection := range collections {
+		if collection == MIGRATION_COLLECTION {
+			return
+		}
+	}
+	var jsonSchema = bson.M{
+		"bsonType": "object",
+		"required": []string{"_id", "date"},
+		"properties": bson.M{
+			"_id":  bson.M{"bsonType": "string"},
+			"date": bson.M{"bsonType": "date"},
+		},
+	}
+	var validators = bson.M{
+		"$jsonSchema": jsonSchema,
+	}
+	opts := &options.CreateCollectionOptions{
+		Validator: validators,
+	}
+	err := DbConnect.CreateCollection(MIGRATION_COLLECTION, opts)
+	if err != nil {
+		panic(err)
+	}
+}
+
+func NewMigrationModel() *MigrationModel {
+	return &MigrationModel{}
+}
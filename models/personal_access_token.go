@@ -0,0 +1,138 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const PERSONAL_ACCESS_TOKEN_COLLECTION = "personal_access_tokens"
+
+// Every personal access token starts with this prefix
+const PERSONAL_ACCESS_TOKEN_PREFIX = "udt_"
+
+// Scopes
+const (
+	SCOPE_REPO_READ        = "repo:read"
+	SCOPE_REPO_WRITE       = "repo:write"
+	SCOPE_DISCUSSION_WRITE = "discussion:write"
+)
+
+// Scopes a token can be given
+var TOKEN_SCOPES = []string{
+	SCOPE_REPO_READ,
+	SCOPE_REPO_WRITE,
+	SCOPE_DISCUSSION_WRITE,
+}
+
+// Model
+type PersonalAccessToken struct {
+	ID         primitive.ObjectID `json:"_id" bson:"_id,omitempty"`
+	User       primitive.ObjectID `json:"user" bson:"user"`
+	Name       string             `json:"name" bson:"name"`
+	Token      string             `json:"-" bson:"token"`
+	Hint       string             `json:"hint" bson:"hint"`
+	Scopes     []string           `json:"scopes" bson:"scopes"`
+	ExpiresAt  primitive.DateTime `json:"expires_at" bson:"expires_at"`
+	LastUsedAt primitive.DateTime `json:"last_used_at,omitempty" bson:"last_used_at,omitempty"`
+	CreatedAt  primitive.DateTime `json:"created_at" bson:"created_at"`
+}
+
+type PersonalAccessTokenModel struct{}
+
+func (*PersonalAccessTokenModel) Use() *mongo.Collection {
+	return DbConnect.GetCollection(PERSONAL_ACCESS_TOKEN_COLLECTION)
+}
+
+func (*PersonalAccessTokenModel) HashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+// NewModel returns the model to store and the plain token, which is only
+// shown once
+func (pM *PersonalAccessTokenModel) NewModel(
+	idUser primitive.ObjectID,
+	name string,
+	scopes []string,
+	expiresAt time.Time,
+) (*PersonalAccessToken, string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return nil, "", err
+	}
+	token := PERSONAL_ACCESS_TOKEN_PREFIX + hex.EncodeToString(b)
+
+	return &PersonalAccessToken{
+		User:      idUser,
+		Name:      name,
+		Token:     pM.HashToken(token),
+		Hint:      token[len(token)-4:],
+		Scopes:    scopes,
+		ExpiresAt: primitive.NewDateTimeFromTime(expiresAt),
+		CreatedAt: primitive.NewDateTimeFromTime(time.Now()),
+	}, token, nil
+}
+
+func init() {
+	collections, errC := DbConnect.GetCollections()
+	if errC != nil {
+		panic(errC)
+	}
+	for _, collection := range collections {
+		if collection == PERSONAL_ACCESS_TOKEN_COLLECTION {
+			return
+		}
+	}
+	var jsonSchema = bson.M{
+		"bsonType": "object",
+		"required": []string{
+			"user",
+			"name",
+			"token",
+			"hint",
+			"scopes",
+			"expires_at",
+			"created_at",
+		},
+		"properties": bson.M{
+			"user": bson.M{"bsonType": "objectId"},
+			"name": bson.M{
+				"bsonType":  "string",
+				"maxLength": 100,
+			},
+			"token": bson.M{"bsonType": "string"},
+			"hint":  bson.M{"bsonType": "string"},
+			"scopes": bson.M{
+				"bsonType": "array",
+				"items": bson.M{
+					"bsonType": "string",
+					"enum":     TOKEN_SCOPES,
+				},
+			},
+			"expires_at":   bson.M{"bsonType": "date"},
+			"last_used_at": bson.M{"bsonType": "date"},
+			"created_at":   bson.M{"bsonType": "date"},
+		},
+	}
+	var validators = bson.M{
+		"$jsonSchema": jsonSchema,
+	}
+	opts := &options.CreateCollectionOptions{
+		Validator: validators,
+	}
+	err := DbConnect.CreateCollection(PERSONAL_ACCESS_TOKEN_COLLECTION, opts)
+	if err != nil {
+		panic(err)
+	}
+}
+
+func NewPersonalAccessTokenModel() *PersonalAccessTokenModel {
+	return &PersonalAccessTokenModel{}
+}
@@ -14,6 +14,9 @@ import (
 
 const PROFILE_COLLECTION = "profiles"
 
+// Avatar thumbnails, in pixels
+var AVATAR_SIZES = []int{48, 128, 512}
+
 // Model
 // Media
 type Media struct {
@@ -23,12 +26,41 @@ type Media struct {
 }
 
 type Profile struct {
-	ID          primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
-	User        primitive.ObjectID `json:"user" bson:"user"`
-	Avatar      string             `json:"avatar,omitempty" bson:"avatar,omitempty"`
-	Media       *Media             `json:"media,omitempty" bson:"media,omitempty"`
+	ID          primitive.ObjectID   `json:"_id,omitempty" bson:"_id,omitempty"`
+	User        primitive.ObjectID   `json:"user" bson:"user"`
+	Avatar      string               `json:"avatar,omitempty" bson:"avatar,omitempty"`
+	AvatarSizes []int                `json:"avatar_sizes,omitempty" bson:"avatar_sizes,omitempty"`
+	Media       *Media               `json:"media,omitempty" bson:"media,omitempty"`
+	Description string               `json:"description,omitempty" bson:"description,omitempty"`
+	Career      string               `json:"career,omitempty" bson:"career,omitempty"`
+	EntryYear   int                  `json:"entry_year,omitempty" bson:"entry_year,omitempty"`
+	Website     string               `json:"website,omitempty" bson:"website,omitempty"`
+	Pinned      []primitive.ObjectID `json:"pinned,omitempty" bson:"pinned,omitempty"`
+	Date        primitive.DateTime   `json:"date" bson:"date"`
+}
+
+// Responses
+// Pinned repository
+type PinnedRepository struct {
+	ID          primitive.ObjectID `json:"_id" bson:"_id"`
+	Name        string             `json:"name" bson:"name"`
 	Description string             `json:"description,omitempty" bson:"description,omitempty"`
-	Date        primitive.DateTime `json:"date" bson:"date"`
+	Stars       int                `json:"stars" bson:"stars"`
+	Tags        []string           `json:"tags,omitempty" bson:"tags,omitempty"`
+}
+
+type ProfileRes struct {
+	ID          primitive.ObjectID  `json:"_id,omitempty" bson:"_id,omitempty"`
+	User        primitive.ObjectID  `json:"user" bson:"user"`
+	Avatar      string              `json:"avatar,omitempty" bson:"avatar,omitempty"`
+	AvatarSizes []int               `json:"avatar_sizes,omitempty" bson:"avatar_sizes,omitempty"`
+	Media       *Media              `json:"media,omitempty" bson:"media,omitempty"`
+	Description string              `json:"description,omitempty" bson:"description,omitempty"`
+	Career      string              `json:"career,omitempty" bson:"career,omitempty"`
+	EntryYear   int                 `json:"entry_year,omitempty" bson:"entry_year,omitempty"`
+	Website     string              `json:"website,omitempty" bson:"website,omitempty"`
+	Pinned      []*PinnedRepository `json:"pinned,omitempty" bson:"pinned,omitempty"`
+	Date        primitive.DateTime  `json:"date" bson:"date"`
 }
 
 type ProfileModel struct{}
@@ -76,11 +108,6 @@ func init() {
 	if errC != nil {
 		panic(errC)
 	}
-	for _, collection := range collections {
-		if collection == PROFILE_COLLECTION {
-			return
-		}
-	}
 	var jsonSchema = bson.M{
 		"bsonType": "object",
 		"required": []string{
@@ -96,6 +123,10 @@ func init() {
 			"avatar": bson.M{
 				"bsonType": "string",
 			},
+			"avatar_sizes": bson.M{
+				"bsonType": "array",
+				"items":    bson.M{"bsonType": "int"},
+			},
 			"media": bson.M{
 				"bsonType": "object",
 				"properties": bson.M{
@@ -113,12 +144,38 @@ func init() {
 					},
 				},
 			},
+			"career": bson.M{
+				"bsonType":  "string",
+				"maxLength": 100,
+			},
+			"entry_year": bson.M{"bsonType": "int"},
+			"website": bson.M{
+				"bsonType":  "string",
+				"maxLength": 200,
+			},
+			"pinned": bson.M{
+				"bsonType": "array",
+				"maxItems": 6,
+				"items":    bson.M{"bsonType": "objectId"},
+			},
 			"date": bson.M{"bsonType": "date"},
 		},
 	}
 	var validators = bson.M{
 		"$jsonSchema": jsonSchema,
 	}
+	for _, collection := range collections {
+		if collection == PROFILE_COLLECTION {
+			err := DbConnect.UpdateCollection(PROFILE_COLLECTION, bson.D{{
+				Key:   "validator",
+				Value: validators,
+			}})
+			if err != nil {
+				panic(err)
+			}
+			return
+		}
+	}
 	opts := &options.CreateCollectionOptions{
 		Validator: validators,
 	}
@@ -23,6 +23,18 @@ type Link struct {
 	Link  string             `json:"link" bson:"link"`
 }
 
+// Old owner/name a repository is still reachable from
+type RepositoryRedirect struct {
+	Owner primitive.ObjectID `json:"owner" bson:"owner"`
+	Name  string             `json:"name" bson:"name"`
+	Date  primitive.DateTime `json:"date" bson:"date"`
+}
+
+type RepositoryPath struct {
+	Username string `json:"username"`
+	Name     string `json:"name"`
+}
+
 // Repository
 type Repository struct {
 	ID           primitive.ObjectID   `json:"_id" bson:"_id,omitempty"`
@@ -38,11 +50,20 @@ type Repository struct {
 	Links        []Link               `json:"links" bson:"links,omitempty"`
 	Downloads    int                  `json:"downloads" bson:"downloads"`
 	CustomAccess []primitive.ObjectID `json:"custom_access,omitempty" bson:"custom_access,omitempty"`
+	Upstream     primitive.ObjectID   `json:"upstream,omitempty" bson:"upstream,omitempty"`
+	Redirects    []RepositoryRedirect `json:"-" bson:"redirects,omitempty"`
 	UpdatedDate  primitive.DateTime   `json:"updated_date" bson:"updated_date"`
 	CreatedDate  primitive.DateTime   `json:"created_date" bson:"created_date"`
 }
 
 // Responses
+// Repository a fork was made from
+type UpstreamRes struct {
+	ID    primitive.ObjectID `json:"_id" bson:"_id"`
+	Name  string             `json:"name" bson:"name"`
+	Owner SimpleUser         `json:"owner" bson:"owner"`
+}
+
 type RepositoryRes struct {
 	ID           primitive.ObjectID   `json:"_id" bson:"_id,omitempty"`
 	Owner        SimpleUser           `json:"owner" bson:"owner"`
@@ -56,6 +77,9 @@ type RepositoryRes struct {
 	Links        []*Link              `json:"links,omitempty" bson:"links,omitempty"`
 	Downloads    int                  `json:"downloads" bson:"downloads"`
 	CustomAccess []primitive.ObjectID `json:"custom_access,omitempty" bson:"custom_access,omitempty"`
+	Upstream     *UpstreamRes         `json:"upstream,omitempty" bson:"upstream_repository,omitempty"`
+	Forks        int64                `json:"forks" bson:"-"`
+	Snapshots    []SnapshotRes        `json:"snapshots,omitempty" bson:"snapshots,omitempty"`
 	UpdatedDate  primitive.DateTime   `json:"updated_date" bson:"updated_date"`
 	CreatedDate  primitive.DateTime   `json:"created_date" bson:"created_date"`
 	Tags         []string             `json:"tags" bson:"tags"`
@@ -104,6 +128,17 @@ func (r *RepositoryModel) NewModel(
 	}
 }
 
+func (r *RepositoryModel) NewRedirectModel(
+	owner primitive.ObjectID,
+	name string,
+) *RepositoryRedirect {
+	return &RepositoryRedirect{
+		Owner: owner,
+		Name:  name,
+		Date:  primitive.NewDateTimeFromTime(time.Now()),
+	}
+}
+
 func (r *RepositoryModel) NewLinkModel(link *forms.LinkForm) *Link {
 	return &Link{
 		Type:  link.Type,
@@ -198,7 +233,23 @@ func init() {
 					"bsonType": "objectId",
 				},
 			},
+			"upstream":     bson.M{"bsonType": "objectId"},
 			"created_date": bson.M{"bsonType": "date"},
+			"redirects": bson.M{
+				"bsonType": "array",
+				"items": bson.M{
+					"bsonType": "object",
+					"required": bson.A{"owner", "name", "date"},
+					"properties": bson.M{
+						"owner": bson.M{"bsonType": "objectId"},
+						"name": bson.M{
+							"bsonType":  "string",
+							"maxLength": 100,
+						},
+						"date": bson.M{"bsonType": "date"},
+					},
+				},
+			},
 		},
 	}
 	var validators = bson.M{
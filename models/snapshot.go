@@ -0,0 +1,170 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"github.com/CPU-commits/USACH.dev-Server/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const SNAPSHOT_COLLECTION = "snapshots"
+
+// Status of a file between two trees
+const (
+	FILE_ADDED    = "added"
+	FILE_REMOVED  = "removed"
+	FILE_RENAMED  = "renamed"
+	FILE_MODIFIED = "modified"
+)
+
+// Reasons a file change has no diff
+const (
+	DIFF_BINARY    = "binary"
+	DIFF_TOO_LARGE = "too_large"
+	// The diffs before it filled the response
+	DIFF_COMPARE_TOO_LARGE = "compare_too_large"
+)
+
+// Model
+// Frozen copy of a repository, the tree is copied so later edits
+// do not change it
+type Snapshot struct {
+	ID         primitive.ObjectID   `json:"_id" bson:"_id,omitempty"`
+	Repository primitive.ObjectID   `json:"repository" bson:"repository"`
+	Tag        string               `json:"tag" bson:"tag"`
+	Notes      string               `json:"notes,omitempty" bson:"notes,omitempty"`
+	Content    string               `json:"content" bson:"content"`
+	Links      []Link               `json:"links" bson:"links,omitempty"`
+	SystemFile []primitive.ObjectID `json:"system_file,omitempty" bson:"system_file,omitempty"`
+	Author     primitive.ObjectID   `json:"author" bson:"author"`
+	Date       primitive.DateTime   `json:"date" bson:"date"`
+}
+
+// Responses
+type SnapshotRes struct {
+	ID         primitive.ObjectID `json:"_id" bson:"_id"`
+	Tag        string             `json:"tag" bson:"tag"`
+	Notes      string             `json:"notes,omitempty" bson:"notes,omitempty"`
+	Content    string             `json:"content,omitempty" bson:"content,omitempty"`
+	Links      []*Link            `json:"links,omitempty" bson:"links,omitempty"`
+	SystemFile []*SystemFile      `json:"system_file,omitempty" bson:"system_file,omitempty"`
+	Author     SimpleUser         `json:"author" bson:"author"`
+	Date       primitive.DateTime `json:"date" bson:"date"`
+}
+
+type FileChange struct {
+	Status      string `json:"status"`
+	Path        string `json:"path"`
+	OldPath     string `json:"old_path,omitempty"`
+	Diff        string `json:"diff,omitempty"`
+	DiffOmitted string `json:"diff_omitted,omitempty"`
+}
+
+type CompareRes struct {
+	From  string       `json:"from"`
+	To    string       `json:"to"`
+	Files []FileChange `json:"files"`
+}
+
+type SnapshotModel struct{}
+
+func (*SnapshotModel) Use() *mongo.Collection {
+	return DbConnect.GetCollection(SNAPSHOT_COLLECTION)
+}
+
+func (s *SnapshotModel) Exists(filter bson.D) (bool, error) {
+	var snapshot *Snapshot
+
+	options := options.FindOne().SetProjection(bson.D{{
+		Key:   "_id",
+		Value: 1,
+	}})
+	cursor := s.Use().FindOne(db.Ctx, filter, options)
+
+	if err := cursor.Decode(&snapshot); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (*SnapshotModel) NewModel(
+	repository *Repository,
+	tag,
+	notes string,
+	systemFile []primitive.ObjectID,
+	author primitive.ObjectID,
+) *Snapshot {
+	return &Snapshot{
+		Repository: repository.ID,
+		Tag:        tag,
+		Notes:      notes,
+		Content:    repository.Content,
+		Links:      repository.Links,
+		SystemFile: systemFile,
+		Author:     author,
+		Date:       primitive.NewDateTimeFromTime(time.Now()),
+	}
+}
+
+func init() {
+	collections, errC := DbConnect.GetCollections()
+	if errC != nil {
+		panic(errC)
+	}
+	for _, collection := range collections {
+		if collection == SNAPSHOT_COLLECTION {
+			return
+		}
+	}
+	var jsonSchema = bson.M{
+		"bsonType": "object",
+		"required": []string{"repository", "tag", "content", "author", "date"},
+		"properties": bson.M{
+			"repository": bson.M{"bsonType": "objectId"},
+			"tag":        bson.M{"bsonType": "string", "maxLength": 50},
+			"notes":      bson.M{"bsonType": "string"},
+			"content":    bson.M{"bsonType": "string"},
+			"links": bson.M{
+				"bsonType": "array",
+				"items": bson.M{
+					"bsonType": "object",
+					"required": []string{"_id", "type", "title", "link"},
+					"properties": bson.M{
+						"_id":   bson.M{"bsonType": "objectId"},
+						"type":  bson.M{"bsonType": "string"},
+						"title": bson.M{"bsonType": "string"},
+						"link":  bson.M{"bsonType": "string"},
+					},
+				},
+			},
+			"system_file": bson.M{
+				"bsonType": "array",
+				"items":    bson.M{"bsonType": "objectId"},
+			},
+			"author": bson.M{"bsonType": "objectId"},
+			"date":   bson.M{"bsonType": "date"},
+		},
+	}
+	var validators = bson.M{
+		"$jsonSchema": jsonSchema,
+	}
+	opts := &options.CreateCollectionOptions{
+		Validator: validators,
+	}
+	err := DbConnect.CreateCollection(SNAPSHOT_COLLECTION, opts)
+	if err != nil {
+		panic(err)
+	}
+}
+
+func NewSnapshotModel() *SnapshotModel {
+	return &SnapshotModel{}
+}
@@ -0,0 +1,80 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const STORED_FILE_COLLECTION = "stored_files"
+
+// Model
+// File of the storage, shared by every element, discussion or profile
+// with the same content. The name is the SHA-256 of the content, files
+// stored before are kept by their old name
+type StoredFile struct {
+	Name string `json:"name" bson:"_id"`
+	Size int64  `json:"size" bson:"size"`
+	// Elements, discussions and profiles using the file, at zero it can
+	// be deleted
+	Refs int `json:"refs" bson:"refs"`
+	// Last change of the references
+	Date primitive.DateTime `json:"date" bson:"date"`
+	// The job is deleting the file, it can't get references
+	Deleting bool `json:"-" bson:"deleting,omitempty"`
+}
+
+type StoredFileModel struct{}
+
+func (*StoredFileModel) Use() *mongo.Collection {
+	return DbConnect.GetCollection(STORED_FILE_COLLECTION)
+}
+
+func (*StoredFileModel) NewModel(name string, size int64, refs int) *StoredFile {
+	return &StoredFile{
+		Name: name,
+		Size: size,
+		Refs: refs,
+		Date: primitive.NewDateTimeFromTime(time.Now()),
+	}
+}
+
+func init() {
+	collections, errC := DbConnect.GetCollections()
+	if errC != nil {
+		panic(errC)
+	}
+	for _, collection := range collections {
+		if collection == STORED_FILE_COLLECTION {
+			return
+		}
+	}
+	var jsonSchema = bson.M{
+		"bsonType": "object",
+		"required": []string{"_id", "refs", "date"},
+		"properties": bson.M{
+			"_id":      bson.M{"bsonType": "string"},
+			"size":     bson.M{"bsonType": "long"},
+			"refs":     bson.M{"bsonType": "int"},
+			"date":     bson.M{"bsonType": "date"},
+			"deleting": bson.M{"bsonType": "bool"},
+		},
+	}
+	var validators = bson.M{
+		"$jsonSchema": jsonSchema,
+	}
+	opts := &options.CreateCollectionOptions{
+		Validator: validators,
+	}
+	err := DbConnect.CreateCollection(STORED_FILE_COLLECTION, opts)
+	if err != nil {
+		panic(err)
+	}
+}
+
+func NewStoredFileModel() *StoredFileModel {
+	return &StoredFileModel{}
+}
@@ -4,12 +4,12 @@ import (
 	"errors"
 	"mime"
 	"mime/multipart"
+	"path"
 	"strings"
 	"time"
 
 	"github.com/CPU-commits/USACH.dev-Server/db"
 	"github.com/CPU-commits/USACH.dev-Server/forms"
-	"github.com/CPU-commits/USACH.dev-Server/utils"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -18,7 +18,25 @@ import (
 
 const SYSTEM_FILE_COLLECTION = "system_files"
 
+// Status of an entry of an imported archive
+const (
+	IMPORT_CREATED = "created"
+	// The folder already existed, its content is merged
+	IMPORT_MERGED = "merged"
+	IMPORT_FAILED = "error"
+)
+
 // Model
+// Stored content of a file, the last version is the current one
+type FileVersion struct {
+	ID       primitive.ObjectID `json:"_id" bson:"_id"`
+	Content  string             `json:"content" bson:"content"`
+	Size     int64              `json:"size" bson:"size"`
+	Hash     string             `json:"hash" bson:"hash"`
+	Uploader primitive.ObjectID `json:"uploader,omitempty" bson:"uploader,omitempty"`
+	Date     primitive.DateTime `json:"date" bson:"date"`
+}
+
 type SystemFile struct {
 	ID          primitive.ObjectID   `json:"_id" bson:"_id,omitempty"`
 	FileType    string               `json:"file_type,omitempty" bson:"file_type,omitempty"`
@@ -26,6 +44,7 @@ type SystemFile struct {
 	Childrens   []primitive.ObjectID `json:"childrens,omitempty" bson:"childrens,omitempty"`
 	Content     string               `json:"content,omitempty" bson:"content,omitempty"`
 	IsDirectory bool                 `json:"is_directory" bson:"is_directory"`
+	Versions    []FileVersion        `json:"-" bson:"versions,omitempty"`
 	Date        primitive.DateTime   `json:"date" bson:"date"`
 }
 
@@ -41,6 +60,20 @@ type SystemFileRes struct {
 	Date        primitive.DateTime `json:"date" bson:"date"`
 }
 
+// Progress of an archive import, one by entry
+type ImportEvent struct {
+	Path   string `json:"path"`
+	Status string `json:"status"`
+	ID     string `json:"_id,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+type ImportRes struct {
+	Done    bool `json:"done"`
+	Created int  `json:"created"`
+	Failed  int  `json:"failed"`
+}
+
 type SystemFileModel struct{}
 
 func (repo *SystemFileModel) Use() *mongo.Collection {
@@ -66,31 +99,64 @@ func (repo *SystemFileModel) Exists(filter bson.D) (bool, error) {
 	return true, nil
 }
 
+// NewModel makes the element, files need their stored content
 func (repo *SystemFileModel) NewModel(
 	element *forms.SystemFileForm,
 	file *multipart.FileHeader,
-) (*SystemFile, error) {
+	stored *StoredFile,
+) *SystemFile {
 	now := primitive.NewDateTimeFromTime(time.Now())
 	if !*element.IsDirectory {
 		ext := strings.Split(file.Filename, ".")
-		uploadedFile, err := utils.UploadFile(file)
-		if err != nil {
-			return nil, err
-		}
 
 		return &SystemFile{
 			Name:        file.Filename,
 			IsDirectory: false,
 			Date:        now,
 			FileType:    mime.TypeByExtension(ext[len(ext)-1]),
-			Content:     uploadedFile,
-		}, nil
+			Content:     stored.Name,
+		}
 	}
 	return &SystemFile{
 		Name:        element.Name,
 		IsDirectory: true,
 		Date:        now,
-	}, nil
+	}
+}
+
+// NewArchiveModel makes an element of an imported archive or of a
+// resumable upload, the content of files is already stored
+func (repo *SystemFileModel) NewArchiveModel(
+	name,
+	content string,
+	isDirectory bool,
+) *SystemFile {
+	element := &SystemFile{
+		Name:        name,
+		IsDirectory: isDirectory,
+		Date:        primitive.NewDateTimeFromTime(time.Now()),
+	}
+	if !isDirectory {
+		element.FileType = mime.TypeByExtension(path.Ext(name))
+		element.Content = content
+	}
+	return element
+}
+
+func (repo *SystemFileModel) NewVersionModel(
+	content string,
+	size int64,
+	hash string,
+	uploader primitive.ObjectID,
+) *FileVersion {
+	return &FileVersion{
+		ID:       primitive.NewObjectID(),
+		Content:  content,
+		Size:     size,
+		Hash:     hash,
+		Uploader: uploader,
+		Date:     primitive.NewDateTimeFromTime(time.Now()),
+	}
 }
 
 func init() {
@@ -119,6 +185,21 @@ func init() {
 			"content":      bson.M{"bsonType": "string"},
 			"is_directory": bson.M{"bsonType": "bool"},
 			"date":         bson.M{"bsonType": "date"},
+			"versions": bson.M{
+				"bsonType": "array",
+				"items": bson.M{
+					"bsonType": "object",
+					"required": bson.A{"_id", "content", "size", "hash", "date"},
+					"properties": bson.M{
+						"_id":      bson.M{"bsonType": "objectId"},
+						"content":  bson.M{"bsonType": "string"},
+						"size":     bson.M{"bsonType": "long"},
+						"hash":     bson.M{"bsonType": "string"},
+						"uploader": bson.M{"bsonType": "objectId"},
+						"date":     bson.M{"bsonType": "date"},
+					},
+				},
+			},
 		},
 	}
 	var validators = bson.M{
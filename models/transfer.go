@@ -0,0 +1,106 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"github.com/CPU-commits/USACH.dev-Server/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const TRANSFER_COLLECTION = "transfers"
+
+// Model
+// Pending transfer, it is deleted once accepted or declined
+type Transfer struct {
+	ID         primitive.ObjectID `json:"_id" bson:"_id,omitempty"`
+	Repository primitive.ObjectID `json:"repository" bson:"repository"`
+	From       primitive.ObjectID `json:"from" bson:"from"`
+	To         primitive.ObjectID `json:"to" bson:"to"`
+	Date       primitive.DateTime `json:"date" bson:"date"`
+}
+
+// Responses
+type TransferRes struct {
+	ID         primitive.ObjectID `json:"_id" bson:"_id"`
+	Repository UpstreamRes        `json:"repository" bson:"repository"`
+	From       SimpleUser         `json:"from" bson:"from"`
+	Date       primitive.DateTime `json:"date" bson:"date"`
+}
+
+type TransferModel struct{}
+
+func (*TransferModel) Use() *mongo.Collection {
+	return DbConnect.GetCollection(TRANSFER_COLLECTION)
+}
+
+func (t *TransferModel) Exists(filter bson.D) (bool, error) {
+	var transfer *Transfer
+
+	options := options.FindOne().SetProjection(bson.D{{
+		Key:   "_id",
+		Value: 1,
+	}})
+	cursor := t.Use().FindOne(db.Ctx, filter, options)
+
+	if err := cursor.Decode(&transfer); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (*TransferModel) NewModel(
+	idRepository,
+	from,
+	to primitive.ObjectID,
+) *Transfer {
+	return &Transfer{
+		Repository: idRepository,
+		From:       from,
+		To:         to,
+		Date:       primitive.NewDateTimeFromTime(time.Now()),
+	}
+}
+
+func init() {
+	collections, errC := DbConnect.GetCollections()
+	if errC != nil {
+		panic(errC)
+	}
+	for _, collection := range collections {
+		if collection == TRANSFER_COLLECTION {
+			return
+		}
+	}
+	var jsonSchema = bson.M{
+		"bsonType": "object",
+		"required": []string{"repository", "from", "to", "date"},
+		"properties": bson.M{
+			"repository": bson.M{"bsonType": "objectId"},
+			"from":       bson.M{"bsonType": "objectId"},
+			"to":         bson.M{"bsonType": "objectId"},
+			"date":       bson.M{"bsonType": "date"},
+		},
+	}
+	var validators = bson.M{
+		"$jsonSchema": jsonSchema,
+	}
+	opts := &options.CreateCollectionOptions{
+		Validator: validators,
+	}
+	err := DbConnect.CreateCollection(TRANSFER_COLLECTION, opts)
+	if err != nil {
+		panic(err)
+	}
+}
+
+func NewTransferModel() *TransferModel {
+	return &TransferModel{}
+}
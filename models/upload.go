@@ -0,0 +1,142 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"github.com/CPU-commits/USACH.dev-Server/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const UPLOAD_COLLECTION = "uploads"
+
+// Model
+// Resumable upload of a file, every part received is in the storage until
+// the upload is complete and the file joins the repository
+type Upload struct {
+	ID         primitive.ObjectID `json:"_id" bson:"_id,omitempty"`
+	Repository primitive.ObjectID `json:"repository" bson:"repository"`
+	// Empty for the root of the repository
+	Parent  primitive.ObjectID `json:"parent,omitempty" bson:"parent,omitempty"`
+	User    primitive.ObjectID `json:"user" bson:"user"`
+	Name    string             `json:"name" bson:"name"`
+	Length  int64              `json:"length" bson:"length"`
+	Offset  int64              `json:"offset" bson:"offset"`
+	Expires primitive.DateTime `json:"expires" bson:"expires"`
+	Date    primitive.DateTime `json:"date" bson:"date"`
+	// Parts saved, in order
+	Parts []UploadPart `json:"-" bson:"parts,omitempty"`
+	// Parts being written, deleted with the upload if their request stops
+	Pending []string `json:"-" bson:"pending,omitempty"`
+}
+
+type UploadPart struct {
+	Name string `json:"name" bson:"name"`
+	Size int64  `json:"size" bson:"size"`
+}
+
+type UploadModel struct{}
+
+func (*UploadModel) Use() *mongo.Collection {
+	return DbConnect.GetCollection(UPLOAD_COLLECTION)
+}
+
+func (u *UploadModel) Exists(filter bson.D) (bool, error) {
+	var upload *Upload
+
+	options := options.FindOne().SetProjection(bson.D{{
+		Key:   "_id",
+		Value: 1,
+	}})
+	cursor := u.Use().FindOne(db.Ctx, filter, options)
+
+	if err := cursor.Decode(&upload); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (*UploadModel) NewModel(
+	idRepository,
+	parent,
+	idUser primitive.ObjectID,
+	name string,
+	length int64,
+	expires time.Duration,
+) *Upload {
+	now := time.Now()
+	return &Upload{
+		ID:         primitive.NewObjectID(),
+		Repository: idRepository,
+		Parent:     parent,
+		User:       idUser,
+		Name:       name,
+		Length:     length,
+		Expires:    primitive.NewDateTimeFromTime(now.Add(expires)),
+		Date:       primitive.NewDateTimeFromTime(now),
+	}
+}
+
+func init() {
+	collections, errC := DbConnect.GetCollections()
+	if errC != nil {
+		panic(errC)
+	}
+	for _, collection := range collections {
+		if collection == UPLOAD_COLLECTION {
+			return
+		}
+	}
+	var jsonSchema = bson.M{
+		"bsonType": "object",
+		"required": []string{"repository", "user", "name", "length", "offset", "expires", "date"},
+		"properties": bson.M{
+			"repository": bson.M{"bsonType": "objectId"},
+			"parent":     bson.M{"bsonType": "objectId"},
+			"user":       bson.M{"bsonType": "objectId"},
+			"name":       bson.M{"bsonType": "string", "maxLength": 100},
+			"length":     bson.M{"bsonType": "long"},
+			"offset":     bson.M{"bsonType": "long"},
+			"expires":    bson.M{"bsonType": "date"},
+			"date":       bson.M{"bsonType": "date"},
+			"parts": bson.M{
+				"bsonType": "array",
+				"items": bson.M{
+					"bsonType": "object",
+					"required": []string{"name", "size"},
+					"properties": bson.M{
+						"name": bson.M{"bsonType": "string"},
+						"size": bson.M{"bsonType": "long"},
+					},
+				},
+			},
+			"pending": bson.M{
+				"bsonType": "array",
+				"items": bson.M{
+					"bsonType": "string",
+				},
+			},
+		},
+	}
+	var validators = bson.M{
+		"$jsonSchema": jsonSchema,
+	}
+	opts := &options.CreateCollectionOptions{
+		Validator: validators,
+	}
+	err := DbConnect.CreateCollection(UPLOAD_COLLECTION, opts)
+	if err != nil {
+		panic(err)
+	}
+}
+
+func NewUploadModel() *UploadModel {
+	return &UploadModel{}
+}
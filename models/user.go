@@ -1,9 +1,10 @@
 package models
 
 import (
-	"strings"
+	"errors"
 	"time"
 
+	"github.com/CPU-commits/USACH.dev-Server/db"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -21,16 +22,24 @@ const (
 )
 
 // Model
+// Two factor
+type TwoFactor struct {
+	Enabled       bool     `bson:"enabled"`
+	Secret        string   `bson:"secret"`
+	RecoveryCodes []string `bson:"recovery_codes,omitempty"`
+}
+
 type User struct {
-	ID       primitive.ObjectID `json:"_id" bson:"_id,omitempty"`
-	FullName string             `json:"full_name" bson:"full_name"`
-	Username string             `json:"username" bson:"username"`
-	Email    string             `json:"email" bson:"email"`
-	Profile  primitive.ObjectID `json:"profile,omitempty" bson:"profile,omitempty"`
-	Password string             `json:"password,omitempty" bson:"password"`
-	Status   bool               `bson:"status"`
-	Role     string             `json:"role" bson:"role"`
-	Date     primitive.DateTime `json:"date,omitempty" bson:"date,omitempty"`
+	ID        primitive.ObjectID `json:"_id" bson:"_id,omitempty"`
+	FullName  string             `json:"full_name" bson:"full_name"`
+	Username  string             `json:"username" bson:"username"`
+	Email     string             `json:"email" bson:"email"`
+	Profile   primitive.ObjectID `json:"profile,omitempty" bson:"profile,omitempty"`
+	Password  string             `json:"password,omitempty" bson:"password"`
+	Status    bool               `json:"status" bson:"status"`
+	Role      string             `json:"role" bson:"role"`
+	TwoFactor *TwoFactor         `json:"-" bson:"two_factor,omitempty"`
+	Date      primitive.DateTime `json:"date,omitempty" bson:"date,omitempty"`
 }
 
 // Responses
@@ -42,7 +51,10 @@ type UserRes struct {
 	Email    string             `json:"email" bson:"email"`
 	Role     string             `json:"role" bson:"role"`
 	Date     primitive.DateTime `json:"date,omitempty" bson:"date,omitempty"`
-	Profile  *Profile           `json:"profile,omitempty"`
+	Profile  *ProfileRes        `json:"profile,omitempty"`
+	// Follows
+	Followers int64 `json:"followers" bson:"-"`
+	Following int64 `json:"following" bson:"-"`
 }
 
 type SimpleUser struct {
@@ -57,13 +69,30 @@ func (users *UsersModel) Use() *mongo.Collection {
 	return DbConnect.GetCollection(USERS_COLLECTION)
 }
 
+func (users *UsersModel) Exists(filter bson.D) (bool, error) {
+	var user *User
+
+	opts := options.FindOne().SetProjection(bson.D{{
+		Key:   "_id",
+		Value: 1,
+	}})
+	cursor := users.Use().FindOne(db.Ctx, filter, opts)
+	if err := cursor.Decode(&user); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
 func (users *UsersModel) NewModel(
 	fullName,
 	email,
+	username,
 	password,
 	role string,
 ) *User {
-	username := strings.ReplaceAll(email, "@usach.cl", "")
 	user := &User{
 		FullName: fullName,
 		Username: username,
@@ -109,7 +138,19 @@ func init() {
 			"username": bson.M{"bsonType": "string"},
 			"role":     bson.M{"enum": bson.A{"a", "b"}},
 			"status":   bson.M{"bsonType": "bool"},
-			"date":     bson.M{"bsonType": "date"},
+			"two_factor": bson.M{
+				"bsonType": "object",
+				"required": []string{"enabled", "secret"},
+				"properties": bson.M{
+					"enabled": bson.M{"bsonType": "bool"},
+					"secret":  bson.M{"bsonType": "string"},
+					"recovery_codes": bson.M{
+						"bsonType": "array",
+						"items":    bson.M{"bsonType": "string"},
+					},
+				},
+			},
+			"date": bson.M{"bsonType": "date"},
 		},
 	}
 	var validators = bson.M{
@@ -1,8 +1,8 @@
 package models
 
 import (
+	"crypto/rand"
 	"encoding/hex"
-	"math/rand"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -14,7 +14,8 @@ const USERS_TOKEN_COLLECTION = "users_token"
 
 // Permissions
 const (
-	PERMISSION_CONFIRM_USER = "confirm_user"
+	PERMISSION_CONFIRM_USER   = "confirm_user"
+	PERMISSION_RESET_PASSWORD = "reset_password"
 )
 
 // Model
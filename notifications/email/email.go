@@ -14,7 +14,8 @@ var settingsData = settings.GetSettings()
 
 // Templates
 const (
-	TEMPLATE_VALIDATE_USER = "validate_user"
+	TEMPLATE_VALIDATE_USER  = "validate_user"
+	TEMPLATE_RESET_PASSWORD = "reset_password"
 )
 
 // MailSender
@@ -11,6 +11,7 @@ import (
 
 	"github.com/CPU-commits/USACH.dev-Server/controllers"
 	"github.com/CPU-commits/USACH.dev-Server/middlewares"
+	"github.com/CPU-commits/USACH.dev-Server/models"
 	"github.com/CPU-commits/USACH.dev-Server/res"
 	"github.com/CPU-commits/USACH.dev-Server/settings"
 	ratelimit "github.com/JGLTechnologies/gin-rate-limit"
@@ -45,6 +46,8 @@ var settingsData = settings.GetSettings()
 
 func Init() {
 	router := gin.New()
+	// Failed downloads
+	router.Use(middlewares.AbortConnection())
 	// Proxies
 	router.SetTrustedProxies([]string{"localhost"})
 	// Zap logger
@@ -90,12 +93,26 @@ func Init() {
 	docs.SwaggerInfo.Version = "v1"
 	docs.SwaggerInfo.Host = "localhost:8080"
 	// CORS
+	exposeHeaders := []string{
+		"Content-Type",
+		"Content-Disposition",
+		// Resumable uploads
+		"Location",
+		"Tus-Resumable",
+		"Tus-Version",
+		"Tus-Extension",
+		"Tus-Max-Size",
+		"Upload-Offset",
+		"Upload-Length",
+		"Upload-Expires",
+		"Upload-Element",
+	}
 	if settingsData.GO_ENV == "prod" {
 		config := cors.Config{
-			AllowMethods:     []string{"GET", "OPTIONS", "PUT", "DELETE", "POST"},
+			AllowMethods:     []string{"GET", "OPTIONS", "PUT", "DELETE", "POST", "PATCH", "HEAD"},
 			AllowCredentials: true,
 			AllowHeaders:     []string{"*"},
-			ExposeHeaders:    []string{"Content-Type", "Content-Disposition"},
+			ExposeHeaders:    exposeHeaders,
 			AllowWebSockets:  false,
 			MaxAge:           12 * time.Hour,
 		}
@@ -113,8 +130,8 @@ func Init() {
 		router.Use(cors.New(cors.Config{
 			AllowAllOrigins: true,
 			AllowHeaders:    []string{"*"},
-			ExposeHeaders:   []string{"Content-Type", "Content-Disposition"},
-			AllowMethods:    []string{"GET", "OPTIONS", "PUT", "DELETE", "POST"},
+			ExposeHeaders:   exposeHeaders,
+			AllowMethods:    []string{"GET", "OPTIONS", "PUT", "DELETE", "POST", "PATCH", "HEAD"},
 		}))
 	}
 	// Secure
@@ -167,6 +184,15 @@ func Init() {
 	comment := router.Group(
 		"/api/v1/comments",
 	)
+	feed := router.Group(
+		"/api/v1/feed",
+	)
+	admin := router.Group(
+		"/api/v1/admin",
+		middlewares.JWTMiddleware(false),
+		middlewares.RolesMiddleware([]string{models.ADMIN}),
+		middlewares.AdminMiddleware(),
+	)
 	{
 		// Init controllers
 		authController := new(controllers.AuthController)
@@ -175,6 +201,11 @@ func Init() {
 		repoController := new(controllers.RepositoryController)
 		systemFileController := new(controllers.SystemFileController)
 		commentController := new(controllers.CommentController)
+		tokenController := new(controllers.PersonalAccessTokenController)
+		adminController := new(controllers.AdminController)
+		collaboratorController := new(controllers.CollaboratorController)
+		snapshotController := new(controllers.SnapshotController)
+		uploadController := new(controllers.UploadController)
 		// Define routes
 		// Authentication
 		auth.POST(
@@ -189,10 +220,57 @@ func Init() {
 			"/login",
 			authController.Login,
 		)
+		auth.POST(
+			"/login/2fa",
+			authController.LoginTwoFactor,
+		)
 		auth.POST(
 			"/refresh",
 			authController.RefreshToken,
 		)
+		auth.POST(
+			"/2fa/enroll",
+			middlewares.JWTMiddleware(false),
+			authController.EnrollTwoFactor,
+		)
+		auth.POST(
+			"/2fa/confirm",
+			middlewares.JWTMiddleware(false),
+			authController.ConfirmTwoFactor,
+		)
+		auth.POST(
+			"/2fa/disable",
+			middlewares.JWTMiddleware(false),
+			authController.DisableTwoFactor,
+		)
+		auth.POST(
+			"/logout",
+			middlewares.JWTMiddleware(false),
+			authController.Logout,
+		)
+		auth.POST(
+			"/logout-all",
+			middlewares.JWTMiddleware(false),
+			authController.LogoutAll,
+		)
+		auth.GET(
+			"/sessions",
+			middlewares.JWTMiddleware(false),
+			authController.GetSessions,
+		)
+		auth.DELETE(
+			"/sessions/:id",
+			middlewares.JWTMiddleware(false),
+			authController.DeleteSession,
+		)
+		auth.POST(
+			"/password/forgot",
+			authController.ForgotPassword,
+		)
+		auth.POST(
+			"/password/reset",
+			authController.ResetPassword,
+		)
 		// User
 		user.GET(
 			":idUser",
@@ -202,82 +280,288 @@ func Init() {
 			"avatar/:username",
 			userController.GetAvatar,
 		)
+		user.GET(
+			":idUser/followers",
+			userController.GetFollowers,
+		)
+		user.GET(
+			":idUser/following",
+			userController.GetFollowing,
+		)
+		user.POST(
+			"follow/:username",
+			middlewares.JWTMiddleware(false),
+			userController.Follow,
+		)
+		user.DELETE(
+			"follow/:username",
+			middlewares.JWTMiddleware(false),
+			userController.Unfollow,
+		)
 		user.PUT(
 			"profile",
 			middlewares.JWTMiddleware(false),
 			userController.UpdateProfile,
 		)
+		user.GET(
+			"tokens",
+			middlewares.JWTMiddleware(false),
+			tokenController.GetTokens,
+		)
+		user.POST(
+			"tokens",
+			middlewares.JWTMiddleware(false),
+			tokenController.CreateToken,
+		)
+		user.PUT(
+			"tokens/:idToken",
+			middlewares.JWTMiddleware(false),
+			tokenController.UpdateToken,
+		)
+		user.DELETE(
+			"tokens/:idToken",
+			middlewares.JWTMiddleware(false),
+			tokenController.DeleteToken,
+		)
 		// Repository
 		repo.GET(
 			"",
-			middlewares.JWTMiddleware(true),
+			middlewares.ScopedJWTMiddleware(true, models.SCOPE_REPO_READ),
 			repoController.GetRepositories,
 		)
 		repo.GET(
 			":username",
-			middlewares.JWTMiddleware(true),
+			middlewares.ScopedJWTMiddleware(true, models.SCOPE_REPO_READ),
 			repoController.GetUserRepositories,
 		)
 		repo.GET(
 			":username/:repository",
-			middlewares.JWTMiddleware(true),
+			middlewares.ScopedJWTMiddleware(true, models.SCOPE_REPO_READ),
 			middlewares.RepoAccess(false),
 			middlewares.SetUserID(),
 			repoController.GetRepository,
 		)
 		repo.GET(
 			":username/:repository/:folder",
-			middlewares.JWTMiddleware(true),
+			middlewares.ScopedJWTMiddleware(true, models.SCOPE_REPO_READ),
 			middlewares.RepoAccess(false),
 			middlewares.SetUserID(),
 			systemFileController.GetFolder,
 		)
+		repo.GET(
+			":username/:repository/tree/*path",
+			middlewares.ScopedJWTMiddleware(true, models.SCOPE_REPO_READ),
+			middlewares.RepoAccess(false),
+			systemFileController.GetTree,
+		)
+		repo.GET(
+			":username/:repository/raw/*path",
+			middlewares.ScopedJWTMiddleware(true, models.SCOPE_REPO_READ),
+			middlewares.RepoAccess(false),
+			systemFileController.GetRawFile,
+		)
+		repo.GET(
+			":username/:repository/compare",
+			middlewares.ScopedJWTMiddleware(true, models.SCOPE_REPO_READ),
+			middlewares.RepoAccess(false),
+			snapshotController.Compare,
+		)
 		repo.GET(
 			"download/:repository",
-			middlewares.JWTMiddleware(true),
+			middlewares.ScopedJWTMiddleware(true, models.SCOPE_REPO_READ),
+			middlewares.RepoAccess(false),
+			repoController.DownloadRepository,
+		)
+		repo.GET(
+			"download/:repository/:folder",
+			middlewares.ScopedJWTMiddleware(true, models.SCOPE_REPO_READ),
 			middlewares.RepoAccess(false),
 			repoController.DownloadRepository,
 		)
 		repo.POST(
 			"",
-			middlewares.JWTMiddleware(false),
+			middlewares.ScopedJWTMiddleware(false, models.SCOPE_REPO_WRITE),
 			repoController.UploadRepository,
 		)
+		repo.POST(
+			"import/:idRepository",
+			middlewares.ScopedJWTMiddleware(false, models.SCOPE_REPO_WRITE),
+			systemFileController.ImportArchive,
+		)
+		// Resumable uploads
+		repo.OPTIONS(
+			"uploads/:idRepository",
+			uploadController.Options,
+		)
+		repo.POST(
+			"uploads/:idRepository",
+			middlewares.ScopedJWTMiddleware(false, models.SCOPE_REPO_WRITE),
+			uploadController.CreateUpload,
+		)
+		repo.HEAD(
+			"uploads/:idRepository/:upload",
+			middlewares.ScopedJWTMiddleware(false, models.SCOPE_REPO_WRITE),
+			uploadController.GetUploadOffset,
+		)
+		repo.PATCH(
+			"uploads/:idRepository/:upload",
+			middlewares.ScopedJWTMiddleware(false, models.SCOPE_REPO_WRITE),
+			uploadController.WritePart,
+		)
+		repo.DELETE(
+			"uploads/:idRepository/:upload",
+			middlewares.ScopedJWTMiddleware(false, models.SCOPE_REPO_WRITE),
+			uploadController.DeleteUpload,
+		)
+		repo.POST(
+			"fork/:repository",
+			middlewares.ScopedJWTMiddleware(false, models.SCOPE_REPO_WRITE),
+			middlewares.RepoAccess(false),
+			repoController.ForkRepository,
+		)
 		repo.POST(
 			"like/:repository",
-			middlewares.JWTMiddleware(false),
+			middlewares.ScopedJWTMiddleware(false, models.SCOPE_REPO_WRITE),
 			repoController.ToggleLike,
 		)
 		repo.PUT(
 			":repository",
-			middlewares.JWTMiddleware(false),
+			middlewares.ScopedJWTMiddleware(false, models.SCOPE_REPO_WRITE),
 			repoController.UpdateRepository,
 		)
 		repo.PUT(
 			"element/:idRepository",
-			middlewares.JWTMiddleware(false),
+			middlewares.ScopedJWTMiddleware(false, models.SCOPE_REPO_WRITE),
 			systemFileController.NewRepoElement,
 		)
+		repo.PUT(
+			"element/:idRepository/:element",
+			middlewares.ScopedJWTMiddleware(false, models.SCOPE_REPO_WRITE),
+			systemFileController.MoveElement,
+		)
+		repo.PUT(
+			"element/:idRepository/:element/file",
+			middlewares.ScopedJWTMiddleware(false, models.SCOPE_REPO_WRITE),
+			systemFileController.ReplaceFile,
+		)
 		repo.PUT(
 			"link/:repository",
-			middlewares.JWTMiddleware(false),
+			middlewares.ScopedJWTMiddleware(false, models.SCOPE_REPO_WRITE),
 			repoController.AddLink,
 		)
 		repo.DELETE(
 			":repository",
-			middlewares.JWTMiddleware(false),
+			middlewares.ScopedJWTMiddleware(false, models.SCOPE_REPO_WRITE),
 			repoController.DeleteRepository,
 		)
 		repo.DELETE(
 			":repository/:element",
-			middlewares.JWTMiddleware(false),
+			middlewares.ScopedJWTMiddleware(false, models.SCOPE_REPO_WRITE),
 			systemFileController.DeleteElement,
 		)
 		repo.DELETE(
 			":repository/link/:link",
-			middlewares.JWTMiddleware(false),
+			middlewares.ScopedJWTMiddleware(false, models.SCOPE_REPO_WRITE),
 			repoController.DeleteLink,
 		)
+		// Versions
+		repo.GET(
+			"versions/:repository/:element",
+			middlewares.ScopedJWTMiddleware(true, models.SCOPE_REPO_READ),
+			middlewares.RepoAccess(false),
+			systemFileController.GetVersions,
+		)
+		repo.GET(
+			"versions/:repository/:element/:version",
+			middlewares.ScopedJWTMiddleware(true, models.SCOPE_REPO_READ),
+			middlewares.RepoAccess(false),
+			systemFileController.GetVersionFile,
+		)
+		repo.POST(
+			"versions/:repository/:element/:version/restore",
+			middlewares.ScopedJWTMiddleware(false, models.SCOPE_REPO_WRITE),
+			systemFileController.RestoreVersion,
+		)
+		// Snapshots
+		repo.POST(
+			"snapshots/:repository",
+			middlewares.ScopedJWTMiddleware(false, models.SCOPE_REPO_WRITE),
+			snapshotController.CreateSnapshot,
+		)
+		repo.GET(
+			"snapshots/:repository/:tag",
+			middlewares.ScopedJWTMiddleware(true, models.SCOPE_REPO_READ),
+			middlewares.RepoAccess(false),
+			snapshotController.GetSnapshot,
+		)
+		repo.GET(
+			"snapshots/:repository/:tag/download",
+			middlewares.ScopedJWTMiddleware(true, models.SCOPE_REPO_READ),
+			middlewares.RepoAccess(false),
+			snapshotController.DownloadSnapshot,
+		)
+		repo.DELETE(
+			"snapshots/:repository/:tag",
+			middlewares.ScopedJWTMiddleware(false, models.SCOPE_REPO_WRITE),
+			snapshotController.DeleteSnapshot,
+		)
+		// Transfers
+		repo.POST(
+			"transfer/:repository",
+			middlewares.ScopedJWTMiddleware(false, models.SCOPE_REPO_WRITE),
+			repoController.TransferRepository,
+		)
+		repo.GET(
+			"transfers",
+			middlewares.ScopedJWTMiddleware(false, models.SCOPE_REPO_READ),
+			repoController.GetTransfers,
+		)
+		repo.POST(
+			"transfers/:idTransfer/accept",
+			middlewares.ScopedJWTMiddleware(false, models.SCOPE_REPO_WRITE),
+			repoController.AcceptTransfer,
+		)
+		repo.DELETE(
+			"transfers/:idTransfer",
+			middlewares.ScopedJWTMiddleware(false, models.SCOPE_REPO_WRITE),
+			repoController.DeclineTransfer,
+		)
+		// Collaborators
+		repo.GET(
+			"collaborators/:repository",
+			middlewares.ScopedJWTMiddleware(false, models.SCOPE_REPO_READ),
+			collaboratorController.GetCollaborators,
+		)
+		repo.POST(
+			"collaborators/:repository",
+			middlewares.ScopedJWTMiddleware(false, models.SCOPE_REPO_WRITE),
+			collaboratorController.InviteCollaborator,
+		)
+		repo.PUT(
+			"collaborators/:repository/:idUser",
+			middlewares.ScopedJWTMiddleware(false, models.SCOPE_REPO_WRITE),
+			collaboratorController.UpdateCollaboratorRole,
+		)
+		repo.DELETE(
+			"collaborators/:repository/:idUser",
+			middlewares.ScopedJWTMiddleware(false, models.SCOPE_REPO_WRITE),
+			collaboratorController.RemoveCollaborator,
+		)
+		repo.GET(
+			"invitations",
+			middlewares.ScopedJWTMiddleware(false, models.SCOPE_REPO_READ),
+			collaboratorController.GetInvitations,
+		)
+		repo.POST(
+			"invitations/:idInvitation/accept",
+			middlewares.ScopedJWTMiddleware(false, models.SCOPE_REPO_WRITE),
+			collaboratorController.AcceptInvitation,
+		)
+		repo.DELETE(
+			"invitations/:idInvitation",
+			middlewares.ScopedJWTMiddleware(false, models.SCOPE_REPO_WRITE),
+			collaboratorController.DeclineInvitation,
+		)
 		// Discussion
 		dis.GET(
 			"",
@@ -301,17 +585,17 @@ func Init() {
 		)
 		dis.POST(
 			"",
-			middlewares.JWTMiddleware(false),
+			middlewares.ScopedJWTMiddleware(false, models.SCOPE_DISCUSSION_WRITE),
 			discussionController.UploadDiscussion,
 		)
 		dis.POST(
 			"reaction/:discussion",
-			middlewares.JWTMiddleware(false),
+			middlewares.ScopedJWTMiddleware(false, models.SCOPE_DISCUSSION_WRITE),
 			discussionController.ReactDiscussion,
 		)
 		dis.DELETE(
 			"reaction/:discussion",
-			middlewares.JWTMiddleware(false),
+			middlewares.ScopedJWTMiddleware(false, models.SCOPE_DISCUSSION_WRITE),
 			discussionController.DeleteReaction,
 		)
 		// Comments
@@ -322,9 +606,44 @@ func Init() {
 		)
 		comment.POST(
 			":discussion",
-			middlewares.JWTMiddleware(false),
+			middlewares.ScopedJWTMiddleware(false, models.SCOPE_DISCUSSION_WRITE),
 			commentController.Comment,
 		)
+		// Feed
+		feed.GET(
+			"",
+			middlewares.JWTMiddleware(false),
+			userController.GetFeed,
+		)
+		// Admin
+		admin.GET(
+			"users",
+			adminController.GetUsers,
+		)
+		admin.PUT(
+			"users/:idUser/status",
+			adminController.SetUserStatus,
+		)
+		admin.PUT(
+			"users/:idUser/role",
+			adminController.SetUserRole,
+		)
+		admin.DELETE(
+			"repositories/:idRepository",
+			adminController.DeleteRepository,
+		)
+		admin.DELETE(
+			"discussions/:idDiscussion",
+			adminController.DeleteDiscussion,
+		)
+		admin.DELETE(
+			"comments/:idComment",
+			adminController.DeleteComment,
+		)
+		admin.GET(
+			"audits",
+			adminController.GetAudits,
+		)
 	}
 	// Route docs
 	router.GET("/api/v1/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
@@ -0,0 +1,463 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"github.com/CPU-commits/USACH.dev-Server/db"
+	"github.com/CPU-commits/USACH.dev-Server/forms"
+	"github.com/CPU-commits/USACH.dev-Server/models"
+	"github.com/CPU-commits/USACH.dev-Server/res"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type AdminService struct{}
+
+// CanModerate checks against the database that the user still is an admin
+// with two factor enabled, the role inside the token could be stale
+func (*AdminService) CanModerate(idUser string) *res.ErrorRes {
+	user, errRes := twoFactorService.getUser(idUser)
+	if errRes != nil {
+		return errRes
+	}
+	if user.Role != models.ADMIN || !user.Status {
+		return &res.ErrorRes{
+			Err:        errors.New("no tienes permisos de administrador"),
+			StatusCode: http.StatusUnauthorized,
+		}
+	}
+	if user.TwoFactor == nil || !user.TwoFactor.Enabled {
+		return &res.ErrorRes{
+			Err:        errors.New("debes activar la autenticación de dos factores"),
+			StatusCode: http.StatusForbidden,
+		}
+	}
+	return nil
+}
+
+func (*AdminService) audit(
+	idAdmin string,
+	action,
+	entityType string,
+	entity primitive.ObjectID,
+	details string,
+) *res.ErrorRes {
+	idObjAdmin, err := primitive.ObjectIDFromHex(idAdmin)
+	if err != nil {
+		return &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	audit := auditModel.NewModel(
+		idObjAdmin,
+		action,
+		entityType,
+		entity,
+		details,
+	)
+	if _, err := auditModel.Use().InsertOne(db.Ctx, audit); err != nil {
+		return &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	return nil
+}
+
+func (*AdminService) GetUsers(
+	search string,
+	page int,
+	total bool,
+) ([]models.User, int64, *res.ErrorRes) {
+	filter := bson.D{}
+	if search != "" {
+		search = regexp.QuoteMeta(search)
+		filter = bson.D{{
+			Key: "$or",
+			Value: bson.A{
+				bson.M{"username": bson.M{"$regex": search, "$options": "i"}},
+				bson.M{"full_name": bson.M{"$regex": search, "$options": "i"}},
+				bson.M{"email": bson.M{"$regex": search, "$options": "i"}},
+			},
+		}}
+	}
+	// Get users
+	var users []models.User
+
+	opts := options.Find().
+		SetProjection(bson.D{
+			{Key: "password", Value: 0},
+			{Key: "two_factor", Value: 0},
+		}).
+		SetSort(bson.D{{Key: "date", Value: -1}}).
+		SetSkip(int64(page * 20)).
+		SetLimit(20)
+	cursor, err := userModel.Use().Find(db.Ctx, filter, opts)
+	if err != nil {
+		return nil, 0, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	if err := cursor.All(db.Ctx, &users); err != nil {
+		return nil, 0, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	// Total
+	var totalElements int64
+	if total {
+		totalElements, err = userModel.Use().CountDocuments(db.Ctx, filter)
+		if err != nil {
+			return nil, 0, &res.ErrorRes{
+				Err:        err,
+				StatusCode: http.StatusServiceUnavailable,
+			}
+		}
+	}
+
+	return users, totalElements, nil
+}
+
+func (a *AdminService) updateUser(
+	idAdmin,
+	idUser string,
+	update bson.D,
+) (primitive.ObjectID, *res.ErrorRes) {
+	if idAdmin == idUser {
+		return primitive.NilObjectID, &res.ErrorRes{
+			Err:        errors.New("no puedes moderar tu propia cuenta"),
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	idObjUser, err := primitive.ObjectIDFromHex(idUser)
+	if err != nil {
+		return primitive.NilObjectID, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	result, err := userModel.Use().UpdateByID(db.Ctx, idObjUser, bson.D{{
+		Key:   "$set",
+		Value: update,
+	}})
+	if err != nil {
+		return primitive.NilObjectID, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	if result.MatchedCount == 0 {
+		return primitive.NilObjectID, &res.ErrorRes{
+			Err:        errors.New("no existe el usuario"),
+			StatusCode: http.StatusNotFound,
+		}
+	}
+	// Tokens carry the old status and role
+	if errRes := sessionService.RevokeAll(idUser); errRes != nil {
+		return primitive.NilObjectID, errRes
+	}
+	return idObjUser, nil
+}
+
+func (a *AdminService) SetUserStatus(
+	idAdmin,
+	idUser string,
+	statusForm *forms.UserStatusForm,
+) *res.ErrorRes {
+	idObjUser, errRes := a.updateUser(idAdmin, idUser, bson.D{{
+		Key:   "status",
+		Value: *statusForm.Status,
+	}})
+	if errRes != nil {
+		return errRes
+	}
+	action := models.AUDIT_SUSPEND_USER
+	if *statusForm.Status {
+		action = models.AUDIT_REACTIVATE_USER
+	}
+	return a.audit(
+		idAdmin,
+		action,
+		models.AUDIT_ENTITY_USER,
+		idObjUser,
+		statusForm.Reason,
+	)
+}
+
+func (a *AdminService) SetUserRole(
+	idAdmin,
+	idUser string,
+	roleForm *forms.UserRoleForm,
+) *res.ErrorRes {
+	idObjUser, errRes := a.updateUser(idAdmin, idUser, bson.D{{
+		Key:   "role",
+		Value: roleForm.Role,
+	}})
+	if errRes != nil {
+		return errRes
+	}
+	return a.audit(
+		idAdmin,
+		models.AUDIT_CHANGE_ROLE,
+		models.AUDIT_ENTITY_USER,
+		idObjUser,
+		fmt.Sprintf("role: %s", roleForm.Role),
+	)
+}
+
+func (a *AdminService) DeleteRepository(
+	idAdmin,
+	idRepository,
+	reason string,
+) *res.ErrorRes {
+	idObjRepository, err := primitive.ObjectIDFromHex(idRepository)
+	if err != nil {
+		return &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	var repository *models.Repository
+
+	opts := options.FindOneAndDelete().SetProjection(bson.D{{
+		Key:   "system_file",
+		Value: 1,
+	}})
+	cursor := repoModel.Use().FindOneAndDelete(db.Ctx, bson.D{{
+		Key:   "_id",
+		Value: idObjRepository,
+	}}, opts)
+	if err := cursor.Decode(&repository); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return &res.ErrorRes{
+				Err:        errors.New("no existe el repositorio"),
+				StatusCode: http.StatusNotFound,
+			}
+		}
+		return &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	if errRes := systemFileService.deleteTree(repository.SystemFile); errRes != nil {
+		return errRes
+	}
+	errRes := collaboratorService.DeleteRepositoryCollaborators(idObjRepository)
+	if errRes != nil {
+		return errRes
+	}
+	if errRes := transferService.deleteTransfers(idObjRepository); errRes != nil {
+		return errRes
+	}
+	if errRes := snapshotService.deleteSnapshots(idObjRepository); errRes != nil {
+		return errRes
+	}
+	return a.audit(
+		idAdmin,
+		models.AUDIT_DELETE_REPOSITORY,
+		models.AUDIT_ENTITY_REPOSITORY,
+		idObjRepository,
+		reason,
+	)
+}
+
+func (a *AdminService) DeleteDiscussion(
+	idAdmin,
+	idDiscussion,
+	reason string,
+) *res.ErrorRes {
+	idObjDiscussion, err := primitive.ObjectIDFromHex(idDiscussion)
+	if err != nil {
+		return &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	var discussion *models.Discussion
+
+	opts := options.FindOneAndDelete().SetProjection(bson.D{{
+		Key:   "image",
+		Value: 1,
+	}})
+	cursor := discussionModel.Use().FindOneAndDelete(db.Ctx, bson.D{{
+		Key:   "_id",
+		Value: idObjDiscussion,
+	}}, opts)
+	if err := cursor.Decode(&discussion); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return &res.ErrorRes{
+				Err:        errors.New("no existe la discusión"),
+				StatusCode: http.StatusNotFound,
+			}
+		}
+		return &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	if err := storedFileService.Unref(discussion.Image); err != nil {
+		return &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	// Delete comments and reactions
+	filter := bson.D{{
+		Key:   "discussion",
+		Value: idObjDiscussion,
+	}}
+	if _, err := commentModel.Use().DeleteMany(db.Ctx, filter); err != nil {
+		return &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	if _, err := reactionModel.Use().DeleteMany(db.Ctx, filter); err != nil {
+		return &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	return a.audit(
+		idAdmin,
+		models.AUDIT_DELETE_DISCUSSION,
+		models.AUDIT_ENTITY_DISCUSSION,
+		idObjDiscussion,
+		reason,
+	)
+}
+
+func (a *AdminService) DeleteComment(
+	idAdmin,
+	idComment,
+	reason string,
+) *res.ErrorRes {
+	idObjComment, err := primitive.ObjectIDFromHex(idComment)
+	if err != nil {
+		return &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	var comment *models.Comment
+
+	cursor := commentModel.Use().FindOne(db.Ctx, bson.D{{
+		Key:   "_id",
+		Value: idObjComment,
+	}})
+	if err := cursor.Decode(&comment); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return &res.ErrorRes{
+				Err:        errors.New("no existe el comentario"),
+				StatusCode: http.StatusNotFound,
+			}
+		}
+		return &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	// Delete comment and its responses
+	idComments := append([]primitive.ObjectID{idObjComment}, comment.Responses...)
+	_, err = commentModel.Use().DeleteMany(db.Ctx, bson.D{{
+		Key:   "_id",
+		Value: bson.M{"$in": idComments},
+	}})
+	if err != nil {
+		return &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	// Remove from parent comment
+	if comment.IsRes {
+		_, err = commentModel.Use().UpdateOne(
+			db.Ctx,
+			bson.D{{
+				Key:   "responses",
+				Value: idObjComment,
+			}},
+			bson.D{{
+				Key: "$pull",
+				Value: bson.M{
+					"responses": idObjComment,
+				},
+			}},
+		)
+		if err != nil {
+			return &res.ErrorRes{
+				Err:        err,
+				StatusCode: http.StatusServiceUnavailable,
+			}
+		}
+	}
+	return a.audit(
+		idAdmin,
+		models.AUDIT_DELETE_COMMENT,
+		models.AUDIT_ENTITY_COMMENT,
+		idObjComment,
+		reason,
+	)
+}
+
+func (*AdminService) GetAudits(page int) ([]models.AuditRes, *res.ErrorRes) {
+	var audits []models.AuditRes
+
+	cursor, err := auditModel.Use().Aggregate(db.Ctx, mongo.Pipeline{
+		bson.D{{
+			Key:   "$sort",
+			Value: bson.M{"date": -1},
+		}},
+		bson.D{{
+			Key:   "$skip",
+			Value: int64(page * 20),
+		}},
+		bson.D{{
+			Key:   "$limit",
+			Value: 20,
+		}},
+		bson.D{{
+			Key: "$lookup",
+			Value: bson.M{
+				"from":         models.USERS_COLLECTION,
+				"localField":   "admin",
+				"foreignField": "_id",
+				"as":           "admin",
+				"pipeline": bson.A{bson.M{
+					"$project": bson.M{"username": 1, "full_name": 1},
+				}},
+			},
+		}},
+		bson.D{{
+			Key: "$unwind",
+			Value: bson.M{
+				"path": "$admin",
+			},
+		}},
+	})
+	if err != nil {
+		return nil, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	if err := cursor.All(db.Ctx, &audits); err != nil {
+		return nil, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	return audits, nil
+}
+
+func NewAdminService() *AdminService {
+	return &AdminService{}
+}
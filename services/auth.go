@@ -15,7 +15,11 @@ import (
 
 type AuthService struct{}
 
-func (auth *AuthService) Login(loginForm *forms.LoginForm) (map[string]interface{}, *res.ErrorRes) {
+func (auth *AuthService) Login(
+	loginForm *forms.LoginForm,
+	userAgent,
+	ip string,
+) (map[string]interface{}, *res.ErrorRes) {
 	user, errRes := userService.FindByEmail(loginForm.Email)
 	if errRes != nil {
 		return nil, errRes
@@ -36,19 +40,97 @@ func (auth *AuthService) Login(loginForm *forms.LoginForm) (map[string]interface
 			StatusCode: http.StatusUnauthorized,
 		}
 	}
-	// Create tokens
-	tokenStr, refreshTokenStr, errRes := signToken(
+	// Two factor
+	if user.TwoFactor != nil && user.TwoFactor.Enabled {
+		challengeToken, _, errRes := signChallengeToken(user.ID)
+		if errRes != nil {
+			return nil, errRes
+		}
+		return map[string]interface{}{
+			"two_factor":      true,
+			"challenge_token": challengeToken,
+		}, nil
+	}
+
+	return auth.newSession(user, userAgent, ip)
+}
+
+func (auth *AuthService) LoginTwoFactor(
+	twoFactorForm *forms.TwoFactorLoginForm,
+	userAgent,
+	ip string,
+) (map[string]interface{}, *res.ErrorRes) {
+	errUnauthorized := &res.ErrorRes{
+		Err:        errors.New("el desafío no es válido o expiró"),
+		StatusCode: http.StatusUnauthorized,
+	}
+	token, err := parseToken(twoFactorForm.ChallengeToken, "2fa")
+	if err != nil {
+		return nil, errUnauthorized
+	}
+	claims, _ := ExtractTokenMetadata(token)
+	// User
+	user, errRes := twoFactorService.getUser(claims.UserID)
+	if errRes != nil {
+		return nil, errRes
+	}
+	if !user.Status || user.TwoFactor == nil || !user.TwoFactor.Enabled {
+		return nil, errUnauthorized
+	}
+	// A challenge only opens one session, it is claimed before checking
+	// the code so a replay can not burn a recovery code
+	firstUse, err := mem.SetNX(
+		TWO_FACTOR_CHALLENGE_USED+claims.ID,
+		"1",
+		CHALLENGE_TOKEN_DURATION,
+	)
+	if err != nil {
+		return nil, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	if !firstUse {
+		return nil, errUnauthorized
+	}
+	valid, errRes := twoFactorService.checkCode(user, twoFactorForm.Code, true)
+	if errRes != nil || !valid {
+		// The challenge can be tried again
+		mem.Delete(TWO_FACTOR_CHALLENGE_USED + claims.ID)
+	}
+	if errRes != nil {
+		return nil, errRes
+	}
+	if !valid {
+		return nil, &res.ErrorRes{
+			Err:        errors.New("el código no es válido"),
+			StatusCode: http.StatusUnauthorized,
+		}
+	}
+
+	return auth.newSession(user, userAgent, ip)
+}
+
+func (auth *AuthService) newSession(
+	user *models.User,
+	userAgent,
+	ip string,
+) (map[string]interface{}, *res.ErrorRes) {
+	// Create session
+	tokens, errRes := sessionService.NewSession(
 		user.ID,
 		user.Role,
 		user.FullName,
+		userAgent,
+		ip,
 	)
 	if errRes != nil {
 		return nil, errRes
 	}
 	// Make response
 	response := make(map[string]interface{})
-	response["token"] = tokenStr
-	response["refresh_token"] = refreshTokenStr
+	response["token"] = tokens.Token
+	response["refresh_token"] = tokens.RefreshToken
 	response["user"] = map[string]string{
 		"name":  user.FullName,
 		"email": user.Email,
@@ -59,10 +141,10 @@ func (auth *AuthService) Login(loginForm *forms.LoginForm) (map[string]interface
 	return response, nil
 }
 
-func (auth *AuthService) RefreshToken(r *http.Request) (string, *res.ErrorRes) {
+func (auth *AuthService) RefreshToken(r *http.Request) (map[string]interface{}, *res.ErrorRes) {
 	token, err := VerifyToken(r, "refresh")
 	if err != nil {
-		return "", &res.ErrorRes{
+		return nil, &res.ErrorRes{
 			Err:        err,
 			StatusCode: http.StatusUnauthorized,
 		}
@@ -72,7 +154,7 @@ func (auth *AuthService) RefreshToken(r *http.Request) (string, *res.ErrorRes) {
 
 	idObjectUser, err := primitive.ObjectIDFromHex(claims.UserID)
 	if err != nil {
-		return "", &res.ErrorRes{
+		return nil, &res.ErrorRes{
 			Err:        err,
 			StatusCode: http.StatusBadRequest,
 		}
@@ -85,22 +167,42 @@ func (auth *AuthService) RefreshToken(r *http.Request) (string, *res.ErrorRes) {
 		Value: idObjectUser,
 	}})
 	if err := cursor.Decode(&user); err != nil {
-		return "", &res.ErrorRes{
+		return nil, &res.ErrorRes{
 			Err:        err,
 			StatusCode: http.StatusServiceUnavailable,
 		}
 	}
-	// Create tokens
-	tokenStr, _, errRes := signToken(
+	// Rotate tokens
+	tokens, errRes := sessionService.Rotate(
+		claims.ID,
 		idObjectUser,
 		user.Role,
 		user.FullName,
 	)
 	if errRes != nil {
-		return "", errRes
+		return nil, errRes
 	}
 
-	return tokenStr, nil
+	return map[string]interface{}{
+		"token":         tokens.Token,
+		"refresh_token": tokens.RefreshToken,
+	}, nil
+}
+
+func (auth *AuthService) Logout(claims *Claims) *res.ErrorRes {
+	return sessionService.RevokeByAccess(claims.ID)
+}
+
+func (auth *AuthService) LogoutAll(claims *Claims) *res.ErrorRes {
+	return sessionService.RevokeAll(claims.UserID)
+}
+
+func (auth *AuthService) GetSessions(claims *Claims) ([]*SessionRes, *res.ErrorRes) {
+	return sessionService.GetSessions(claims)
+}
+
+func (auth *AuthService) DeleteSession(claims *Claims, idSession string) *res.ErrorRes {
+	return sessionService.RevokeSession(claims, idSession)
 }
 
 func NewAuthService() *AuthService {
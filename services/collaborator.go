@@ -0,0 +1,647 @@
+package services
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/CPU-commits/USACH.dev-Server/db"
+	"github.com/CPU-commits/USACH.dev-Server/forms"
+	"github.com/CPU-commits/USACH.dev-Server/models"
+	"github.com/CPU-commits/USACH.dev-Server/res"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type CollaboratorService struct{}
+
+// Each permission includes the ones below it
+var permissionLevels = map[string]int{
+	models.COLLABORATOR_READ:  1,
+	models.COLLABORATOR_WRITE: 2,
+	models.COLLABORATOR_ADMIN: 3,
+	models.COLLABORATOR_OWNER: 4,
+}
+
+// GetPermission returns the permission of the user over the repository,
+// empty if the user is neither the owner nor an accepted collaborator
+func (*CollaboratorService) GetPermission(
+	idObjRepository,
+	idObjUser primitive.ObjectID,
+) (string, *res.ErrorRes) {
+	opts := options.FindOne().SetProjection(bson.D{{
+		Key:   "owner",
+		Value: 1,
+	}})
+	repository, err := repoService.GetRepositoryById(idObjRepository, opts)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return "", &res.ErrorRes{
+				Err:        errors.New("no existe el repositorio"),
+				StatusCode: http.StatusNotFound,
+			}
+		}
+		return "", &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	if repository.Owner == idObjUser {
+		return models.COLLABORATOR_OWNER, nil
+	}
+	var collaborator *models.Collaborator
+
+	cursor := collaboratorModel.Use().FindOne(db.Ctx, bson.D{
+		{
+			Key:   "repository",
+			Value: idObjRepository,
+		},
+		{
+			Key:   "user",
+			Value: idObjUser,
+		},
+		{
+			Key:   "status",
+			Value: models.COLLABORATOR_ACCEPTED,
+		},
+	})
+	if err := cursor.Decode(&collaborator); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return "", nil
+		}
+		return "", &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	return collaborator.Role, nil
+}
+
+// CheckPermission is the only permission check over repositories,
+// permission is one of the collaborator roles or COLLABORATOR_OWNER
+func (c *CollaboratorService) CheckPermission(
+	idObjRepository,
+	idObjUser primitive.ObjectID,
+	permission string,
+) *res.ErrorRes {
+	userPermission, errRes := c.GetPermission(idObjRepository, idObjUser)
+	if errRes != nil {
+		return errRes
+	}
+	if permissionLevels[userPermission] < permissionLevels[permission] {
+		return &res.ErrorRes{
+			Err:        errors.New("no tienes permisos sobre el repositorio"),
+			StatusCode: http.StatusUnauthorized,
+		}
+	}
+	return nil
+}
+
+func (*CollaboratorService) IsCollaborator(
+	idObjRepository,
+	idObjUser primitive.ObjectID,
+) (bool, error) {
+	return collaboratorModel.Exists(bson.D{
+		{
+			Key:   "repository",
+			Value: idObjRepository,
+		},
+		{
+			Key:   "user",
+			Value: idObjUser,
+		},
+		{
+			Key:   "status",
+			Value: models.COLLABORATOR_ACCEPTED,
+		},
+	})
+}
+
+// GetCollaborations returns the repositories where the user collaborates
+func (*CollaboratorService) GetCollaborations(
+	idObjUser primitive.ObjectID,
+) ([]interface{}, *res.ErrorRes) {
+	repositories, err := collaboratorModel.Use().Distinct(db.Ctx, "repository", bson.D{
+		{
+			Key:   "user",
+			Value: idObjUser,
+		},
+		{
+			Key:   "status",
+			Value: models.COLLABORATOR_ACCEPTED,
+		},
+	})
+	if err != nil {
+		return nil, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	// Used inside $in, it can't be null
+	if repositories == nil {
+		repositories = []interface{}{}
+	}
+	return repositories, nil
+}
+
+func (c *CollaboratorService) GetCollaborators(
+	idRepository,
+	idUser string,
+) ([]models.CollaboratorRes, *res.ErrorRes) {
+	idObjRepository, err := primitive.ObjectIDFromHex(idRepository)
+	if err != nil {
+		return nil, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	idObjUser, err := primitive.ObjectIDFromHex(idUser)
+	if err != nil {
+		return nil, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	errRes := c.CheckPermission(
+		idObjRepository,
+		idObjUser,
+		models.COLLABORATOR_READ,
+	)
+	if errRes != nil {
+		return nil, errRes
+	}
+	// Get collaborators
+	collaborators := []models.CollaboratorRes{}
+
+	cursor, err := collaboratorModel.Use().Aggregate(db.Ctx, mongo.Pipeline{
+		bson.D{{
+			Key: "$match",
+			Value: bson.M{
+				"repository": idObjRepository,
+			},
+		}},
+		bson.D{{
+			Key:   "$sort",
+			Value: bson.M{"date": 1},
+		}},
+		bson.D{{
+			Key: "$lookup",
+			Value: bson.M{
+				"from":         models.USERS_COLLECTION,
+				"localField":   "user",
+				"foreignField": "_id",
+				"as":           "user",
+				"pipeline": bson.A{bson.M{
+					"$project": bson.M{"username": 1, "full_name": 1},
+				}},
+			},
+		}},
+		bson.D{{
+			Key: "$unwind",
+			Value: bson.M{
+				"path": "$user",
+			},
+		}},
+	})
+	if err != nil {
+		return nil, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	if err := cursor.All(db.Ctx, &collaborators); err != nil {
+		return nil, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	return collaborators, nil
+}
+
+// checkManage checks the user can give or take away the role. Admins
+// manage read and write collaborators, only the owner manages admins
+func (c *CollaboratorService) checkManage(
+	idObjRepository,
+	idObjUser primitive.ObjectID,
+	roles ...string,
+) *res.ErrorRes {
+	permission := models.COLLABORATOR_ADMIN
+	for _, role := range roles {
+		if role == models.COLLABORATOR_ADMIN {
+			permission = models.COLLABORATOR_OWNER
+		}
+	}
+	return c.CheckPermission(idObjRepository, idObjUser, permission)
+}
+
+func (*CollaboratorService) getCollaborator(
+	idObjRepository primitive.ObjectID,
+	idCollaborator string,
+) (*models.Collaborator, *res.ErrorRes) {
+	idObjCollaborator, err := primitive.ObjectIDFromHex(idCollaborator)
+	if err != nil {
+		return nil, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	var collaborator *models.Collaborator
+
+	cursor := collaboratorModel.Use().FindOne(db.Ctx, bson.D{
+		{
+			Key:   "repository",
+			Value: idObjRepository,
+		},
+		{
+			Key:   "user",
+			Value: idObjCollaborator,
+		},
+	})
+	if err := cursor.Decode(&collaborator); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, &res.ErrorRes{
+				Err:        errors.New("el usuario no es colaborador del repositorio"),
+				StatusCode: http.StatusNotFound,
+			}
+		}
+		return nil, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	return collaborator, nil
+}
+
+func (c *CollaboratorService) InviteCollaborator(
+	idRepository,
+	idUser string,
+	collaboratorForm *forms.CollaboratorForm,
+) (primitive.ObjectID, *res.ErrorRes) {
+	idObjRepository, err := primitive.ObjectIDFromHex(idRepository)
+	if err != nil {
+		return primitive.NilObjectID, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	idObjUser, err := primitive.ObjectIDFromHex(idUser)
+	if err != nil {
+		return primitive.NilObjectID, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	errRes := c.checkManage(idObjRepository, idObjUser, collaboratorForm.Role)
+	if errRes != nil {
+		return primitive.NilObjectID, errRes
+	}
+	// Get invited user
+	user, errRes := userService.GetByUsername(collaboratorForm.Username, false)
+	if errRes != nil {
+		return primitive.NilObjectID, errRes
+	}
+	if user == nil {
+		return primitive.NilObjectID, &res.ErrorRes{
+			Err:        errors.New("no existe el usuario"),
+			StatusCode: http.StatusNotFound,
+		}
+	}
+	// The owner always has every permission
+	isOwner, err := repoService.IsRepoOwner(user.ID, idObjRepository)
+	if err != nil {
+		return primitive.NilObjectID, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	if isOwner {
+		return primitive.NilObjectID, &res.ErrorRes{
+			Err:        errors.New("el usuario es dueño del repositorio"),
+			StatusCode: http.StatusConflict,
+		}
+	}
+	exists, err := collaboratorModel.Exists(bson.D{
+		{
+			Key:   "repository",
+			Value: idObjRepository,
+		},
+		{
+			Key:   "user",
+			Value: user.ID,
+		},
+	})
+	if err != nil {
+		return primitive.NilObjectID, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	if exists {
+		return primitive.NilObjectID, &res.ErrorRes{
+			Err:        errors.New("el usuario ya es colaborador o tiene una invitación pendiente"),
+			StatusCode: http.StatusConflict,
+		}
+	}
+	// Insert
+	collaborator := collaboratorModel.NewModel(
+		idObjRepository,
+		user.ID,
+		idObjUser,
+		collaboratorForm.Role,
+	)
+	inserted, err := collaboratorModel.Use().InsertOne(db.Ctx, collaborator)
+	if err != nil {
+		return primitive.NilObjectID, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	return inserted.InsertedID.(primitive.ObjectID), nil
+}
+
+func (c *CollaboratorService) UpdateCollaboratorRole(
+	idRepository,
+	idCollaborator,
+	idUser string,
+	roleForm *forms.CollaboratorRoleForm,
+) *res.ErrorRes {
+	idObjRepository, err := primitive.ObjectIDFromHex(idRepository)
+	if err != nil {
+		return &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	idObjUser, err := primitive.ObjectIDFromHex(idUser)
+	if err != nil {
+		return &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	collaborator, errRes := c.getCollaborator(idObjRepository, idCollaborator)
+	if errRes != nil {
+		return errRes
+	}
+	errRes = c.checkManage(
+		idObjRepository,
+		idObjUser,
+		collaborator.Role,
+		roleForm.Role,
+	)
+	if errRes != nil {
+		return errRes
+	}
+	// Update
+	_, err = collaboratorModel.Use().UpdateByID(db.Ctx, collaborator.ID, bson.D{{
+		Key: "$set",
+		Value: bson.M{
+			"role": roleForm.Role,
+		},
+	}})
+	if err != nil {
+		return &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	return nil
+}
+
+// RemoveCollaborator removes a collaborator or cancels the invitation,
+// collaborators can always leave the repository
+func (c *CollaboratorService) RemoveCollaborator(
+	idRepository,
+	idCollaborator,
+	idUser string,
+) *res.ErrorRes {
+	idObjRepository, err := primitive.ObjectIDFromHex(idRepository)
+	if err != nil {
+		return &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	idObjUser, err := primitive.ObjectIDFromHex(idUser)
+	if err != nil {
+		return &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	collaborator, errRes := c.getCollaborator(idObjRepository, idCollaborator)
+	if errRes != nil {
+		return errRes
+	}
+	if collaborator.User != idObjUser {
+		errRes = c.checkManage(idObjRepository, idObjUser, collaborator.Role)
+		if errRes != nil {
+			return errRes
+		}
+	}
+	// Delete
+	_, err = collaboratorModel.Use().DeleteOne(db.Ctx, bson.D{{
+		Key:   "_id",
+		Value: collaborator.ID,
+	}})
+	if err != nil {
+		return &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	return nil
+}
+
+func (*CollaboratorService) DeleteRepositoryCollaborators(
+	idObjRepository primitive.ObjectID,
+) *res.ErrorRes {
+	_, err := collaboratorModel.Use().DeleteMany(db.Ctx, bson.D{{
+		Key:   "repository",
+		Value: idObjRepository,
+	}})
+	if err != nil {
+		return &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	return nil
+}
+
+func (*CollaboratorService) GetInvitations(
+	idUser string,
+) ([]models.InvitationRes, *res.ErrorRes) {
+	idObjUser, err := primitive.ObjectIDFromHex(idUser)
+	if err != nil {
+		return nil, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	userProject := bson.A{bson.M{
+		"$project": bson.M{"username": 1, "full_name": 1},
+	}}
+	invitations := []models.InvitationRes{}
+
+	cursor, err := collaboratorModel.Use().Aggregate(db.Ctx, mongo.Pipeline{
+		bson.D{{
+			Key: "$match",
+			Value: bson.M{
+				"user":   idObjUser,
+				"status": models.COLLABORATOR_PENDING,
+			},
+		}},
+		bson.D{{
+			Key:   "$sort",
+			Value: bson.M{"date": -1},
+		}},
+		bson.D{{
+			Key: "$lookup",
+			Value: bson.M{
+				"from":         models.REPOSITORY_COLLECTION,
+				"localField":   "repository",
+				"foreignField": "_id",
+				"as":           "repository",
+				"pipeline": bson.A{
+					bson.M{"$lookup": bson.M{
+						"from":         models.USERS_COLLECTION,
+						"localField":   "owner",
+						"foreignField": "_id",
+						"as":           "owner",
+						"pipeline":     userProject,
+					}},
+					bson.M{"$unwind": bson.M{"path": "$owner"}},
+					bson.M{"$project": bson.M{"name": 1, "owner": 1}},
+				},
+			},
+		}},
+		bson.D{{
+			Key: "$unwind",
+			Value: bson.M{
+				"path": "$repository",
+			},
+		}},
+		bson.D{{
+			Key: "$lookup",
+			Value: bson.M{
+				"from":         models.USERS_COLLECTION,
+				"localField":   "invited_by",
+				"foreignField": "_id",
+				"as":           "invited_by",
+				"pipeline":     userProject,
+			},
+		}},
+		bson.D{{
+			Key: "$unwind",
+			Value: bson.M{
+				"path": "$invited_by",
+			},
+		}},
+	})
+	if err != nil {
+		return nil, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	if err := cursor.All(db.Ctx, &invitations); err != nil {
+		return nil, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	return invitations, nil
+}
+
+func (*CollaboratorService) invitationFilter(
+	idInvitation,
+	idUser string,
+) (bson.D, *res.ErrorRes) {
+	idObjInvitation, err := primitive.ObjectIDFromHex(idInvitation)
+	if err != nil {
+		return nil, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	idObjUser, err := primitive.ObjectIDFromHex(idUser)
+	if err != nil {
+		return nil, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	return bson.D{
+		{
+			Key:   "_id",
+			Value: idObjInvitation,
+		},
+		{
+			Key:   "user",
+			Value: idObjUser,
+		},
+		{
+			Key:   "status",
+			Value: models.COLLABORATOR_PENDING,
+		},
+	}, nil
+}
+
+func (c *CollaboratorService) AcceptInvitation(
+	idInvitation,
+	idUser string,
+) *res.ErrorRes {
+	filter, errRes := c.invitationFilter(idInvitation, idUser)
+	if errRes != nil {
+		return errRes
+	}
+	result, err := collaboratorModel.Use().UpdateOne(db.Ctx, filter, bson.D{{
+		Key: "$set",
+		Value: bson.M{
+			"status": models.COLLABORATOR_ACCEPTED,
+		},
+	}})
+	if err != nil {
+		return &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	if result.MatchedCount == 0 {
+		return &res.ErrorRes{
+			Err:        errors.New("no existe la invitación"),
+			StatusCode: http.StatusNotFound,
+		}
+	}
+	return nil
+}
+
+func (c *CollaboratorService) DeclineInvitation(
+	idInvitation,
+	idUser string,
+) *res.ErrorRes {
+	filter, errRes := c.invitationFilter(idInvitation, idUser)
+	if errRes != nil {
+		return errRes
+	}
+	result, err := collaboratorModel.Use().DeleteOne(db.Ctx, filter)
+	if err != nil {
+		return &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	if result.DeletedCount == 0 {
+		return &res.ErrorRes{
+			Err:        errors.New("no existe la invitación"),
+			StatusCode: http.StatusNotFound,
+		}
+	}
+	return nil
+}
+
+func NewCollaboratorService() *CollaboratorService {
+	return &CollaboratorService{}
+}
@@ -3,7 +3,6 @@ package services
 import (
 	"context"
 	"errors"
-	"io"
 	"mime/multipart"
 	"net/http"
 	"sync"
@@ -378,18 +377,22 @@ func (*DiscussionService) HasAccess(
 func (d *DiscussionService) GetImage(
 	idDiscussion,
 	image string,
-	w io.Writer,
-) *res.ErrorRes {
+) (*utils.ServedFile, *res.ErrorRes) {
 	// ObjectId
 	idObjDiscussion, err := primitive.ObjectIDFromHex(idDiscussion)
 	if err != nil {
-		return &res.ErrorRes{
+		return nil, &res.ErrorRes{
 			Err:        err,
 			StatusCode: http.StatusBadRequest,
 		}
 	}
+	var discussion *models.Discussion
 
-	existsDis, err := discussionModel.Exists(bson.D{
+	opts := options.FindOne().SetProjection(bson.D{{
+		Key:   "created_at",
+		Value: 1,
+	}})
+	cursor := discussionModel.Use().FindOne(db.Ctx, bson.D{
 		{
 			Key:   "_id",
 			Value: idObjDiscussion,
@@ -398,30 +401,25 @@ func (d *DiscussionService) GetImage(
 			Key:   "image",
 			Value: image,
 		},
-	})
-	if err != nil {
-		return &res.ErrorRes{
-			Err:        err,
-			StatusCode: http.StatusServiceUnavailable,
-		}
-	}
-	if !existsDis {
-		return &res.ErrorRes{
-			Err:        errors.New("no existe el repositorio o la imagen"),
-			StatusCode: http.StatusNotFound,
+	}, opts)
+	if err := cursor.Decode(&discussion); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, &res.ErrorRes{
+				Err:        errors.New("no existe el repositorio o la imagen"),
+				StatusCode: http.StatusNotFound,
+			}
 		}
-	}
-	// Read Image
-	fileImage, err := utils.GetFile(image)
-	if err != nil {
-		return &res.ErrorRes{
+		return nil, &res.ErrorRes{
 			Err:        err,
-			StatusCode: http.StatusInternalServerError,
+			StatusCode: http.StatusServiceUnavailable,
 		}
 	}
-	w.Write(fileImage)
-
-	return nil
+	// The image never changes
+	return &utils.ServedFile{
+		NameFile: image,
+		Hash:     image,
+		Modified: discussion.CreatedAt.Time(),
+	}, nil
 }
 
 func (d *DiscussionService) UploadDiscussion(
@@ -438,30 +436,32 @@ func (d *DiscussionService) UploadDiscussion(
 	}
 	if discussion.Repository != "" {
 		idObjRepository, _ := primitive.ObjectIDFromHex(discussion.Repository)
-		isOwner, err := repoService.IsRepoOwner(idObjUser, idObjRepository)
+		errRes := collaboratorService.CheckPermission(
+			idObjRepository,
+			idObjUser,
+			models.COLLABORATOR_WRITE,
+		)
+		if errRes != nil {
+			return errRes
+		}
+	}
+	// Upload image
+	var imageName string
+	if image != nil {
+		storedFile, err := storedFileService.Upload(image)
 		if err != nil {
 			return &res.ErrorRes{
 				Err:        err,
-				StatusCode: http.StatusServiceUnavailable,
-			}
-		}
-		if !isOwner {
-			return &res.ErrorRes{
-				Err:        errors.New("no eres dueño del repositorio o no existe"),
-				StatusCode: http.StatusUnauthorized,
+				StatusCode: http.StatusInternalServerError,
 			}
 		}
+		imageName = storedFile.Name
 	}
 	// Model
-	modelDis, err := discussionModel.NewModel(discussion, idObjUser, image)
-	if err != nil {
-		return &res.ErrorRes{
-			Err:        err,
-			StatusCode: http.StatusInternalServerError,
-		}
-	}
+	modelDis := discussionModel.NewModel(discussion, idObjUser, imageName)
 	_, err = discussionModel.Use().InsertOne(db.Ctx, modelDis)
 	if err != nil {
+		storedFileService.Unref(imageName)
 		return &res.ErrorRes{
 			Err:        err,
 			StatusCode: http.StatusServiceUnavailable,
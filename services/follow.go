@@ -0,0 +1,481 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/CPU-commits/USACH.dev-Server/db"
+	"github.com/CPU-commits/USACH.dev-Server/models"
+	"github.com/CPU-commits/USACH.dev-Server/res"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const FEED_LIMIT = 20
+
+type FollowService struct{}
+
+func (*FollowService) getUserID(username string) (primitive.ObjectID, *res.ErrorRes) {
+	user, errRes := userService.GetByUsername(username, false)
+	if errRes != nil {
+		return primitive.NilObjectID, errRes
+	}
+	if user == nil {
+		return primitive.NilObjectID, &res.ErrorRes{
+			Err:        errors.New("no existe el usuario"),
+			StatusCode: http.StatusNotFound,
+		}
+	}
+	return user.ID, nil
+}
+
+func (*FollowService) CountFollows(idUser primitive.ObjectID) (followers, following int64, err error) {
+	followers, err = followsModel.Use().CountDocuments(db.Ctx, bson.D{{
+		Key:   "followed_user",
+		Value: idUser,
+	}})
+	if err != nil {
+		return
+	}
+	following, err = followsModel.Use().CountDocuments(db.Ctx, bson.D{{
+		Key:   "follower_user",
+		Value: idUser,
+	}})
+	return
+}
+
+func (f *FollowService) Follow(idUser, username string) *res.ErrorRes {
+	idObjUser, err := primitive.ObjectIDFromHex(idUser)
+	if err != nil {
+		return &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	idObjFollowed, errRes := f.getUserID(username)
+	if errRes != nil {
+		return errRes
+	}
+	if idObjFollowed == idObjUser {
+		return &res.ErrorRes{
+			Err:        errors.New("no puedes seguirte a ti mismo"),
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	// Upsert, following twice does nothing
+	follow := followsModel.NewModel(idObjFollowed, idObjUser)
+	_, err = followsModel.Use().UpdateOne(
+		db.Ctx,
+		bson.D{
+			{
+				Key:   "followed_user",
+				Value: idObjFollowed,
+			},
+			{
+				Key:   "follower_user",
+				Value: idObjUser,
+			},
+		},
+		bson.D{{
+			Key:   "$setOnInsert",
+			Value: follow,
+		}},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		return &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	return nil
+}
+
+func (f *FollowService) Unfollow(idUser, username string) *res.ErrorRes {
+	idObjUser, err := primitive.ObjectIDFromHex(idUser)
+	if err != nil {
+		return &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	idObjFollowed, errRes := f.getUserID(username)
+	if errRes != nil {
+		return errRes
+	}
+	result, err := followsModel.Use().DeleteOne(db.Ctx, bson.D{
+		{
+			Key:   "followed_user",
+			Value: idObjFollowed,
+		},
+		{
+			Key:   "follower_user",
+			Value: idObjUser,
+		},
+	})
+	if err != nil {
+		return &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	if result.DeletedCount == 0 {
+		return &res.ErrorRes{
+			Err:        errors.New("no sigues a este usuario"),
+			StatusCode: http.StatusNotFound,
+		}
+	}
+	return nil
+}
+
+func (f *FollowService) IsFollowing(idUser string, idFollowed primitive.ObjectID) (bool, *res.ErrorRes) {
+	idObjUser, err := primitive.ObjectIDFromHex(idUser)
+	if err != nil {
+		return false, nil
+	}
+	var follow *models.Follows
+
+	cursor := followsModel.Use().FindOne(db.Ctx, bson.D{
+		{
+			Key:   "followed_user",
+			Value: idFollowed,
+		},
+		{
+			Key:   "follower_user",
+			Value: idObjUser,
+		},
+	})
+	if err := cursor.Decode(&follow); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return false, nil
+		}
+		return false, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	return true, nil
+}
+
+// getFollows returns the followers of the user, or the users followed by
+// them when followers is false
+func (f *FollowService) getFollows(
+	username string,
+	page int,
+	followers bool,
+) ([]models.SimpleUser, int64, *res.ErrorRes) {
+	idObjUser, errRes := f.getUserID(username)
+	if errRes != nil {
+		return nil, 0, errRes
+	}
+	matchKey, userKey := "followed_user", "follower_user"
+	if !followers {
+		matchKey, userKey = userKey, matchKey
+	}
+	var users []models.SimpleUser
+
+	cursor, err := followsModel.Use().Aggregate(db.Ctx, mongo.Pipeline{
+		bson.D{{
+			Key:   "$match",
+			Value: bson.M{matchKey: idObjUser},
+		}},
+		bson.D{{
+			Key:   "$sort",
+			Value: bson.M{"date": -1},
+		}},
+		bson.D{{
+			Key:   "$skip",
+			Value: int64(page * 20),
+		}},
+		bson.D{{
+			Key:   "$limit",
+			Value: 20,
+		}},
+		bson.D{{
+			Key: "$lookup",
+			Value: bson.M{
+				"from":         models.USERS_COLLECTION,
+				"localField":   userKey,
+				"foreignField": "_id",
+				"as":           "user",
+				"pipeline": bson.A{bson.M{
+					"$project": bson.M{"username": 1, "full_name": 1},
+				}},
+			},
+		}},
+		bson.D{{
+			Key: "$unwind",
+			Value: bson.M{
+				"path": "$user",
+			},
+		}},
+		bson.D{{
+			Key: "$replaceRoot",
+			Value: bson.M{
+				"newRoot": "$user",
+			},
+		}},
+	})
+	if err != nil {
+		return nil, 0, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	if err := cursor.All(db.Ctx, &users); err != nil {
+		return nil, 0, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	total, err := followsModel.Use().CountDocuments(db.Ctx, bson.D{{
+		Key:   matchKey,
+		Value: idObjUser,
+	}})
+	if err != nil {
+		return nil, 0, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	return users, total, nil
+}
+
+func (f *FollowService) GetFollowers(
+	username string,
+	page int,
+) ([]models.SimpleUser, int64, *res.ErrorRes) {
+	return f.getFollows(username, page, true)
+}
+
+func (f *FollowService) GetFollowing(
+	username string,
+	page int,
+) ([]models.SimpleUser, int64, *res.ErrorRes) {
+	return f.getFollows(username, page, false)
+}
+
+// Feed cursor has the form <unix millis>_<id of the last item>
+func (*FollowService) parseFeedCursor(cursor string) (bson.D, *res.ErrorRes) {
+	errRes := &res.ErrorRes{
+		Err:        errors.New("cursor inválido"),
+		StatusCode: http.StatusBadRequest,
+	}
+	parts := strings.Split(cursor, "_")
+	if len(parts) != 2 {
+		return nil, errRes
+	}
+	millis, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return nil, errRes
+	}
+	idObjLast, err := primitive.ObjectIDFromHex(parts[1])
+	if err != nil {
+		return nil, errRes
+	}
+	date := primitive.NewDateTimeFromTime(time.UnixMilli(millis))
+
+	return bson.D{{
+		Key: "$match",
+		Value: bson.M{
+			"$or": bson.A{
+				bson.M{"date": bson.M{"$lt": date}},
+				bson.M{"date": date, "_id": bson.M{"$lt": idObjLast}},
+			},
+		},
+	}}, nil
+}
+
+// repoAccessFilter matches repositories, under prefix, visible to the user
+func (*FollowService) repoAccessFilter(prefix string, idObjUser primitive.ObjectID) bson.A {
+	return bson.A{
+		bson.M{prefix + "access": "public"},
+		bson.M{
+			prefix + "access":        "private-group",
+			prefix + "custom_access": idObjUser,
+		},
+	}
+}
+
+func (f *FollowService) GetFeed(
+	idUser,
+	cursor string,
+) ([]models.FeedItem, string, *res.ErrorRes) {
+	idObjUser, err := primitive.ObjectIDFromHex(idUser)
+	if err != nil {
+		return nil, "", &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	// Followed users
+	followed, err := followsModel.Use().Distinct(db.Ctx, "followed_user", bson.D{{
+		Key:   "follower_user",
+		Value: idObjUser,
+	}})
+	if err != nil {
+		return nil, "", &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	feed := []models.FeedItem{}
+	if len(followed) == 0 {
+		return feed, "", nil
+	}
+	// Discussions outside a repository are public
+	discussionAccess := append(
+		bson.A{bson.M{"repository": bson.M{"$exists": false}}},
+		f.repoAccessFilter("repository_access.", idObjUser)...,
+	)
+	repositoryLookup := bson.D{{
+		Key: "$lookup",
+		Value: bson.M{
+			"from":         models.REPOSITORY_COLLECTION,
+			"localField":   "repository",
+			"foreignField": "_id",
+			"as":           "repository_access",
+			"pipeline": bson.A{bson.M{
+				"$project": bson.M{"access": 1, "custom_access": 1},
+			}},
+		},
+	}}
+	pipeline := mongo.Pipeline{
+		// Repositories
+		bson.D{{
+			Key: "$match",
+			Value: bson.M{
+				"owner": bson.M{"$in": followed},
+				"$or":   f.repoAccessFilter("", idObjUser),
+			},
+		}},
+		bson.D{{
+			Key: "$project",
+			Value: bson.M{
+				"type":  models.FEED_REPOSITORY,
+				"actor": "$owner",
+				"title": "$name",
+				"text":  "$description",
+				"date":  "$created_date",
+			},
+		}},
+		// Discussions
+		bson.D{{
+			Key: "$unionWith",
+			Value: bson.M{
+				"coll": models.DISCUSSION_COLLECTION,
+				"pipeline": bson.A{
+					bson.M{"$match": bson.M{"owner": bson.M{"$in": followed}}},
+					repositoryLookup,
+					bson.M{"$match": bson.M{"$or": discussionAccess}},
+					bson.M{"$project": bson.M{
+						"type":  models.FEED_DISCUSSION,
+						"actor": "$owner",
+						"title": "$title",
+						"text":  "$snippet",
+						"date":  "$created_at",
+					}},
+				},
+			},
+		}},
+		// Comments
+		bson.D{{
+			Key: "$unionWith",
+			Value: bson.M{
+				"coll": models.COMMENTS_COLLECTION,
+				"pipeline": bson.A{
+					bson.M{"$match": bson.M{"author": bson.M{"$in": followed}}},
+					bson.M{"$lookup": bson.M{
+						"from":         models.DISCUSSION_COLLECTION,
+						"localField":   "discussion",
+						"foreignField": "_id",
+						"as":           "discussion_data",
+						"pipeline": bson.A{
+							repositoryLookup,
+							bson.M{"$match": bson.M{"$or": discussionAccess}},
+							bson.M{"$project": bson.M{"title": 1}},
+						},
+					}},
+					bson.M{"$unwind": bson.M{"path": "$discussion_data"}},
+					bson.M{"$project": bson.M{
+						"type":       models.FEED_COMMENT,
+						"actor":      "$author",
+						"title":      "$discussion_data.title",
+						"text":       "$comment",
+						"discussion": "$discussion",
+						"date":       "$created_at",
+					}},
+				},
+			},
+		}},
+	}
+	if cursor != "" {
+		cursorMatch, errRes := f.parseFeedCursor(cursor)
+		if errRes != nil {
+			return nil, "", errRes
+		}
+		pipeline = append(pipeline, cursorMatch)
+	}
+	pipeline = append(
+		pipeline,
+		bson.D{{
+			Key: "$sort",
+			Value: bson.D{
+				{Key: "date", Value: -1},
+				{Key: "_id", Value: -1},
+			},
+		}},
+		bson.D{{
+			Key:   "$limit",
+			Value: FEED_LIMIT,
+		}},
+		bson.D{{
+			Key: "$lookup",
+			Value: bson.M{
+				"from":         models.USERS_COLLECTION,
+				"localField":   "actor",
+				"foreignField": "_id",
+				"as":           "actor",
+				"pipeline": bson.A{bson.M{
+					"$project": bson.M{"username": 1, "full_name": 1},
+				}},
+			},
+		}},
+		bson.D{{
+			Key: "$unwind",
+			Value: bson.M{
+				"path": "$actor",
+			},
+		}},
+	)
+	result, err := repoModel.Use().Aggregate(db.Ctx, pipeline)
+	if err != nil {
+		return nil, "", &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	if err := result.All(db.Ctx, &feed); err != nil {
+		return nil, "", &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	// Next cursor
+	var next string
+	if len(feed) == FEED_LIMIT {
+		last := feed[len(feed)-1]
+		next = fmt.Sprintf("%d_%s", last.Date.Time().UnixMilli(), last.ID.Hex())
+	}
+	return feed, next, nil
+}
+
+func NewFollowService() *FollowService {
+	return &FollowService{}
+}
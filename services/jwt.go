@@ -18,6 +18,13 @@ import (
 var jwtKey = settings.GetSettings().JWT_SECRET_KEY
 var jwtKeyRefresh = settings.GetSettings().JWT_SECRET_REFRESH
 
+// Lifetimes
+const (
+	ACCESS_TOKEN_DURATION    = 15 * time.Minute
+	REFRESH_TOKEN_DURATION   = 7 * 24 * time.Hour
+	CHALLENGE_TOKEN_DURATION = 5 * time.Minute
+)
+
 // Custom claims
 type Claims struct {
 	UserID string `json:"_id"`
@@ -35,69 +42,115 @@ func extractToken(r *http.Request) string {
 	return ""
 }
 
+type signedTokens struct {
+	Token        string
+	RefreshToken string
+	AccessID     string
+	RefreshID    string
+}
+
 func signToken(
 	idUser primitive.ObjectID,
 	role string,
 	name string,
-) (tokenStr, refreshTokenStr string, errorRes *res.ErrorRes) {
+) (*signedTokens, *res.ErrorRes) {
+	now := time.Now()
+	tokens := &signedTokens{
+		AccessID:  uuid.New().String(),
+		RefreshID: uuid.New().String(),
+	}
 	// Create token access
 	claims := Claims{
 		idUser.Hex(),
 		role,
 		name,
 		jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(10 * time.Hour)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			NotBefore: jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ACCESS_TOKEN_DURATION)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
 			Issuer:    "usach.dev",
 			Subject:   "access",
-			ID:        uuid.New().String(),
+			ID:        tokens.AccessID,
 		},
 	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	// To string
 	tokenStr, err := token.SignedString([]byte(settingsData.JWT_SECRET_KEY))
 	if err != nil {
-		return "", "", &res.ErrorRes{
+		return nil, &res.ErrorRes{
 			Err:        err,
 			StatusCode: http.StatusInternalServerError,
 		}
 	}
+	tokens.Token = tokenStr
 	// Create refresh token
 	refreshToken := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
 		idUser.Hex(),
 		"",
 		"",
 		jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(10 * time.Hour)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			NotBefore: jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(now.Add(REFRESH_TOKEN_DURATION)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
 			Issuer:    "usach.dev",
 			Subject:   "refresh",
-			ID:        uuid.New().String(),
+			ID:        tokens.RefreshID,
 		},
 	})
 	// To string
-	refreshTokenStr, err = refreshToken.SignedString([]byte(settingsData.JWT_SECRET_REFRESH))
+	refreshTokenStr, err := refreshToken.SignedString([]byte(settingsData.JWT_SECRET_REFRESH))
+	if err != nil {
+		return nil, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusInternalServerError,
+		}
+	}
+	tokens.RefreshToken = refreshTokenStr
+
+	return tokens, nil
+}
+
+// Short lived token proving the password step of a two factor login
+func signChallengeToken(idUser primitive.ObjectID) (string, string, *res.ErrorRes) {
+	now := time.Now()
+	id := uuid.New().String()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
+		idUser.Hex(),
+		"",
+		"",
+		jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(now.Add(CHALLENGE_TOKEN_DURATION)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			Issuer:    "usach.dev",
+			Subject:   "2fa",
+			ID:        id,
+		},
+	})
+	tokenStr, err := token.SignedString([]byte(settingsData.JWT_SECRET_KEY))
 	if err != nil {
 		return "", "", &res.ErrorRes{
 			Err:        err,
 			StatusCode: http.StatusInternalServerError,
 		}
 	}
-	return
+	return tokenStr, id, nil
 }
 
 func VerifyToken(r *http.Request, kind string) (*jwt.Token, error) {
-	tokenString := extractToken(r)
+	return parseToken(extractToken(r), kind)
+}
+
+func parseToken(tokenString, kind string) (*jwt.Token, error) {
 	token, err := jwt.Parse(tokenString, func(t *jwt.Token) (interface{}, error) {
 		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
 		}
-		if kind == "access" {
-			return []byte(jwtKey), nil
+		if kind == "refresh" {
+			return []byte(jwtKeyRefresh), nil
 		}
-		return []byte(jwtKeyRefresh), nil
+		return []byte(jwtKey), nil
 	})
 	if token == nil {
 		return nil, errors.New("Unauthorized")
@@ -108,6 +161,10 @@ func VerifyToken(r *http.Request, kind string) (*jwt.Token, error) {
 	if err != nil {
 		return nil, err
 	}
+	// Access and refresh tokens are not interchangeable
+	if claims, ok := token.Claims.(jwt.MapClaims); !ok || claims["sub"] != kind {
+		return nil, errors.New("Unauthorized")
+	}
 	return token, nil
 }
 
@@ -133,8 +190,9 @@ func NewClaimsFromContext(ctx *gin.Context) (*Claims, bool) {
 		return &Claims{}, false
 	}
 	return &Claims{
-		UserID: user.(*Claims).UserID,
-		Role:   user.(*Claims).Role,
-		Name:   user.(*Claims).Name,
+		UserID:           user.(*Claims).UserID,
+		Role:             user.(*Claims).Role,
+		Name:             user.(*Claims).Name,
+		RegisteredClaims: user.(*Claims).RegisteredClaims,
 	}, true
 }
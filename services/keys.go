@@ -2,3 +2,19 @@ package services
 
 // Repository
 const REPOSITORY_VIEW = "REPOSITORY_VIEW"
+
+// Session
+const (
+	SESSION              = "SESSION"
+	SESSION_ACCESS       = "SESSION_ACCESS"
+	SESSION_REFRESH      = "SESSION_REFRESH"
+	SESSION_REFRESH_USED = "SESSION_REFRESH_USED"
+	USER_SESSIONS        = "USER_SESSIONS"
+)
+
+// Two factor
+const (
+	TWO_FACTOR_CHALLENGE_USED = "TWO_FACTOR_CHALLENGE_USED"
+	TWO_FACTOR_ATTEMPTS       = "TWO_FACTOR_ATTEMPTS"
+	TWO_FACTOR_STEP_USED      = "TWO_FACTOR_STEP_USED"
+)
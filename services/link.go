@@ -1,12 +1,12 @@
 package services
 
 import (
-	"errors"
 	"fmt"
 	"net/http"
 
 	"github.com/CPU-commits/USACH.dev-Server/db"
 	"github.com/CPU-commits/USACH.dev-Server/forms"
+	"github.com/CPU-commits/USACH.dev-Server/models"
 	"github.com/CPU-commits/USACH.dev-Server/res"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -33,19 +33,14 @@ func (l *LinkService) AddLink(
 			StatusCode: http.StatusBadRequest,
 		}
 	}
-	// Check repo owner
-	isRepoOwner, err := repoService.IsRepoOwner(idObjUser, idObjRepository)
-	if err != nil {
-		return primitive.NilObjectID, &res.ErrorRes{
-			Err:        err,
-			StatusCode: http.StatusServiceUnavailable,
-		}
-	}
-	if !isRepoOwner {
-		return primitive.NilObjectID, &res.ErrorRes{
-			Err:        errors.New("no eres dueño del repositorio o no existe"),
-			StatusCode: http.StatusUnauthorized,
-		}
+	// Check permission
+	errRes := collaboratorService.CheckPermission(
+		idObjRepository,
+		idObjUser,
+		models.COLLABORATOR_WRITE,
+	)
+	if errRes != nil {
+		return primitive.NilObjectID, errRes
 	}
 	// Create link
 	newLink := repoModel.NewLinkModel(link)
@@ -92,19 +87,14 @@ func (l *LinkService) DeleteLink(
 			StatusCode: http.StatusBadRequest,
 		}
 	}
-	// Repo owner
-	exists, err := repoService.IsRepoOwner(idObjUser, idObjRepository)
-	if err != nil {
-		return &res.ErrorRes{
-			Err:        err,
-			StatusCode: http.StatusServiceUnavailable,
-		}
-	}
-	if !exists {
-		return &res.ErrorRes{
-			Err:        errors.New("el repositorio no te pertenece o no existe"),
-			StatusCode: http.StatusUnauthorized,
-		}
+	// Check permission
+	errRes := collaboratorService.CheckPermission(
+		idObjRepository,
+		idObjUser,
+		models.COLLABORATOR_WRITE,
+	)
+	if errRes != nil {
+		return errRes
 	}
 	// Delete link
 	fmt.Printf("idObjLink: %v\n", idObjLink)
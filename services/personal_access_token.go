@@ -0,0 +1,323 @@
+package services
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/CPU-commits/USACH.dev-Server/db"
+	"github.com/CPU-commits/USACH.dev-Server/forms"
+	"github.com/CPU-commits/USACH.dev-Server/models"
+	"github.com/CPU-commits/USACH.dev-Server/res"
+	"github.com/CPU-commits/USACH.dev-Server/utils"
+	jwt "github.com/golang-jwt/jwt/v4"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type PersonalAccessTokenService struct{}
+
+func IsPersonalAccessToken(r *http.Request) bool {
+	return strings.HasPrefix(extractToken(r), models.PERSONAL_ACCESS_TOKEN_PREFIX)
+}
+
+func (*PersonalAccessTokenService) hasScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+		// Write implies read
+		if s == models.SCOPE_REPO_WRITE && scope == models.SCOPE_REPO_READ {
+			return true
+		}
+	}
+	return false
+}
+
+// checkScopes fails if a scope is not one of models.TOKEN_SCOPES
+func (*PersonalAccessTokenService) checkScopes(scopes []string) *res.ErrorRes {
+	for _, scope := range scopes {
+		match, _ := utils.AnyMatch(models.TOKEN_SCOPES, func(x interface{}) bool {
+			return x.(string) == scope
+		})
+		if !match {
+			return &res.ErrorRes{
+				Err:        errors.New("no existe el permiso " + scope),
+				StatusCode: http.StatusBadRequest,
+			}
+		}
+	}
+	return nil
+}
+
+func (p *PersonalAccessTokenService) Authenticate(
+	r *http.Request,
+	scope string,
+) (*Claims, *res.ErrorRes) {
+	errUnauthorized := &res.ErrorRes{
+		Err:        errors.New("Unauthorized"),
+		StatusCode: http.StatusUnauthorized,
+	}
+	// Find token
+	var token *models.PersonalAccessToken
+
+	cursor := personalAccessTokenModel.Use().FindOne(db.Ctx, bson.D{{
+		Key:   "token",
+		Value: personalAccessTokenModel.HashToken(extractToken(r)),
+	}})
+	if err := cursor.Decode(&token); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, errUnauthorized
+		}
+		return nil, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	now := time.Now()
+	if now.After(token.ExpiresAt.Time()) {
+		return nil, errUnauthorized
+	}
+	if !p.hasScope(token.Scopes, scope) {
+		return nil, &res.ErrorRes{
+			Err:        errors.New("el token no tiene el permiso " + scope),
+			StatusCode: http.StatusForbidden,
+		}
+	}
+	// Owner
+	var user *models.User
+
+	cursor = userModel.Use().FindOne(db.Ctx, bson.D{{
+		Key:   "_id",
+		Value: token.User,
+	}})
+	if err := cursor.Decode(&user); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, errUnauthorized
+		}
+		return nil, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	if !user.Status {
+		return nil, errUnauthorized
+	}
+	// Last used
+	_, err := personalAccessTokenModel.Use().UpdateByID(db.Ctx, token.ID, bson.D{{
+		Key: "$set",
+		Value: bson.M{
+			"last_used_at": primitive.NewDateTimeFromTime(now),
+		},
+	}})
+	if err != nil {
+		return nil, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+
+	return &Claims{
+		UserID: user.ID.Hex(),
+		Role:   user.Role,
+		Name:   user.FullName,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(token.ExpiresAt.Time()),
+			Issuer:    "usach.dev",
+			Subject:   "pat",
+			ID:        token.ID.Hex(),
+		},
+	}, nil
+}
+
+func (*PersonalAccessTokenService) GetTokens(
+	idUser string,
+) ([]*models.PersonalAccessToken, *res.ErrorRes) {
+	idObjUser, err := primitive.ObjectIDFromHex(idUser)
+	if err != nil {
+		return nil, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	var tokens []*models.PersonalAccessToken
+
+	opts := options.Find().SetSort(bson.D{{
+		Key:   "created_at",
+		Value: -1,
+	}})
+	cursor, err := personalAccessTokenModel.Use().Find(db.Ctx, bson.D{{
+		Key:   "user",
+		Value: idObjUser,
+	}}, opts)
+	if err != nil {
+		return nil, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	if err := cursor.All(db.Ctx, &tokens); err != nil {
+		return nil, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+
+	return tokens, nil
+}
+
+func (p *PersonalAccessTokenService) CreateToken(
+	idUser string,
+	tokenForm *forms.PersonalAccessTokenForm,
+) (map[string]interface{}, *res.ErrorRes) {
+	idObjUser, err := primitive.ObjectIDFromHex(idUser)
+	if err != nil {
+		return nil, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	if errRes := p.checkScopes(tokenForm.Scopes); errRes != nil {
+		return nil, errRes
+	}
+	expiresAt := time.Now().Add(time.Duration(tokenForm.ExpiresIn) * 24 * time.Hour)
+	modelToken, token, err := personalAccessTokenModel.NewModel(
+		idObjUser,
+		tokenForm.Name,
+		tokenForm.Scopes,
+		expiresAt,
+	)
+	if err != nil {
+		return nil, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusInternalServerError,
+		}
+	}
+	insertedToken, err := personalAccessTokenModel.Use().InsertOne(db.Ctx, modelToken)
+	if err != nil {
+		return nil, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+
+	return map[string]interface{}{
+		"_id":        insertedToken.InsertedID,
+		"token":      token,
+		"expires_at": modelToken.ExpiresAt,
+	}, nil
+}
+
+func (p *PersonalAccessTokenService) UpdateToken(
+	idUser,
+	idToken string,
+	tokenForm *forms.UpdatePersonalAccessTokenForm,
+) *res.ErrorRes {
+	idObjUser, err := primitive.ObjectIDFromHex(idUser)
+	if err != nil {
+		return &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	idObjToken, err := primitive.ObjectIDFromHex(idToken)
+	if err != nil {
+		return &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	if errRes := p.checkScopes(tokenForm.Scopes); errRes != nil {
+		return errRes
+	}
+	// Update
+	update := bson.D{}
+	if tokenForm.Name != "" {
+		update = append(update, bson.E{
+			Key:   "name",
+			Value: tokenForm.Name,
+		})
+	}
+	if tokenForm.Scopes != nil {
+		update = append(update, bson.E{
+			Key:   "scopes",
+			Value: tokenForm.Scopes,
+		})
+	}
+	if len(update) == 0 {
+		return nil
+	}
+	result, err := personalAccessTokenModel.Use().UpdateOne(db.Ctx, bson.D{
+		{
+			Key:   "_id",
+			Value: idObjToken,
+		},
+		{
+			Key:   "user",
+			Value: idObjUser,
+		},
+	}, bson.D{{
+		Key:   "$set",
+		Value: update,
+	}})
+	if err != nil {
+		return &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	if result.MatchedCount == 0 {
+		return &res.ErrorRes{
+			Err:        errors.New("no existe el token"),
+			StatusCode: http.StatusNotFound,
+		}
+	}
+	return nil
+}
+
+func (*PersonalAccessTokenService) DeleteToken(idUser, idToken string) *res.ErrorRes {
+	idObjUser, err := primitive.ObjectIDFromHex(idUser)
+	if err != nil {
+		return &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	idObjToken, err := primitive.ObjectIDFromHex(idToken)
+	if err != nil {
+		return &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	result, err := personalAccessTokenModel.Use().DeleteOne(db.Ctx, bson.D{
+		{
+			Key:   "_id",
+			Value: idObjToken,
+		},
+		{
+			Key:   "user",
+			Value: idObjUser,
+		},
+	})
+	if err != nil {
+		return &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	if result.DeletedCount == 0 {
+		return &res.ErrorRes{
+			Err:        errors.New("no existe el token"),
+			StatusCode: http.StatusNotFound,
+		}
+	}
+	return nil
+}
+
+func NewPersonalAccessTokenService() *PersonalAccessTokenService {
+	return &PersonalAccessTokenService{}
+}
@@ -1,14 +1,11 @@
 package services
 
 import (
-	"archive/zip"
 	"context"
 	"errors"
 	"fmt"
 	"io"
-	"mime"
 	"net/http"
-	"strings"
 	"sync"
 	"time"
 
@@ -45,54 +42,14 @@ func (r *RepositoryService) IsRepoOwner(idUser, idRepo primitive.ObjectID) (bool
 	return isOwner, nil
 }
 
-func (*RepositoryService) isChildDirectory(idChild string) (bool, *res.ErrorRes) {
-	idObjChild, err := primitive.ObjectIDFromHex(idChild)
-	if err != nil {
-		return false, &res.ErrorRes{
-			Err:        err,
-			StatusCode: http.StatusBadRequest,
-		}
-	}
-
-	exists, err := systemFileModel.Exists(bson.D{{
-		Key:   "_id",
-		Value: idObjChild,
-	}})
-	if err != nil {
-		return false, &res.ErrorRes{
-			Err:        err,
-			StatusCode: http.StatusServiceUnavailable,
-		}
-	}
-	if !exists {
-		return false, &res.ErrorRes{
-			Err:        errors.New("no existe el elemento"),
-			StatusCode: http.StatusNotFound,
-		}
-	}
-	isDirectory, err := systemFileModel.Exists(bson.D{
-		{
-			Key:   "_id",
-			Value: idObjChild,
-		},
-		{
-			Key:   "is_directory",
-			Value: true,
-		},
-	})
-	if err != nil {
-		return false, &res.ErrorRes{
-			Err:        err,
-			StatusCode: http.StatusServiceUnavailable,
-		}
-	}
-	return isDirectory, nil
-}
-
 func (r *RepositoryService) GetRepoAccess(
 	idRepository primitive.ObjectID,
 ) (map[string]interface{}, *res.ErrorRes) {
 	opts := options.FindOne().SetProjection(bson.D{
+		{
+			Key:   "owner",
+			Value: 1,
+		},
 		{
 			Key:   "access",
 			Value: 1,
@@ -118,6 +75,7 @@ func (r *RepositoryService) GetRepoAccess(
 	}
 	// Response
 	response := map[string]interface{}{
+		"owner":         repository.Owner,
 		"access":        repository.Access,
 		"custom_access": repository.CustomAccess,
 	}
@@ -125,6 +83,24 @@ func (r *RepositoryService) GetRepoAccess(
 	return response, nil
 }
 
+// CheckRepoAccess fails if the user can not see the repository
+func (r *RepositoryService) CheckRepoAccess(
+	idObjRepository primitive.ObjectID,
+	idUser string,
+) *res.ErrorRes {
+	hasAccess, errRes := r.HasRepoAccess(idObjRepository, idUser)
+	if errRes != nil {
+		return errRes
+	}
+	if !hasAccess {
+		return &res.ErrorRes{
+			Err:        errors.New("no tienes acceso a este repositorio"),
+			StatusCode: http.StatusUnauthorized,
+		}
+	}
+	return nil
+}
+
 func (r *RepositoryService) HasRepoAccess(
 	idObjRepository primitive.ObjectID,
 	idUser string,
@@ -134,16 +110,32 @@ func (r *RepositoryService) HasRepoAccess(
 	if errRes != nil {
 		return false, errRes
 	}
-	if repoAccess["access"] == "private-group" {
-		idObjUser, err := primitive.ObjectIDFromHex(idUser)
-		if err != nil {
-			return false, nil
+	if repoAccess["access"] == "public" {
+		return true, nil
+	}
+	// Anonymous users only see public repositories
+	idObjUser, err := primitive.ObjectIDFromHex(idUser)
+	if err != nil {
+		return false, nil
+	}
+	if repoAccess["owner"] == idObjUser {
+		return true, nil
+	}
+	isCollaborator, err := collaboratorService.IsCollaborator(idObjRepository, idObjUser)
+	if err != nil {
+		return false, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
 		}
-
+	}
+	if isCollaborator {
+		return true, nil
+	}
+	if repoAccess["access"] == "private-group" {
 		hasAccess, err := utils.AnyMatch(
 			repoAccess["custom_access"],
 			func(x interface{}) bool {
-				return x.(primitive.ObjectID) != idObjUser
+				return x.(primitive.ObjectID) == idObjUser
 			},
 		)
 		if err != nil {
@@ -154,19 +146,35 @@ func (r *RepositoryService) HasRepoAccess(
 		}
 		return hasAccess, nil
 	}
-	return true, nil
+	return false, nil
 }
 
 func (r *RepositoryService) GetRepositoryId(
 	username,
 	repoName string,
 ) (*primitive.ObjectID, *res.ErrorRes) {
+	idRepository, _, errRes := r.ResolveRepository(username, repoName)
+	return idRepository, errRes
+}
+
+// ResolveRepository returns the repository ID and, only if the path is an
+// old one, where the repository lives now
+func (r *RepositoryService) ResolveRepository(
+	username,
+	repoName string,
+) (*primitive.ObjectID, *models.RepositoryPath, *res.ErrorRes) {
 	var repository *models.Repository
 
 	// Get username
 	user, errRes := userService.GetByUsername(username, false)
 	if errRes != nil {
-		return nil, errRes
+		return nil, nil, errRes
+	}
+	if user == nil {
+		return nil, nil, &res.ErrorRes{
+			Err:        errors.New("no existe el repositorio"),
+			StatusCode: http.StatusNotFound,
+		}
 	}
 
 	cursor := repoModel.Use().FindOne(db.Ctx, bson.D{
@@ -179,20 +187,84 @@ func (r *RepositoryService) GetRepositoryId(
 			Value: repoName,
 		},
 	})
-	if err := cursor.Decode(&repository); err != nil {
+	err := cursor.Decode(&repository)
+	if err == nil {
+		return &repository.ID, nil, nil
+	}
+	// Old path of a renamed or transferred repository
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		cursor = repoModel.Use().FindOne(db.Ctx, r.redirectFilter(user.ID, repoName))
+		err = cursor.Decode(&repository)
+	}
+	if err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
-			return nil, &res.ErrorRes{
+			return nil, nil, &res.ErrorRes{
 				Err:        errors.New("no existe el repositorio"),
 				StatusCode: http.StatusNotFound,
 			}
 		}
-		return nil, &res.ErrorRes{
+		return nil, nil, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	// Current path
+	var owner *models.User
+
+	opts := options.FindOne().SetProjection(bson.D{{
+		Key:   "username",
+		Value: 1,
+	}})
+	cursor = userModel.Use().FindOne(db.Ctx, bson.D{{
+		Key:   "_id",
+		Value: repository.Owner,
+	}}, opts)
+	if err := cursor.Decode(&owner); err != nil {
+		return nil, nil, &res.ErrorRes{
 			Err:        err,
 			StatusCode: http.StatusServiceUnavailable,
 		}
 	}
 
-	return &repository.ID, nil
+	return &repository.ID, &models.RepositoryPath{
+		Username: owner.Username,
+		Name:     repository.Name,
+	}, nil
+}
+
+func (*RepositoryService) redirectFilter(owner primitive.ObjectID, name string) bson.D {
+	return bson.D{{
+		Key: "redirects",
+		Value: bson.M{
+			"$elemMatch": bson.M{
+				"owner": owner,
+				"name":  name,
+			},
+		},
+	}}
+}
+
+// removeRedirect frees the path so only one repository redirects from it
+func (r *RepositoryService) removeRedirect(
+	owner primitive.ObjectID,
+	name string,
+) *res.ErrorRes {
+	_, err := repoModel.Use().UpdateMany(db.Ctx, r.redirectFilter(owner, name), bson.D{{
+		Key: "$pull",
+		Value: bson.M{
+			"redirects": bson.M{
+				"owner": owner,
+				"name":  name,
+			},
+		},
+	}})
+	if err != nil {
+		return &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	return nil
 }
 
 func (r *RepositoryService) GetRepositoryById(
@@ -212,35 +284,6 @@ func (r *RepositoryService) GetRepositoryById(
 	return repository, nil
 }
 
-func (*RepositoryService) getChildName(idChild string) (string, *res.ErrorRes) {
-	idObjChild, err := primitive.ObjectIDFromHex(idChild)
-	if err != nil {
-		return "", &res.ErrorRes{
-			Err:        err,
-			StatusCode: http.StatusBadRequest,
-		}
-	}
-
-	opts := options.FindOne().SetProjection(bson.D{{
-		Key:   "name",
-		Value: 1,
-	}})
-	cursor := systemFileModel.Use().FindOne(
-		db.Ctx,
-		bson.D{{Key: "_id", Value: idObjChild}},
-		opts,
-	)
-	var child *models.SystemFile
-	if err := cursor.Decode(&child); err != nil {
-		return "", &res.ErrorRes{
-			Err:        err,
-			StatusCode: http.StatusServiceUnavailable,
-		}
-	}
-
-	return child.Name, nil
-}
-
 func (r *RepositoryService) addView(idUser string, idRepository primitive.ObjectID) error {
 	_, err := mem.Get(REPOSITORY_VIEW + idUser)
 	if err != nil {
@@ -322,6 +365,72 @@ func (r *RepositoryService) GetRepository(
 			},
 		}},
 		bson.D{{Key: "$unwind", Value: bson.M{"path": "$owner"}}},
+		bson.D{{
+			Key: "$lookup",
+			Value: bson.M{
+				"from":         models.REPOSITORY_COLLECTION,
+				"localField":   "upstream",
+				"foreignField": "_id",
+				"as":           "upstream_repository",
+				"pipeline": bson.A{
+					bson.M{"$lookup": bson.M{
+						"from":         models.USERS_COLLECTION,
+						"localField":   "owner",
+						"foreignField": "_id",
+						"as":           "owner",
+						"pipeline": bson.A{bson.M{
+							"$project": bson.M{
+								"username":  1,
+								"full_name": 1,
+							},
+						}},
+					}},
+					bson.M{"$unwind": bson.M{"path": "$owner"}},
+					bson.M{"$project": bson.M{"name": 1, "owner": 1}},
+				},
+			},
+		}},
+		bson.D{{
+			Key: "$unwind",
+			Value: bson.M{
+				"path":                       "$upstream_repository",
+				"preserveNullAndEmptyArrays": true,
+			},
+		}},
+		bson.D{{
+			Key: "$lookup",
+			Value: bson.M{
+				"from":         models.SNAPSHOT_COLLECTION,
+				"localField":   "_id",
+				"foreignField": "repository",
+				"as":           "snapshots",
+				"pipeline": bson.A{
+					bson.M{"$sort": bson.M{"date": -1}},
+					bson.M{"$lookup": bson.M{
+						"from":         models.USERS_COLLECTION,
+						"localField":   "author",
+						"foreignField": "_id",
+						"as":           "author",
+						"pipeline": bson.A{bson.M{
+							"$project": bson.M{
+								"username":  1,
+								"full_name": 1,
+							},
+						}},
+					}},
+					bson.M{"$unwind": bson.M{
+						"path":                       "$author",
+						"preserveNullAndEmptyArrays": true,
+					}},
+					bson.M{"$project": bson.M{
+						"tag":    1,
+						"notes":  1,
+						"author": 1,
+						"date":   1,
+					}},
+				},
+			},
+		}},
 	}, opts)
 	if err != nil {
 		return nil, nil, &res.ErrorRes{
@@ -335,6 +444,17 @@ func (r *RepositoryService) GetRepository(
 			StatusCode: http.StatusServiceUnavailable,
 		}
 	}
+	// Forks
+	repository[0].Forks, err = repoModel.Use().CountDocuments(db.Ctx, bson.D{{
+		Key:   "upstream",
+		Value: repository[0].ID,
+	}})
+	if err != nil {
+		return nil, nil, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
 	// Get like
 	var like *models.Like
 
@@ -371,12 +491,20 @@ func (r *RepositoryService) GetRepositories(
 		bson.M{"access": "public"},
 	}
 	if idUser != "" {
-		orFilter = append(orFilter, bson.M{
-			"access": "private-group",
-			"custom_access": bson.M{
-				"$in": bson.A{idObjUser},
+		collaborations, errRes := collaboratorService.GetCollaborations(idObjUser)
+		if errRes != nil {
+			return nil, 0, errRes
+		}
+		orFilter = append(
+			orFilter,
+			bson.M{
+				"access": "private-group",
+				"custom_access": bson.M{
+					"$in": bson.A{idObjUser},
+				},
 			},
-		})
+			bson.M{"_id": bson.M{"$in": collaborations}},
+		)
 	}
 
 	andFilter := bson.A{bson.D{{
@@ -563,17 +691,25 @@ func (r *RepositoryService) GetUserRepositories(
 		Value: user.ID,
 	}}
 	if !isUserOwner {
-		filter = append(filter, bson.E{
-			Key: "$or",
-			Value: bson.A{
-				bson.M{"access": "public"},
-				bson.M{
-					"access": "private-group",
-					"custom_access": bson.M{
-						"$in": bson.A{idObjUser},
-					},
+		orFilter := bson.A{
+			bson.M{"access": "public"},
+			bson.M{
+				"access": "private-group",
+				"custom_access": bson.M{
+					"$in": bson.A{idObjUser},
 				},
 			},
+		}
+		if idUser != "" {
+			collaborations, errRes := collaboratorService.GetCollaborations(idObjUser)
+			if errRes != nil {
+				return nil, errRes
+			}
+			orFilter = append(orFilter, bson.M{"_id": bson.M{"$in": collaborations}})
+		}
+		filter = append(filter, bson.E{
+			Key:   "$or",
+			Value: orFilter,
 		})
 	}
 	cursor, err := repoModel.Use().Find(db.Ctx, filter, opts)
@@ -593,38 +729,91 @@ func (r *RepositoryService) GetUserRepositories(
 	return repositories, nil
 }
 
-func (repositoryService *RepositoryService) GetChildFileNameAndContentType(
-	idChild string,
-) (string, string, *res.ErrorRes) {
-	childName, err := repositoryService.getChildName(idChild)
+// getDownloadChild returns the element of the repository to download
+func (r *RepositoryService) getDownloadChild(
+	idRepository,
+	idChild,
+	idUser string,
+) (*models.SystemFile, *res.ErrorRes) {
+	idObjRepository, err := primitive.ObjectIDFromHex(idRepository)
 	if err != nil {
-		return "", "", err
+		return nil, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusBadRequest,
+		}
 	}
-	split := strings.Split(childName, ".")
-	if len(split) == 1 {
-		return fmt.Sprintf("%s.zip", childName), "application/octet-stream", nil
+	if errRes := r.CheckRepoAccess(idObjRepository, idUser); errRes != nil {
+		return nil, errRes
+	}
+	child, errRes := systemFileService.GetElementById(idChild)
+	if errRes != nil {
+		return nil, errRes
 	}
+	inRepo, err := systemFileService.isElementInRepo(child, idObjRepository)
+	if err != nil {
+		return nil, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	if !inRepo {
+		return nil, &res.ErrorRes{
+			Err:        errors.New("el elemento no pertenece al repositorio"),
+			StatusCode: http.StatusUnauthorized,
+		}
+	}
+	return child, nil
+}
 
-	return childName, mime.TypeByExtension(fmt.Sprintf(".%s", split[len(split)-1])), nil
+func (r *RepositoryService) GetChildFileNameAndContentType(
+	idRepository,
+	idChild,
+	format,
+	idUser string,
+) (string, string, *res.ErrorRes) {
+	child, errRes := r.getDownloadChild(idRepository, idChild, idUser)
+	if errRes != nil {
+		return "", "", errRes
+	}
+	return fmt.Sprintf("%s.%s", child.Name, format), utils.ArchiveContentType(format), nil
+}
+
+// GetChildFile returns the file to download as it is, nil for folders
+// as they are downloaded as archives
+func (r *RepositoryService) GetChildFile(
+	idRepository,
+	idChild,
+	idUser string,
+) (*utils.ServedFile, *res.ErrorRes) {
+	child, errRes := r.getDownloadChild(idRepository, idChild, idUser)
+	if errRes != nil {
+		return nil, errRes
+	}
+	if child.IsDirectory {
+		return nil, nil
+	}
+	return systemFileService.servedFile(child, child.Content, child.Date), nil
 }
 
+// DownloadRepository streams the repository, or one of its folders, as an
+// archive
 func (r *RepositoryService) DownloadRepository(
 	repository,
-	child string,
+	child,
+	format,
+	idUser string,
 	w io.Writer,
 ) *res.ErrorRes {
-	zipWritter := zip.NewWriter(w)
-	defer zipWritter.Close()
-
 	if child != "" {
-		isDirectory, err := r.isChildDirectory(child)
-		if err != nil {
-			return err
-		}
-		if !isDirectory {
-			return systemFileService.DownloadChild(child, zipWritter, &w)
+		element, errRes := r.getDownloadChild(repository, child, idUser)
+		if errRes != nil {
+			return errRes
 		}
-		return systemFileService.DownloadChild(child, zipWritter, nil)
+		return systemFileService.writeArchive(
+			format,
+			w,
+			[]primitive.ObjectID{element.ID},
+		)
 	}
 	// Update downloads
 	idObjRepository, err := primitive.ObjectIDFromHex(repository)
@@ -634,20 +823,39 @@ func (r *RepositoryService) DownloadRepository(
 			StatusCode: http.StatusBadRequest,
 		}
 	}
-	_, err = repoModel.Use().UpdateByID(db.Ctx, idObjRepository, bson.D{{
-		Key: "$inc",
-		Value: bson.M{
-			"downloads": 1,
-		},
+	opts := options.FindOneAndUpdate().SetProjection(bson.D{{
+		Key:   "system_file",
+		Value: 1,
 	}})
-	if err != nil {
+	var repositoryData *models.Repository
+
+	cursor := repoModel.Use().FindOneAndUpdate(
+		db.Ctx,
+		bson.D{{
+			Key:   "_id",
+			Value: idObjRepository,
+		}},
+		bson.D{{
+			Key: "$inc",
+			Value: bson.M{
+				"downloads": 1,
+			},
+		}},
+		opts,
+	)
+	if err := cursor.Decode(&repositoryData); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return &res.ErrorRes{
+				Err:        errors.New("el repositorio no existe"),
+				StatusCode: http.StatusNotFound,
+			}
+		}
 		return &res.ErrorRes{
 			Err:        err,
 			StatusCode: http.StatusServiceUnavailable,
 		}
 	}
-
-	return systemFileService.DownloadRepo(repository, zipWritter)
+	return systemFileService.writeArchive(format, w, repositoryData.SystemFile)
 }
 
 func (r *RepositoryService) ExistsRepoUser(
@@ -719,39 +927,133 @@ func (r *RepositoryService) UploadRepository(
 	return nil
 }
 
-func (r *RepositoryService) UpdateRepository(
+func (r *RepositoryService) ForkRepository(
 	idRepository,
 	idUser string,
-	repositoryForm *forms.UpdateRepositoryForm,
-) *res.ErrorRes {
+	forkForm *forms.ForkRepositoryForm,
+) (map[string]interface{}, *res.ErrorRes) {
 	idObjRepository, err := primitive.ObjectIDFromHex(idRepository)
 	if err != nil {
-		return &res.ErrorRes{
+		return nil, &res.ErrorRes{
 			Err:        err,
 			StatusCode: http.StatusBadRequest,
 		}
 	}
 	idObjUser, err := primitive.ObjectIDFromHex(idUser)
 	if err != nil {
-		return &res.ErrorRes{
+		return nil, &res.ErrorRes{
 			Err:        err,
 			StatusCode: http.StatusBadRequest,
 		}
 	}
-	// Exists repository and has access
-	isRepoOwner, err := r.IsRepoOwner(idObjUser, idObjRepository)
+	// Has access
+	if errRes := r.CheckRepoAccess(idObjRepository, idUser); errRes != nil {
+		return nil, errRes
+	}
+	upstream, err := r.GetRepositoryById(idObjRepository)
 	if err != nil {
-		return &res.ErrorRes{
+		return nil, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	if upstream.Owner == idObjUser {
+		return nil, &res.ErrorRes{
+			Err:        errors.New("no puedes hacer fork de tu propio repositorio"),
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	name := upstream.Name
+	if forkForm.Name != "" {
+		name = forkForm.Name
+	}
+	existsRepo, errRes := r.ExistsRepoUser(idObjUser, name)
+	if errRes != nil {
+		return nil, errRes
+	}
+	if existsRepo {
+		return nil, &res.ErrorRes{
+			Err:        errors.New("ya existe este repositorio a tu nombre"),
+			StatusCode: http.StatusConflict,
+		}
+	}
+	// Copy elements, stored files are shared
+	systemFile, errRes := systemFileService.CopyTree(upstream.SystemFile)
+	if errRes != nil {
+		return nil, errRes
+	}
+	var links []models.Link
+	for _, link := range upstream.Links {
+		link.ID = primitive.NewObjectID()
+		links = append(links, link)
+	}
+	// Forks of restricted repositories must not widen their audience
+	access := upstream.Access
+	if access != "public" {
+		access = "private"
+	}
+	now := primitive.NewDateTimeFromTime(time.Now())
+	fork := &models.Repository{
+		Owner:       idObjUser,
+		Name:        name,
+		Tags:        upstream.Tags,
+		Content:     upstream.Content,
+		SystemFile:  systemFile,
+		Description: upstream.Description,
+		Access:      access,
+		Links:       links,
+		Upstream:    upstream.ID,
+		UpdatedDate: now,
+		CreatedDate: now,
+	}
+	insertedRepo, err := repoModel.Use().InsertOne(db.Ctx, fork)
+	if err != nil {
+		return nil, &res.ErrorRes{
 			Err:        err,
 			StatusCode: http.StatusServiceUnavailable,
 		}
 	}
-	if !isRepoOwner {
+
+	return map[string]interface{}{
+		"_id":  insertedRepo.InsertedID,
+		"name": name,
+	}, nil
+}
+
+func (r *RepositoryService) UpdateRepository(
+	idRepository,
+	idUser string,
+	repositoryForm *forms.UpdateRepositoryForm,
+) *res.ErrorRes {
+	idObjRepository, err := primitive.ObjectIDFromHex(idRepository)
+	if err != nil {
 		return &res.ErrorRes{
-			Err:        errors.New("no eres dueño del repositorio o no existe"),
-			StatusCode: http.StatusUnauthorized,
+			Err:        err,
+			StatusCode: http.StatusBadRequest,
 		}
 	}
+	idObjUser, err := primitive.ObjectIDFromHex(idUser)
+	if err != nil {
+		return &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	// Access changes and renames need admin, content changes need write
+	permission := models.COLLABORATOR_WRITE
+	if repositoryForm.Access != "" ||
+		repositoryForm.CustomAccess != nil ||
+		repositoryForm.Name != "" {
+		permission = models.COLLABORATOR_ADMIN
+	}
+	errRes := collaboratorService.CheckPermission(
+		idObjRepository,
+		idObjUser,
+		permission,
+	)
+	if errRes != nil {
+		return errRes
+	}
 	// Update repo
 	var update bson.D
 	update = append(update, bson.E{
@@ -860,10 +1162,66 @@ func (r *RepositoryService) UpdateRepository(
 		})
 	}
 
-	_, err = repoModel.Use().UpdateByID(db.Ctx, idObjRepository, bson.D{{
+	updateRepo := bson.D{}
+	// Rename, the old name redirects to the repository
+	if repositoryForm.Name != "" {
+		opts := options.FindOne().SetProjection(bson.D{
+			{
+				Key:   "owner",
+				Value: 1,
+			},
+			{
+				Key:   "name",
+				Value: 1,
+			},
+		})
+		repository, err := r.GetRepositoryById(idObjRepository, opts)
+		if err != nil {
+			return &res.ErrorRes{
+				Err:        err,
+				StatusCode: http.StatusServiceUnavailable,
+			}
+		}
+		if repository.Name != repositoryForm.Name {
+			existsRepo, errRes := r.ExistsRepoUser(repository.Owner, repositoryForm.Name)
+			if errRes != nil {
+				return errRes
+			}
+			if existsRepo {
+				return &res.ErrorRes{
+					Err: fmt.Errorf(
+						"ya existe un repositorio con el nombre %s",
+						repositoryForm.Name,
+					),
+					StatusCode: http.StatusConflict,
+				}
+			}
+			for _, name := range []string{repository.Name, repositoryForm.Name} {
+				if errRes := r.removeRedirect(repository.Owner, name); errRes != nil {
+					return errRes
+				}
+			}
+			update = append(update, bson.E{
+				Key:   "name",
+				Value: repositoryForm.Name,
+			})
+			updateRepo = append(updateRepo, bson.E{
+				Key: "$push",
+				Value: bson.M{
+					"redirects": repoModel.NewRedirectModel(
+						repository.Owner,
+						repository.Name,
+					),
+				},
+			})
+		}
+	}
+	updateRepo = append(updateRepo, bson.E{
 		Key:   "$set",
 		Value: update,
-	}})
+	})
+
+	_, err = repoModel.Use().UpdateByID(db.Ctx, idObjRepository, updateRepo)
 	if err != nil {
 		return &res.ErrorRes{
 			Err:        err,
@@ -949,33 +1307,49 @@ func (r *RepositoryService) DeleteRepository(
 			StatusCode: http.StatusBadRequest,
 		}
 	}
-	// IsRepoOwner
-	exists, err := r.IsRepoOwner(idObjUser, idObjRepository)
-	if err != nil {
-		return &res.ErrorRes{
-			Err:        err,
-			StatusCode: http.StatusServiceUnavailable,
-		}
-	}
-	if !exists {
-		return &res.ErrorRes{
-			Err:        errors.New("no eres dueño del repositorio o no existe"),
-			StatusCode: http.StatusUnauthorized,
-		}
+	// Only the owner deletes the repository
+	errRes := collaboratorService.CheckPermission(
+		idObjRepository,
+		idObjUser,
+		models.COLLABORATOR_OWNER,
+	)
+	if errRes != nil {
+		return errRes
 	}
 	// Delete repository
-	_, err = repoModel.Use().DeleteOne(db.Ctx, bson.D{{
+	var repository *models.Repository
+
+	opts := options.FindOneAndDelete().SetProjection(bson.D{{
+		Key:   "system_file",
+		Value: 1,
+	}})
+	cursor := repoModel.Use().FindOneAndDelete(db.Ctx, bson.D{{
 		Key:   "_id",
 		Value: idObjRepository,
-	}})
-	if err != nil {
+	}}, opts)
+	if err := cursor.Decode(&repository); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return &res.ErrorRes{
+				Err:        errors.New("no existe el repositorio"),
+				StatusCode: http.StatusNotFound,
+			}
+		}
 		return &res.ErrorRes{
 			Err:        err,
 			StatusCode: http.StatusServiceUnavailable,
 		}
 	}
+	if errRes := systemFileService.deleteTree(repository.SystemFile); errRes != nil {
+		return errRes
+	}
 
-	return nil
+	if errRes := collaboratorService.DeleteRepositoryCollaborators(idObjRepository); errRes != nil {
+		return errRes
+	}
+	if errRes := transferService.deleteTransfers(idObjRepository); errRes != nil {
+		return errRes
+	}
+	return snapshotService.deleteSnapshots(idObjRepository)
 }
 
 func NewRepositoryService() *RepositoryService {
@@ -17,15 +17,32 @@ var (
 	reactionModel   = models.NewReactionModel()
 	commentModel    = models.NewCommentModel()
 	profileModel    = models.NewProfileModel()
+	followsModel    = models.NewFollowsModel()
+
+	personalAccessTokenModel = models.NewPersonalAccessTokenModel()
+	auditModel               = models.NewAuditModel()
+	collaboratorModel        = models.NewCollaboratorModel()
+	transferModel            = models.NewTransferModel()
+	snapshotModel            = models.NewSnapshotModel()
+	storedFileModel          = models.NewStoredFileModel()
+	uploadModel              = models.NewUploadModel()
+	migrationModel           = models.NewMigrationModel()
 )
 
 // Services
 var (
-	userService       = NewUserService()
-	repoService       = NewRepositoryService()
-	systemFileService = NewSystemFileService()
-	likeService       = NewLikeService()
-	discussionService = NewDiscussionService()
+	userService         = NewUserService()
+	repoService         = NewRepositoryService()
+	systemFileService   = NewSystemFileService()
+	likeService         = NewLikeService()
+	discussionService   = NewDiscussionService()
+	sessionService      = NewSessionService()
+	twoFactorService    = NewTwoFactorService()
+	followService       = NewFollowService()
+	collaboratorService = NewCollaboratorService()
+	transferService     = NewTransferService()
+	snapshotService     = NewSnapshotService()
+	storedFileService   = NewStoredFileService()
 )
 
 // Settings
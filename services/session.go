@@ -0,0 +1,357 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/CPU-commits/USACH.dev-Server/res"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// A session groups every token issued from one login (the token family).
+// Only the latest refresh token of a family is valid, presenting an already
+// rotated one revokes the whole session.
+type Session struct {
+	ID         string    `json:"_id"`
+	User       string    `json:"user"`
+	AccessID   string    `json:"access_id"`
+	RefreshID  string    `json:"refresh_id"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+}
+
+// Responses
+type SessionRes struct {
+	ID         string    `json:"_id"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	Current    bool      `json:"current"`
+}
+
+type SessionService struct{}
+
+func (*SessionService) save(session *Session) error {
+	sessionJson, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	return mem.Set(SESSION+session.ID, string(sessionJson), REFRESH_TOKEN_DURATION)
+}
+
+func (*SessionService) getSession(idSession string) (*Session, error) {
+	sessionJson, err := mem.Get(SESSION + idSession)
+	if err != nil {
+		return nil, err
+	}
+	var session *Session
+	if err := json.Unmarshal([]byte(sessionJson), &session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+func (s *SessionService) issueTokens(
+	session *Session,
+	idUser primitive.ObjectID,
+	role,
+	name string,
+) (*signedTokens, *res.ErrorRes) {
+	tokens, errRes := signToken(idUser, role, name)
+	if errRes != nil {
+		return nil, errRes
+	}
+	session.AccessID = tokens.AccessID
+	session.RefreshID = tokens.RefreshID
+	session.LastUsedAt = time.Now()
+	// Store
+	if err := s.save(session); err != nil {
+		return nil, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	err := mem.Set(SESSION_ACCESS+tokens.AccessID, session.ID, ACCESS_TOKEN_DURATION)
+	if err != nil {
+		return nil, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	err = mem.Set(SESSION_REFRESH+tokens.RefreshID, session.ID, REFRESH_TOKEN_DURATION)
+	if err != nil {
+		return nil, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	// The index lives as long as the newest session
+	if err := mem.Expire(USER_SESSIONS+session.User, REFRESH_TOKEN_DURATION); err != nil {
+		return nil, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	return tokens, nil
+}
+
+func (s *SessionService) NewSession(
+	idUser primitive.ObjectID,
+	role,
+	name,
+	userAgent,
+	ip string,
+) (*signedTokens, *res.ErrorRes) {
+	now := time.Now()
+	session := &Session{
+		ID:        uuid.New().String(),
+		User:      idUser.Hex(),
+		UserAgent: userAgent,
+		IP:        ip,
+		CreatedAt: now,
+	}
+	// Index by user
+	if err := mem.SAdd(USER_SESSIONS+session.User, session.ID); err != nil {
+		return nil, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+
+	return s.issueTokens(session, idUser, role, name)
+}
+
+func (s *SessionService) Rotate(
+	idRefresh string,
+	idUser primitive.ObjectID,
+	role,
+	name string,
+) (*signedTokens, *res.ErrorRes) {
+	errUnauthorized := &res.ErrorRes{
+		Err:        errors.New("la sesión no es válida"),
+		StatusCode: http.StatusUnauthorized,
+	}
+	idSession, err := mem.Get(SESSION_REFRESH + idRefresh)
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, errUnauthorized
+		}
+		return nil, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	session, err := s.getSession(idSession)
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, errUnauthorized
+		}
+		return nil, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	// Only the first use of a refresh token is valid
+	firstUse, err := mem.SetNX(
+		SESSION_REFRESH_USED+idRefresh,
+		idSession,
+		REFRESH_TOKEN_DURATION,
+	)
+	if err != nil {
+		return nil, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	if !firstUse || session.RefreshID != idRefresh || session.User != idUser.Hex() {
+		// Reuse detected, kill the whole family
+		if err := s.revoke(session); err != nil {
+			return nil, &res.ErrorRes{
+				Err:        err,
+				StatusCode: http.StatusServiceUnavailable,
+			}
+		}
+		return nil, errUnauthorized
+	}
+	// The previous access token dies with the rotation
+	if err := mem.Delete(SESSION_ACCESS + session.AccessID); err != nil {
+		return nil, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+
+	return s.issueTokens(session, idUser, role, name)
+}
+
+func (s *SessionService) IsActive(idAccess string) (bool, error) {
+	_, err := mem.Get(SESSION_ACCESS + idAccess)
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *SessionService) GetSessions(claims *Claims) ([]*SessionRes, *res.ErrorRes) {
+	idSessions, err := mem.SMembers(USER_SESSIONS + claims.UserID)
+	if err != nil {
+		return nil, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	sessions := make([]*SessionRes, 0, len(idSessions))
+	for _, idSession := range idSessions {
+		session, err := s.getSession(idSession)
+		if err != nil {
+			if errors.Is(err, redis.Nil) {
+				// Expired, clean index
+				if err := mem.SRem(USER_SESSIONS+claims.UserID, idSession); err != nil {
+					return nil, &res.ErrorRes{
+						Err:        err,
+						StatusCode: http.StatusServiceUnavailable,
+					}
+				}
+				continue
+			}
+			return nil, &res.ErrorRes{
+				Err:        err,
+				StatusCode: http.StatusServiceUnavailable,
+			}
+		}
+		sessions = append(sessions, &SessionRes{
+			ID:         session.ID,
+			UserAgent:  session.UserAgent,
+			IP:         session.IP,
+			CreatedAt:  session.CreatedAt,
+			LastUsedAt: session.LastUsedAt,
+			Current:    session.AccessID == claims.ID,
+		})
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastUsedAt.After(sessions[j].LastUsedAt)
+	})
+
+	return sessions, nil
+}
+
+func (s *SessionService) RevokeSession(claims *Claims, idSession string) *res.ErrorRes {
+	session, err := s.getSession(idSession)
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return &res.ErrorRes{
+				Err:        errors.New("no existe la sesión"),
+				StatusCode: http.StatusNotFound,
+			}
+		}
+		return &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	if session.User != claims.UserID {
+		return &res.ErrorRes{
+			Err:        errors.New("no existe la sesión"),
+			StatusCode: http.StatusNotFound,
+		}
+	}
+	if err := s.revoke(session); err != nil {
+		return &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	return nil
+}
+
+func (s *SessionService) revoke(session *Session) error {
+	err := mem.Delete(
+		SESSION+session.ID,
+		SESSION_ACCESS+session.AccessID,
+		SESSION_REFRESH+session.RefreshID,
+	)
+	if err != nil {
+		return err
+	}
+	return mem.SRem(USER_SESSIONS+session.User, session.ID)
+}
+
+func (s *SessionService) RevokeByAccess(idAccess string) *res.ErrorRes {
+	idSession, err := mem.Get(SESSION_ACCESS + idAccess)
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil
+		}
+		return &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	session, err := s.getSession(idSession)
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil
+		}
+		return &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	if err := s.revoke(session); err != nil {
+		return &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	return nil
+}
+
+func (s *SessionService) RevokeAll(idUser string) *res.ErrorRes {
+	idSessions, err := mem.SMembers(USER_SESSIONS + idUser)
+	if err != nil {
+		return &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	for _, idSession := range idSessions {
+		session, err := s.getSession(idSession)
+		if err != nil {
+			if errors.Is(err, redis.Nil) {
+				continue
+			}
+			return &res.ErrorRes{
+				Err:        err,
+				StatusCode: http.StatusServiceUnavailable,
+			}
+		}
+		if err := s.revoke(session); err != nil {
+			return &res.ErrorRes{
+				Err:        err,
+				StatusCode: http.StatusServiceUnavailable,
+			}
+		}
+	}
+	if err := mem.Delete(USER_SESSIONS + idUser); err != nil {
+		return &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	return nil
+}
+
+func NewSessionService() *SessionService {
+	return &SessionService{}
+}
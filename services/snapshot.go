@@ -0,0 +1,599 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"unicode/utf8"
+
+	"github.com/CPU-commits/USACH.dev-Server/db"
+	"github.com/CPU-commits/USACH.dev-Server/forms"
+	"github.com/CPU-commits/USACH.dev-Server/models"
+	"github.com/CPU-commits/USACH.dev-Server/res"
+	"github.com/CPU-commits/USACH.dev-Server/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type SnapshotService struct{}
+
+// Files above this size are compared without a diff
+const DIFF_SIZE_LIMIT = 512 * 1024
+
+// Size and number of the diffs of a compare, the next files have no
+// diff
+const (
+	COMPARE_DIFFS_LIMIT       = 4 * 1024 * 1024
+	COMPARE_DIFFS_FILES_LIMIT = 300
+)
+
+func (*SnapshotService) GetSnapshotByTag(
+	idRepository,
+	tag string,
+) (*models.Snapshot, *res.ErrorRes) {
+	idObjRepository, err := primitive.ObjectIDFromHex(idRepository)
+	if err != nil {
+		return nil, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	var snapshot *models.Snapshot
+
+	cursor := snapshotModel.Use().FindOne(db.Ctx, bson.D{
+		{
+			Key:   "repository",
+			Value: idObjRepository,
+		},
+		{
+			Key:   "tag",
+			Value: tag,
+		},
+	})
+	if err := cursor.Decode(&snapshot); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, &res.ErrorRes{
+				Err:        errors.New("no existe la versión del repositorio"),
+				StatusCode: http.StatusNotFound,
+			}
+		}
+		return nil, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	return snapshot, nil
+}
+
+func (*SnapshotService) CreateSnapshot(
+	idRepository,
+	idUser string,
+	snapshotForm *forms.SnapshotForm,
+) (primitive.ObjectID, *res.ErrorRes) {
+	idObjRepository, err := primitive.ObjectIDFromHex(idRepository)
+	if err != nil {
+		return primitive.NilObjectID, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	idObjUser, err := primitive.ObjectIDFromHex(idUser)
+	if err != nil {
+		return primitive.NilObjectID, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	errRes := collaboratorService.CheckPermission(
+		idObjRepository,
+		idObjUser,
+		models.COLLABORATOR_WRITE,
+	)
+	if errRes != nil {
+		return primitive.NilObjectID, errRes
+	}
+	exists, err := snapshotModel.Exists(bson.D{
+		{
+			Key:   "repository",
+			Value: idObjRepository,
+		},
+		{
+			Key:   "tag",
+			Value: snapshotForm.Tag,
+		},
+	})
+	if err != nil {
+		return primitive.NilObjectID, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	if exists {
+		return primitive.NilObjectID, &res.ErrorRes{
+			Err:        fmt.Errorf("ya existe la versión %s", snapshotForm.Tag),
+			StatusCode: http.StatusConflict,
+		}
+	}
+	repository, err := repoService.GetRepositoryById(idObjRepository)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return primitive.NilObjectID, &res.ErrorRes{
+				Err:        errors.New("no existe el repositorio"),
+				StatusCode: http.StatusNotFound,
+			}
+		}
+		return primitive.NilObjectID, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	// Freeze tree
+	systemFile, errRes := systemFileService.CopyTree(repository.SystemFile)
+	if errRes != nil {
+		return primitive.NilObjectID, errRes
+	}
+	snapshot := snapshotModel.NewModel(
+		repository,
+		snapshotForm.Tag,
+		snapshotForm.Notes,
+		systemFile,
+		idObjUser,
+	)
+	inserted, err := snapshotModel.Use().InsertOne(db.Ctx, snapshot)
+	if err != nil {
+		systemFileService.deleteTree(systemFile)
+		return primitive.NilObjectID, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	return inserted.InsertedID.(primitive.ObjectID), nil
+}
+
+// GetDownloadSnapshot returns the snapshot if the user can see the
+// repository
+func (s *SnapshotService) GetDownloadSnapshot(
+	idRepository,
+	tag,
+	idUser string,
+) (*models.Snapshot, *res.ErrorRes) {
+	snapshot, errRes := s.GetSnapshotByTag(idRepository, tag)
+	if errRes != nil {
+		return nil, errRes
+	}
+	if errRes := repoService.CheckRepoAccess(snapshot.Repository, idUser); errRes != nil {
+		return nil, errRes
+	}
+	return snapshot, nil
+}
+
+func (s *SnapshotService) GetSnapshot(
+	idRepository,
+	tag,
+	idUser string,
+) (*models.SnapshotRes, *res.ErrorRes) {
+	snapshot, errRes := s.GetDownloadSnapshot(idRepository, tag, idUser)
+	if errRes != nil {
+		return nil, errRes
+	}
+	var snapshots []*models.SnapshotRes
+
+	cursor, err := snapshotModel.Use().Aggregate(db.Ctx, mongo.Pipeline{
+		bson.D{{
+			Key: "$match",
+			Value: bson.M{
+				"_id": snapshot.ID,
+			},
+		}},
+		bson.D{{
+			Key: "$lookup",
+			Value: bson.M{
+				"from":         models.SYSTEM_FILE_COLLECTION,
+				"localField":   "system_file",
+				"foreignField": "_id",
+				"as":           "system_file",
+				"pipeline": bson.A{
+					bson.M{"$sort": bson.D{
+						{Key: "is_directory", Value: -1},
+						{Key: "name", Value: 1},
+					}},
+					bson.M{"$project": bson.M{"versions": 0}},
+				},
+			},
+		}},
+		bson.D{{
+			Key: "$lookup",
+			Value: bson.M{
+				"from":         models.USERS_COLLECTION,
+				"localField":   "author",
+				"foreignField": "_id",
+				"as":           "author",
+				"pipeline": bson.A{bson.M{
+					"$project": bson.M{
+						"username":  1,
+						"full_name": 1,
+					},
+				}},
+			},
+		}},
+		bson.D{{
+			Key: "$unwind",
+			Value: bson.M{
+				"path":                       "$author",
+				"preserveNullAndEmptyArrays": true,
+			},
+		}},
+	})
+	if err != nil {
+		return nil, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	if err := cursor.All(db.Ctx, &snapshots); err != nil {
+		return nil, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	if len(snapshots) == 0 {
+		return nil, &res.ErrorRes{
+			Err:        errors.New("no existe la versión del repositorio"),
+			StatusCode: http.StatusNotFound,
+		}
+	}
+	return snapshots[0], nil
+}
+
+func (*SnapshotService) DownloadSnapshot(
+	snapshot *models.Snapshot,
+	format string,
+	w io.Writer,
+) *res.ErrorRes {
+	return systemFileService.writeArchive(format, w, snapshot.SystemFile)
+}
+
+func (s *SnapshotService) DeleteSnapshot(
+	idRepository,
+	tag,
+	idUser string,
+) *res.ErrorRes {
+	idObjUser, err := primitive.ObjectIDFromHex(idUser)
+	if err != nil {
+		return &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	snapshot, errRes := s.GetSnapshotByTag(idRepository, tag)
+	if errRes != nil {
+		return errRes
+	}
+	errRes = collaboratorService.CheckPermission(
+		snapshot.Repository,
+		idObjUser,
+		models.COLLABORATOR_ADMIN,
+	)
+	if errRes != nil {
+		return errRes
+	}
+	_, err = snapshotModel.Use().DeleteOne(db.Ctx, bson.D{{
+		Key:   "_id",
+		Value: snapshot.ID,
+	}})
+	if err != nil {
+		return &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	return systemFileService.deleteTree(snapshot.SystemFile)
+}
+
+func (*SnapshotService) deleteSnapshots(idObjRepository primitive.ObjectID) *res.ErrorRes {
+	var snapshots []models.Snapshot
+
+	filter := bson.D{{
+		Key:   "repository",
+		Value: idObjRepository,
+	}}
+	cursor, err := snapshotModel.Use().Find(db.Ctx, filter)
+	if err != nil {
+		return &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	if err := cursor.All(db.Ctx, &snapshots); err != nil {
+		return &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	for _, snapshot := range snapshots {
+		if errRes := systemFileService.deleteTree(snapshot.SystemFile); errRes != nil {
+			return errRes
+		}
+	}
+	_, err = snapshotModel.Use().DeleteMany(db.Ctx, filter)
+	if err != nil {
+		return &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	return nil
+}
+
+// getTree returns the roots of the snapshot, or of the current tree
+// without tag
+func (s *SnapshotService) getTree(
+	idObjRepository primitive.ObjectID,
+	tag string,
+) ([]primitive.ObjectID, *res.ErrorRes) {
+	if tag != "" {
+		snapshot, errRes := s.GetSnapshotByTag(idObjRepository.Hex(), tag)
+		if errRes != nil {
+			return nil, errRes
+		}
+		return snapshot.SystemFile, nil
+	}
+	repository, err := repoService.GetRepositoryById(idObjRepository)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, &res.ErrorRes{
+				Err:        errors.New("no existe el repositorio"),
+				StatusCode: http.StatusNotFound,
+			}
+		}
+		return nil, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	return repository.SystemFile, nil
+}
+
+// fileHash returns the hash of the content of the file, legacy files
+// are hashed once and kept in hashes
+func (*SnapshotService) fileHash(
+	file *models.SystemFile,
+	hashes map[string]string,
+) string {
+	for i := len(file.Versions) - 1; i >= 0; i-- {
+		if file.Versions[i].Content == file.Content {
+			return file.Versions[i].Hash
+		}
+	}
+	if hash, ok := hashes[file.Content]; ok {
+		return hash
+	}
+	hash, _, err := utils.HashFile(file.Content)
+	if err != nil {
+		hash = ""
+	}
+	hashes[file.Content] = hash
+	return hash
+}
+
+func (s *SnapshotService) sameContent(
+	a,
+	b *models.SystemFile,
+	hashes map[string]string,
+) bool {
+	if a.Content == b.Content {
+		return true
+	}
+	hashA := s.fileHash(a, hashes)
+	return hashA != "" && hashA == s.fileHash(b, hashes)
+}
+
+func (*SnapshotService) diffFiles(
+	change *models.FileChange,
+	from,
+	to *models.SystemFile,
+) *res.ErrorRes {
+	var texts [2]string
+	for i, file := range []*models.SystemFile{from, to} {
+		if file == nil {
+			continue
+		}
+		size, err := utils.FileSize(file.Content)
+		if err != nil {
+			return &res.ErrorRes{
+				Err:        err,
+				StatusCode: http.StatusInternalServerError,
+			}
+		}
+		if size > DIFF_SIZE_LIMIT {
+			change.DiffOmitted = models.DIFF_TOO_LARGE
+			return nil
+		}
+		data, err := utils.GetFile(file.Content)
+		if err != nil {
+			return &res.ErrorRes{
+				Err:        err,
+				StatusCode: http.StatusInternalServerError,
+			}
+		}
+		if !utf8.Valid(data) || bytes.IndexByte(data, 0) != -1 {
+			change.DiffOmitted = models.DIFF_BINARY
+			return nil
+		}
+		texts[i] = string(data)
+	}
+	fromName, toName := "/dev/null", "/dev/null"
+	if from != nil {
+		fromName = "a/" + change.Path
+		if change.OldPath != "" {
+			fromName = "a/" + change.OldPath
+		}
+	}
+	if to != nil {
+		toName = "b/" + change.Path
+	}
+	diff, err := utils.UnifiedDiff(fromName, toName, texts[0], texts[1])
+	if err != nil {
+		if errors.Is(err, utils.ErrDiffTooLarge) {
+			change.DiffOmitted = models.DIFF_TOO_LARGE
+			return nil
+		}
+		return &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusInternalServerError,
+		}
+	}
+	change.Diff = diff
+	return nil
+}
+
+// Compare lists the files that changed between two snapshots, an empty
+// tag is the current tree
+func (s *SnapshotService) Compare(
+	idObjRepository primitive.ObjectID,
+	from,
+	to,
+	idUser string,
+) (*models.CompareRes, *res.ErrorRes) {
+	if errRes := repoService.CheckRepoAccess(idObjRepository, idUser); errRes != nil {
+		return nil, errRes
+	}
+	if from == to {
+		return nil, &res.ErrorRes{
+			Err:        errors.New("las versiones a comparar son iguales"),
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	fromRoots, errRes := s.getTree(idObjRepository, from)
+	if errRes != nil {
+		return nil, errRes
+	}
+	toRoots, errRes := s.getTree(idObjRepository, to)
+	if errRes != nil {
+		return nil, errRes
+	}
+	fromFiles, errRes := systemFileService.flattenTree(fromRoots)
+	if errRes != nil {
+		return nil, errRes
+	}
+	toFiles, errRes := systemFileService.flattenTree(toRoots)
+	if errRes != nil {
+		return nil, errRes
+	}
+	// Changes
+	changes := []models.FileChange{}
+	hashes := make(map[string]string)
+	var removed, added []string
+	for path, fromFile := range fromFiles {
+		toFile, ok := toFiles[path]
+		if !ok {
+			removed = append(removed, path)
+			continue
+		}
+		if s.sameContent(fromFile, toFile, hashes) {
+			continue
+		}
+		changes = append(changes, models.FileChange{
+			Status: models.FILE_MODIFIED,
+			Path:   path,
+		})
+	}
+	for path := range toFiles {
+		if _, ok := fromFiles[path]; !ok {
+			added = append(added, path)
+		}
+	}
+	sort.Strings(removed)
+	sort.Strings(added)
+	// A removed file with the same content as an added one was renamed,
+	// removed files are indexed so every file is hashed once
+	byContent := make(map[string][]string)
+	byHash := make(map[string][]string)
+	if len(added) > 0 {
+		for _, path := range removed {
+			file := fromFiles[path]
+			byContent[file.Content] = append(byContent[file.Content], path)
+			if hash := s.fileHash(file, hashes); hash != "" {
+				byHash[hash] = append(byHash[hash], path)
+			}
+		}
+	}
+	renamed := make(map[string]bool)
+	findRenamed := func(candidates []string) string {
+		for _, path := range candidates {
+			if !renamed[path] {
+				return path
+			}
+		}
+		return ""
+	}
+	for _, path := range added {
+		toFile := toFiles[path]
+		oldPath := findRenamed(byContent[toFile.Content])
+		if oldPath == "" {
+			if hash := s.fileHash(toFile, hashes); hash != "" {
+				oldPath = findRenamed(byHash[hash])
+			}
+		}
+		change := models.FileChange{
+			Status: models.FILE_ADDED,
+			Path:   path,
+		}
+		if oldPath != "" {
+			renamed[oldPath] = true
+			change.Status = models.FILE_RENAMED
+			change.OldPath = oldPath
+		}
+		changes = append(changes, change)
+	}
+	for _, path := range removed {
+		if renamed[path] {
+			continue
+		}
+		changes = append(changes, models.FileChange{
+			Status: models.FILE_REMOVED,
+			Path:   path,
+		})
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+	// Diffs, in order until the limit of the response
+	diffsSize, diffsFiles := 0, 0
+	for i := range changes {
+		change := &changes[i]
+		if change.Status == models.FILE_RENAMED {
+			continue
+		}
+		if diffsSize >= COMPARE_DIFFS_LIMIT || diffsFiles >= COMPARE_DIFFS_FILES_LIMIT {
+			change.DiffOmitted = models.DIFF_COMPARE_TOO_LARGE
+			continue
+		}
+		var fromFile, toFile *models.SystemFile
+		if change.Status != models.FILE_ADDED {
+			fromFile = fromFiles[change.Path]
+		}
+		if change.Status != models.FILE_REMOVED {
+			toFile = toFiles[change.Path]
+		}
+		if errRes := s.diffFiles(change, fromFile, toFile); errRes != nil {
+			return nil, errRes
+		}
+		diffsSize += len(change.Diff)
+		diffsFiles++
+	}
+
+	return &models.CompareRes{
+		From:  from,
+		To:    to,
+		Files: changes,
+	}, nil
+}
+
+func NewSnapshotService() *SnapshotService {
+	return &SnapshotService{}
+}
@@ -0,0 +1,461 @@
+package services
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"mime/multipart"
+	"strings"
+	"time"
+
+	"github.com/CPU-commits/USACH.dev-Server/db"
+	"github.com/CPU-commits/USACH.dev-Server/models"
+	"github.com/CPU-commits/USACH.dev-Server/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Stored files without references are kept this long before it is deleted, so
+// an upload has time to be used
+const STORED_FILE_UNREF_GRACE = time.Hour
+
+// Attempts to reference a stored file while the job deletes it, once
+// deleted it is stored again
+const (
+	STORED_FILE_DELETING_RETRIES = 5
+	STORED_FILE_DELETING_WAIT    = 200 * time.Millisecond
+)
+
+var errStoredFileDeleting = errors.New("el archivo se está eliminando, intenta nuevamente")
+
+// notDeleting filters the stored file by its name unless it is being deleted,
+// an upsert over a deleted file fails by the duplicated name
+func notDeleting(name string) bson.D {
+	return bson.D{
+		{
+			Key:   "_id",
+			Value: name,
+		},
+		{
+			Key: "deleting",
+			Value: bson.M{
+				"$ne": true,
+			},
+		},
+	}
+}
+
+type StoredFileService struct{}
+
+// ref adds a reference to the stored file, true if it did not exist
+func (m *StoredFileService) ref(name string, size int64) (bool, error) {
+	for i := 0; i < STORED_FILE_DELETING_RETRIES; i++ {
+		if i > 0 {
+			time.Sleep(STORED_FILE_DELETING_WAIT)
+		}
+		isNew, err := m.tryRef(name, size)
+		if !mongo.IsDuplicateKeyError(err) {
+			return isNew, err
+		}
+	}
+	return false, errStoredFileDeleting
+}
+
+func (*StoredFileService) tryRef(name string, size int64) (bool, error) {
+	var storedFile *models.StoredFile
+
+	opts := options.FindOneAndUpdate().SetUpsert(true)
+	cursor := storedFileModel.Use().FindOneAndUpdate(
+		db.Ctx,
+		notDeleting(name),
+		bson.D{
+			{
+				Key: "$inc",
+				Value: bson.M{
+					"refs": 1,
+				},
+			},
+			{
+				Key: "$set",
+				Value: bson.M{
+					"date": primitive.NewDateTimeFromTime(time.Now()),
+				},
+			},
+			{
+				Key: "$setOnInsert",
+				Value: bson.M{
+					"size": size,
+				},
+			},
+		},
+		opts,
+	)
+	if err := cursor.Decode(&storedFile); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return true, nil
+		}
+		return false, err
+	}
+	return false, nil
+}
+
+// Store saves the content by its SHA-256 and returns the stored file with one
+// reference, that belongs to whoever uses it. A duplicate content only
+// adds the reference
+func (m *StoredFileService) Store(r io.Reader) (*models.StoredFile, error) {
+	content, err := utils.HashContent(r)
+	if err != nil {
+		return nil, err
+	}
+	defer content.Close()
+
+	isNew, err := m.ref(content.Hash, content.Size)
+	if err != nil {
+		return nil, err
+	}
+	storedFile := storedFileModel.NewModel(content.Hash, content.Size, 1)
+	// A failed upload may have left the reference alone
+	if !isNew {
+		if _, err := utils.FileSize(storedFile.Name); err == nil {
+			return storedFile, nil
+		}
+	}
+	if err := content.Store(); err != nil {
+		m.Unref(storedFile.Name)
+		return nil, err
+	}
+	return storedFile, nil
+}
+
+func (m *StoredFileService) Upload(fileHeader *multipart.FileHeader) (*models.StoredFile, error) {
+	file, err := fileHeader.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return m.Store(file)
+}
+
+// storeAs saves data whose name comes from the hash of another content,
+// as the thumbnails of an avatar
+func (m *StoredFileService) storeAs(name string, data []byte) error {
+	isNew, err := m.ref(name, int64(len(data)))
+	if err != nil {
+		return err
+	}
+	if !isNew {
+		if _, err := utils.FileSize(name); err == nil {
+			return nil
+		}
+	}
+	if err := utils.SaveFile(name, data); err != nil {
+		m.Unref(name)
+		return err
+	}
+	return nil
+}
+
+func (*StoredFileService) incRefs(names []string, sign int) error {
+	counts := make(map[string]int)
+	for _, name := range names {
+		if name != "" {
+			counts[name]++
+		}
+	}
+	if len(counts) == 0 {
+		return nil
+	}
+	now := primitive.NewDateTimeFromTime(time.Now())
+	updates := make([]mongo.WriteModel, 0, len(counts))
+	for name, count := range counts {
+		filter := bson.D{{
+			Key:   "_id",
+			Value: name,
+		}}
+		// The content of a file being deleted is lost
+		if sign > 0 {
+			filter = notDeleting(name)
+		}
+		updates = append(updates, mongo.NewUpdateOneModel().
+			SetFilter(filter).
+			SetUpdate(bson.D{
+				{
+					Key: "$inc",
+					Value: bson.M{
+						"refs": sign * count,
+					},
+				},
+				{
+					Key: "$set",
+					Value: bson.M{
+						"date": now,
+					},
+				},
+			}).
+			SetUpsert(sign > 0),
+		)
+	}
+	_, err := storedFileModel.Use().BulkWrite(db.Ctx, updates)
+	return err
+}
+
+// Ref adds a reference to every stored file, once for each time it is given
+func (m *StoredFileService) Ref(names ...string) error {
+	return m.incRefs(names, 1)
+}
+
+// Unref removes a reference to every stored file, the job deletes the
+// ones nobody uses
+func (m *StoredFileService) Unref(names ...string) error {
+	return m.incRefs(names, -1)
+}
+
+// GetUnref returns the stored files without references after the grace time
+func (*StoredFileService) GetUnref() ([]string, error) {
+	var storedFiles []models.StoredFile
+
+	opts := options.Find().SetProjection(bson.D{{
+		Key:   "_id",
+		Value: 1,
+	}})
+	cursor, err := storedFileModel.Use().Find(db.Ctx, bson.D{
+		{
+			Key: "refs",
+			Value: bson.M{
+				"$lte": 0,
+			},
+		},
+		{
+			Key: "date",
+			Value: bson.M{
+				"$lt": primitive.NewDateTimeFromTime(time.Now().Add(-STORED_FILE_UNREF_GRACE)),
+			},
+		},
+	}, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := cursor.All(db.Ctx, &storedFiles); err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(storedFiles))
+	for _, storedFile := range storedFiles {
+		names = append(names, storedFile.Name)
+	}
+	return names, nil
+}
+
+// DeleteStoredFile deletes the file if it still has no references. The
+// document is claimed first and removed after the file, so a new upload
+// of the same content waits for it and is stored again
+func (*StoredFileService) DeleteStoredFile(name string) error {
+	// A failed deletion is claimed again
+	result, err := storedFileModel.Use().UpdateOne(
+		db.Ctx,
+		bson.D{
+			{
+				Key:   "_id",
+				Value: name,
+			},
+			{
+				Key: "refs",
+				Value: bson.M{
+					"$lte": 0,
+				},
+			},
+		},
+		bson.D{{
+			Key: "$set",
+			Value: bson.M{
+				"deleting": true,
+			},
+		}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return nil
+	}
+	if err := utils.DeleteFile(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		// The file is still there, it can be used
+		storedFileModel.Use().UpdateOne(
+			db.Ctx,
+			bson.D{{
+				Key:   "_id",
+				Value: name,
+			}},
+			bson.D{{
+				Key: "$unset",
+				Value: bson.M{
+					"deleting": "",
+				},
+			}},
+		)
+		return err
+	}
+	_, err = storedFileModel.Use().DeleteOne(db.Ctx, bson.D{
+		{
+			Key:   "_id",
+			Value: name,
+		},
+		{
+			Key:   "deleting",
+			Value: true,
+		},
+	})
+	return err
+}
+
+// countRefs counts the references of every stored file, each document
+// counts once for each different file it uses
+func (*StoredFileService) countRefs() (map[string]int, error) {
+	refs := make(map[string]int)
+
+	var files []models.SystemFile
+	opts := options.Find().SetProjection(bson.D{
+		{Key: "content", Value: 1},
+		{Key: "versions.content", Value: 1},
+	})
+	cursor, err := systemFileModel.Use().Find(db.Ctx, bson.D{{
+		Key: "content",
+		Value: bson.M{
+			"$nin": bson.A{nil, ""},
+		},
+	}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := cursor.All(db.Ctx, &files); err != nil {
+		return nil, err
+	}
+	for i := range files {
+		for _, content := range systemFileService.contents(&files[i]) {
+			refs[content]++
+		}
+	}
+
+	var discussions []models.Discussion
+	opts = options.Find().SetProjection(bson.D{{Key: "image", Value: 1}})
+	cursor, err = discussionModel.Use().Find(db.Ctx, bson.D{{
+		Key: "image",
+		Value: bson.M{
+			"$nin": bson.A{nil, ""},
+		},
+	}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := cursor.All(db.Ctx, &discussions); err != nil {
+		return nil, err
+	}
+	for _, discussion := range discussions {
+		refs[discussion.Image]++
+	}
+
+	var profiles []models.Profile
+	opts = options.Find().SetProjection(bson.D{
+		{Key: "avatar", Value: 1},
+		{Key: "avatar_sizes", Value: 1},
+	})
+	cursor, err = profileModel.Use().Find(db.Ctx, bson.D{{
+		Key: "avatar",
+		Value: bson.M{
+			"$nin": bson.A{nil, ""},
+		},
+	}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := cursor.All(db.Ctx, &profiles); err != nil {
+		return nil, err
+	}
+	for i := range profiles {
+		for _, avatar := range userService.avatarFiles(&profiles[i]) {
+			refs[avatar]++
+		}
+	}
+	return refs, nil
+}
+
+// Backfill counts the references of the files stored before reference
+// counts existed, files nobody uses are left to the job. It must run
+// before the server receives requests, the counts replace the current
+// ones. Once it is completed it does nothing
+func (m *StoredFileService) Backfill() error {
+	completed, err := migrationModel.Exists(bson.D{{
+		Key:   "_id",
+		Value: models.MIGRATION_STORED_FILE_REFS,
+	}})
+	if err != nil || completed {
+		return err
+	}
+	refs, err := m.countRefs()
+	if err != nil {
+		return err
+	}
+	err = utils.ListFiles(func(nameFile string) error {
+		if strings.HasPrefix(nameFile, UPLOAD_PART_PREFIX) {
+			return nil
+		}
+		if _, ok := refs[nameFile]; !ok {
+			refs[nameFile] = 0
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(refs) > 0 {
+		now := primitive.NewDateTimeFromTime(time.Now())
+		updates := make([]mongo.WriteModel, 0, len(refs))
+		for name, count := range refs {
+			updates = append(updates, mongo.NewUpdateOneModel().
+				SetFilter(bson.D{{
+					Key:   "_id",
+					Value: name,
+				}}).
+				SetUpdate(bson.D{
+					{
+						Key: "$set",
+						Value: bson.M{
+							"refs": count,
+							"date": now,
+						},
+					},
+					{
+						Key: "$setOnInsert",
+						Value: bson.M{
+							"size": int64(0),
+						},
+					},
+				}).
+				SetUpsert(true),
+			)
+		}
+		_, err = storedFileModel.Use().BulkWrite(
+			db.Ctx,
+			updates,
+			options.BulkWrite().SetOrdered(false),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	// Completed, a failure before runs it again from the start
+	_, err = migrationModel.Use().InsertOne(
+		db.Ctx,
+		migrationModel.NewModel(models.MIGRATION_STORED_FILE_REFS),
+	)
+	if err != nil && !mongo.IsDuplicateKeyError(err) {
+		return err
+	}
+	return nil
+}
+
+func NewStoredFileService() *StoredFileService {
+	return &StoredFileService{}
+}
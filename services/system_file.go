@@ -1,12 +1,15 @@
 package services
 
 import (
-	"archive/zip"
-	"bytes"
 	"errors"
+	"fmt"
 	"io"
+	"mime"
 	"mime/multipart"
 	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
 
 	"github.com/CPU-commits/USACH.dev-Server/db"
 	"github.com/CPU-commits/USACH.dev-Server/forms"
@@ -16,31 +19,30 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type SystemFileService struct{}
 
-func (s *SystemFileService) FileHasRef(nameFile string) (bool, error) {
-	hasRef, err := systemFileModel.Exists(bson.D{{
-		Key:   "content",
-		Value: nameFile,
-	}})
-	if err != nil {
-		return false, err
-	}
-	if hasRef {
-		return true, nil
-	}
+// Times a version is pushed again when other one was pushed first
+const PUSH_VERSION_RETRIES = 5
 
-	hasRef, err = discussionModel.Exists(bson.D{{
-		Key:   "image",
-		Value: nameFile,
-	}})
-	if err != nil {
-		return false, err
-	}
+// contents returns the stored files the element uses, once each
+func (*SystemFileService) contents(element *models.SystemFile) []string {
+	var contents []string
+	seen := make(map[string]bool)
 
-	return hasRef, nil
+	add := func(content string) {
+		if content != "" && !seen[content] {
+			seen[content] = true
+			contents = append(contents, content)
+		}
+	}
+	add(element.Content)
+	for _, version := range element.Versions {
+		add(version.Content)
+	}
+	return contents
 }
 
 func (s *SystemFileService) GetFolder(
@@ -148,115 +150,149 @@ func (s *SystemFileService) GetElementById(idElement string) (*models.SystemFile
 	return element, nil
 }
 
-func (s *SystemFileService) DownloadRepo(
-	idRepo string,
-	zipWritter *zip.Writer,
+// writeArchive writes the elements as an archive, a failed one is left
+// without its end so it is not valid
+func (s *SystemFileService) writeArchive(
+	format string,
+	w io.Writer,
+	roots []primitive.ObjectID,
 ) *res.ErrorRes {
-	idRepoObj, err := primitive.ObjectIDFromHex(idRepo)
+	archive, err := utils.NewArchiveWriter(format, w)
 	if err != nil {
 		return &res.ErrorRes{
 			Err:        err,
 			StatusCode: http.StatusBadRequest,
 		}
 	}
-	repository, err := repoService.GetRepositoryById(idRepoObj)
-	if err != nil {
-		if errors.Is(err, mongo.ErrNoDocuments) {
-			return &res.ErrorRes{
-				Err:        errors.New("el repositorio no existe"),
-				StatusCode: http.StatusNotFound,
-			}
-		}
+	if errRes := s.writeTree(archive, roots, ""); errRes != nil {
+		return errRes
+	}
+	if err := archive.Close(); err != nil {
 		return &res.ErrorRes{
 			Err:        err,
-			StatusCode: http.StatusServiceUnavailable,
-		}
-	}
-	for _, child := range repository.SystemFile {
-		errRes := s.DownloadChild(child.Hex(), zipWritter, nil)
-		if errRes != nil {
-			return errRes
+			StatusCode: http.StatusInternalServerError,
 		}
 	}
 	return nil
 }
 
-func (s *SystemFileService) DownloadChild(
-	idChild string,
-	zipWritter *zip.Writer,
-	fileMem *io.Writer,
+// writeTree writes the elements and all their childrens to the archive
+// with their paths, one folder is read at a time
+func (s *SystemFileService) writeTree(
+	archive utils.ArchiveWriter,
+	elements []primitive.ObjectID,
+	prefix string,
 ) *res.ErrorRes {
-	element, errRes := s.GetElementById(idChild)
-	if errRes != nil {
-		return errRes
+	if len(elements) == 0 {
+		return nil
 	}
-	if !element.IsDirectory {
-		file, err := utils.GetFile(element.Content)
-		if err != nil {
-			return &res.ErrorRes{
-				Err:        err,
-				StatusCode: http.StatusInternalServerError,
-			}
+	var folderElements []*models.SystemFile
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "name", Value: 1}}).
+		SetProjection(bson.D{{Key: "versions", Value: 0}})
+	cursor, err := systemFileModel.Use().Find(db.Ctx, bson.D{{
+		Key:   "_id",
+		Value: bson.M{"$in": elements},
+	}}, opts)
+	if err != nil {
+		return &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
 		}
-		if fileMem == nil {
-			zipFile, err := zipWritter.Create(element.Name)
-			if err != nil {
-				return &res.ErrorRes{
-					Err:        err,
-					StatusCode: http.StatusInternalServerError,
-				}
-			}
-			_, err = zipFile.Write(file)
-			if err != nil {
-				return &res.ErrorRes{
-					Err:        err,
-					StatusCode: http.StatusInternalServerError,
-				}
-			}
-		} else {
-			buffer := bytes.NewBuffer(file)
-			_, err = io.Copy(*fileMem, buffer)
-			if err != nil {
-				return &res.ErrorRes{
-					Err:        err,
-					StatusCode: http.StatusInternalServerError,
-				}
-			}
+	}
+	if err := cursor.All(db.Ctx, &folderElements); err != nil {
+		return &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
 		}
-		return nil
-	} else if element.IsDirectory && len(element.Childrens) > 0 {
-		// Create new zip
-		buffer := bytes.NewBuffer(nil)
-		newZipWritter := zip.NewWriter(buffer)
-
-		for _, child := range element.Childrens {
-			errRes = s.DownloadChild(child.Hex(), newZipWritter, nil)
-			if errRes != nil {
+	}
+	for _, element := range folderElements {
+		name := prefix + utils.SafeArchiveName(element.Name)
+		if !element.IsDirectory {
+			if errRes := s.writeFile(archive, name, element); errRes != nil {
 				return errRes
 			}
+			continue
 		}
-		zipFile, err := zipWritter.Create(element.Name + ".zip")
-		if err != nil {
+		if err := archive.AddFolder(name, element.Date.Time()); err != nil {
 			return &res.ErrorRes{
 				Err:        err,
 				StatusCode: http.StatusInternalServerError,
 			}
 		}
-		// Close zip
-		newZipWritter.Close()
+		if errRes := s.writeTree(archive, element.Childrens, name+"/"); errRes != nil {
+			return errRes
+		}
+	}
+	return nil
+}
 
-		_, err = zipFile.Write(buffer.Bytes())
-		if err != nil {
-			return &res.ErrorRes{
-				Err:        err,
-				StatusCode: http.StatusInternalServerError,
-			}
+func (*SystemFileService) writeFile(
+	archive utils.ArchiveWriter,
+	name string,
+	element *models.SystemFile,
+) *res.ErrorRes {
+	file, size, err := utils.OpenFile(element.Content)
+	if err != nil {
+		return &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusInternalServerError,
 		}
 	}
+	defer file.Close()
 
+	if err := archive.AddFile(name, element.Date.Time(), size, file); err != nil {
+		return &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusInternalServerError,
+		}
+	}
 	return nil
 }
 
+// servedFile describes a stored content of the element to answer a
+// request with
+func (*SystemFileService) servedFile(
+	element *models.SystemFile,
+	content string,
+	modified primitive.DateTime,
+) *utils.ServedFile {
+	hash := content
+	for _, version := range element.Versions {
+		if version.Content == content && version.Hash != "" {
+			hash = version.Hash
+		}
+	}
+	return &utils.ServedFile{
+		NameFile:    content,
+		Name:        element.Name,
+		ContentType: element.FileType,
+		Hash:        hash,
+		Modified:    modified.Time(),
+	}
+}
+
+// FileURL returns a presigned URL to download the file, empty if the
+// storage does not serve files by itself
+func (*SystemFileService) FileURL(file *utils.ServedFile) (string, *res.ErrorRes) {
+	contentType := file.ContentType
+	if contentType == "" {
+		contentType = mime.TypeByExtension(filepath.Ext(file.Name))
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	url, err := utils.PresignedURL(file.NameFile, file.Name, contentType)
+	if err != nil {
+		return "", &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusInternalServerError,
+		}
+	}
+	return url, nil
+}
+
 func (s *SystemFileService) getFolderChildrens(
 	folder *models.SystemFile,
 ) (childrens []primitive.ObjectID, err error) {
@@ -268,7 +304,11 @@ func (s *SystemFileService) getFolderChildrens(
 		childrens = append(childrens, children)
 		element, errRes := s.GetElementById(children.Hex())
 		if errRes != nil {
-			return nil, err
+			// Deleted elements can be left in their folders
+			if errRes.StatusCode == http.StatusNotFound {
+				continue
+			}
+			return nil, errRes.Err
 		}
 		if element.IsDirectory {
 			childrensToAppend, err := s.getFolderChildrens(element)
@@ -362,7 +402,7 @@ func (s *SystemFileService) NewRepoElement(
 			StatusCode: http.StatusNotFound,
 		}
 	}
-	// Check if is owner
+	// Check permission
 	idUserObj, err := primitive.ObjectIDFromHex(idUser)
 	if err != nil {
 		return nil, &res.ErrorRes{
@@ -370,99 +410,233 @@ func (s *SystemFileService) NewRepoElement(
 			StatusCode: http.StatusBadRequest,
 		}
 	}
-	isOwner, err := repoService.IsRepoOwner(idUserObj, idRepositoryObj)
+	errRes := collaboratorService.CheckPermission(
+		idRepositoryObj,
+		idUserObj,
+		models.COLLABORATOR_WRITE,
+	)
+	if errRes != nil {
+		return nil, errRes
+	}
+	parentFolder, errRes := s.getFolder(idRepositoryObj, parent)
+	if errRes != nil {
+		return nil, errRes
+	}
+	name := element.Name
+	if !*element.IsDirectory {
+		name = file.Filename
+	}
+	errRes = s.checkName(idRepositoryObj, parentFolder, name, primitive.NilObjectID)
+	if errRes != nil {
+		return nil, errRes
+	}
+	// Insert into repo
+	response := make(map[string]interface{})
+
+	var storedFile *models.StoredFile
+	if !*element.IsDirectory {
+		storedFile, err = storedFileService.Upload(file)
+		if err != nil {
+			return nil, &res.ErrorRes{
+				Err:        err,
+				StatusCode: http.StatusInternalServerError,
+			}
+		}
+	}
+	newElementModel := systemFileModel.NewModel(element, file, storedFile)
+	if storedFile != nil {
+		newElementModel.Versions = []models.FileVersion{*s.newVersion(storedFile, idUserObj)}
+	}
+	insertedSF, err := systemFileModel.Use().InsertOne(db.Ctx, newElementModel)
 	if err != nil {
+		if storedFile != nil {
+			storedFileService.Unref(storedFile.Name)
+		}
 		return nil, &res.ErrorRes{
 			Err:        err,
 			StatusCode: http.StatusServiceUnavailable,
 		}
 	}
-	if !isOwner {
+	err = s.addToFolder(
+		idRepositoryObj,
+		parentFolder,
+		insertedSF.InsertedID.(primitive.ObjectID),
+	)
+	if err != nil {
 		return nil, &res.ErrorRes{
-			Err:        errors.New("no eres dueño del repositorio"),
-			StatusCode: http.StatusUnauthorized,
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
 		}
 	}
-	// Insert into repo
-	response := make(map[string]interface{})
+	// Make response
+	response["_id"] = insertedSF.InsertedID.(primitive.ObjectID).Hex()
 
-	newElementModel, err := systemFileModel.NewModel(element, file)
-	if err != nil {
+	return response, nil
+}
+
+// getFolder returns the folder of the repository, nil is the root
+func (s *SystemFileService) getFolder(
+	idObjRepository primitive.ObjectID,
+	idFolder string,
+) (*models.SystemFile, *res.ErrorRes) {
+	if idFolder == "" {
+		return nil, nil
+	}
+	folder, errRes := s.GetElementById(idFolder)
+	if errRes != nil {
+		return nil, errRes
+	}
+	if !folder.IsDirectory {
 		return nil, &res.ErrorRes{
-			Err:        err,
-			StatusCode: http.StatusInternalServerError,
+			Err:        errors.New("parent no es una carpeta"),
+			StatusCode: http.StatusBadRequest,
 		}
 	}
-	insertedSF, err := systemFileModel.Use().InsertOne(db.Ctx, newElementModel)
+	inRepo, err := s.isElementInRepo(folder, idObjRepository)
 	if err != nil {
 		return nil, &res.ErrorRes{
 			Err:        err,
 			StatusCode: http.StatusServiceUnavailable,
 		}
 	}
-	if parent == "" {
-		_, err := repoModel.Use().UpdateByID(db.Ctx, idRepositoryObj, bson.D{{
-			Key: "$addToSet",
-			Value: bson.M{
-				"system_file": insertedSF.InsertedID,
-			},
-		}})
-		if err != nil {
-			return nil, &res.ErrorRes{
-				Err:        err,
-				StatusCode: http.StatusServiceUnavailable,
-			}
-		}
-	} else {
-		element, errRes := s.GetElementById(parent)
-		if errRes != nil {
-			return nil, errRes
+	if !inRepo {
+		return nil, &res.ErrorRes{
+			Err:        errors.New("el elemento no pertenece al repositorio"),
+			StatusCode: http.StatusUnauthorized,
 		}
-		if !element.IsDirectory {
-			return nil, &res.ErrorRes{
-				Err:        errors.New("parent no es una carpeta"),
-				StatusCode: http.StatusBadRequest,
-			}
+	}
+	return folder, nil
+}
+
+// getParent returns the folder containing the element, nil if the
+// element is in the root of the repository
+func (*SystemFileService) getParent(idElement primitive.ObjectID) (*models.SystemFile, error) {
+	var parent *models.SystemFile
+
+	cursor := systemFileModel.Use().FindOne(db.Ctx, bson.D{{
+		Key:   "childrens",
+		Value: idElement,
+	}})
+	if err := cursor.Decode(&parent); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
 		}
-		inRepo, err := s.isElementInRepo(element, idRepositoryObj)
+		return nil, err
+	}
+	return parent, nil
+}
+
+// checkName checks no other element of the folder, or of the root if
+// folder is nil, has the name
+func (*SystemFileService) checkName(
+	idObjRepository primitive.ObjectID,
+	folder *models.SystemFile,
+	name string,
+	except primitive.ObjectID,
+) *res.ErrorRes {
+	var childrens []primitive.ObjectID
+	if folder != nil {
+		childrens = folder.Childrens
+	} else {
+		opts := options.FindOne().SetProjection(bson.D{{
+			Key:   "system_file",
+			Value: 1,
+		}})
+		repository, err := repoService.GetRepositoryById(idObjRepository, opts)
 		if err != nil {
-			return nil, &res.ErrorRes{
+			return &res.ErrorRes{
 				Err:        err,
 				StatusCode: http.StatusServiceUnavailable,
 			}
 		}
-		if !inRepo {
-			return nil, &res.ErrorRes{
-				Err:        errors.New("el elemento no pertenece al repositorio"),
-				StatusCode: http.StatusUnauthorized,
-			}
+		childrens = repository.SystemFile
+	}
+	if len(childrens) == 0 {
+		return nil
+	}
+	exists, err := systemFileModel.Exists(bson.D{
+		{
+			Key: "_id",
+			Value: bson.M{
+				"$in": childrens,
+				"$ne": except,
+			},
+		},
+		{
+			Key:   "name",
+			Value: name,
+		},
+	})
+	if err != nil {
+		return &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	if exists {
+		return &res.ErrorRes{
+			Err:        fmt.Errorf("ya existe un elemento con el nombre %s", name),
+			StatusCode: http.StatusConflict,
 		}
+	}
+	return nil
+}
 
-		_, err = systemFileModel.Use().UpdateByID(db.Ctx, element.ID, bson.D{{
+// addToFolder adds the element to the folder, or to the root if folder is nil
+func (*SystemFileService) addToFolder(
+	idObjRepository primitive.ObjectID,
+	folder *models.SystemFile,
+	idElement primitive.ObjectID,
+) (err error) {
+	if folder == nil {
+		_, err = repoModel.Use().UpdateByID(db.Ctx, idObjRepository, bson.D{{
 			Key: "$addToSet",
 			Value: bson.M{
-				"childrens": insertedSF.InsertedID,
+				"system_file": idElement,
+			},
+		}})
+	} else {
+		_, err = systemFileModel.Use().UpdateByID(db.Ctx, folder.ID, bson.D{{
+			Key: "$addToSet",
+			Value: bson.M{
+				"childrens": idElement,
 			},
 		}})
-		if err != nil {
-			return nil, &res.ErrorRes{
-				Err:        err,
-				StatusCode: http.StatusServiceUnavailable,
-			}
-		}
 	}
-	// Make response
-	response["_id"] = insertedSF.InsertedID.(primitive.ObjectID).Hex()
+	return
+}
 
-	return response, nil
+// pullFromFolder removes the element from the folder, or from the root if
+// folder is nil
+func (*SystemFileService) pullFromFolder(
+	idObjRepository primitive.ObjectID,
+	folder *models.SystemFile,
+	idElement primitive.ObjectID,
+) (err error) {
+	if folder == nil {
+		_, err = repoModel.Use().UpdateByID(db.Ctx, idObjRepository, bson.D{{
+			Key: "$pull",
+			Value: bson.M{
+				"system_file": idElement,
+			},
+		}})
+	} else {
+		_, err = systemFileModel.Use().UpdateByID(db.Ctx, folder.ID, bson.D{{
+			Key: "$pull",
+			Value: bson.M{
+				"childrens": idElement,
+			},
+		}})
+	}
+	return
 }
 
-func (s *SystemFileService) DeleteElement(
+func (s *SystemFileService) MoveElement(
 	idRepository,
 	idElement,
 	idUser string,
+	moveForm *forms.MoveElementForm,
 ) *res.ErrorRes {
-	// IdObjects
 	idRepositoryObj, err := primitive.ObjectIDFromHex(idRepository)
 	if err != nil {
 		return &res.ErrorRes{
@@ -477,63 +651,299 @@ func (s *SystemFileService) DeleteElement(
 			StatusCode: http.StatusBadRequest,
 		}
 	}
-	// Check owner
-	isOwner, err := repoService.IsRepoOwner(idUserObj, idRepositoryObj)
-	if err != nil {
+	if moveForm.Name == "" && moveForm.Parent == nil {
 		return &res.ErrorRes{
-			Err:        err,
-			StatusCode: http.StatusServiceUnavailable,
+			Err:        errors.New("indica el nuevo nombre o la carpeta de destino"),
+			StatusCode: http.StatusBadRequest,
 		}
 	}
-	if !isOwner {
-		return &res.ErrorRes{
-			Err:        err,
-			StatusCode: http.StatusUnauthorized,
-		}
+	// Check permission
+	errRes := collaboratorService.CheckPermission(
+		idRepositoryObj,
+		idUserObj,
+		models.COLLABORATOR_WRITE,
+	)
+	if errRes != nil {
+		return errRes
 	}
-	// Get element by id
+	// Element
 	element, errRes := s.GetElementById(idElement)
 	if errRes != nil {
 		return errRes
 	}
-	// Check element in repo
-	isElementInRepo, err := s.isElementInRepo(element, idRepositoryObj)
+	inRepo, err := s.isElementInRepo(element, idRepositoryObj)
 	if err != nil {
 		return &res.ErrorRes{
 			Err:        err,
 			StatusCode: http.StatusServiceUnavailable,
 		}
 	}
-	if !isElementInRepo {
+	if !inRepo {
 		return &res.ErrorRes{
 			Err:        errors.New("el elemento no pertenece al repositorio"),
 			StatusCode: http.StatusUnauthorized,
 		}
 	}
-	// Get elements to delete
-	var toDelete []primitive.ObjectID
-	toDelete = append(toDelete, element.ID)
-
-	if element.IsDirectory {
-		childrens, err := s.getFolderChildrens(element)
-		if err != nil {
-			return nil
+	parent, err := s.getParent(element.ID)
+	if err != nil {
+		return &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
 		}
-		toDelete = append(toDelete, childrens...)
 	}
-	// Delete elements
-	_, err = systemFileModel.Use().DeleteMany(db.Ctx, bson.D{{
-		Key: "_id",
+	// Destination, an empty parent is the root
+	destination := parent
+	if moveForm.Parent != nil {
+		destination, errRes = s.getFolder(idRepositoryObj, *moveForm.Parent)
+		if errRes != nil {
+			return errRes
+		}
+	}
+	isMove := (parent == nil) != (destination == nil) ||
+		(parent != nil && destination != nil && parent.ID != destination.ID)
+	// A folder can't be moved inside itself
+	inside := isMove && destination != nil && element.IsDirectory
+	if inside {
+		if errRes := s.checkNotInside(element.ID, destination); errRes != nil {
+			return errRes
+		}
+	}
+	name := element.Name
+	if moveForm.Name != "" {
+		name = moveForm.Name
+	}
+	errRes = s.checkName(idRepositoryObj, destination, name, element.ID)
+	if errRes != nil {
+		return errRes
+	}
+	if !isMove {
+		if name != element.Name {
+			if err := s.setName(element.ID, name); err != nil {
+				return &res.ErrorRes{
+					Err:        err,
+					StatusCode: http.StatusServiceUnavailable,
+				}
+			}
+		}
+		return nil
+	}
+	// Without transactions the element is taken from the parent it was
+	// read from first, so only one move continues and can undo its steps
+	taken, err := s.takeFromFolder(idRepositoryObj, parent, element.ID)
+	if err != nil {
+		return &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	if !taken {
+		return &res.ErrorRes{
+			Err:        errors.New("el elemento se movió mientras tanto, intenta nuevamente"),
+			StatusCode: http.StatusConflict,
+		}
+	}
+	undo := func() {
+		s.pullFromFolder(idRepositoryObj, destination, element.ID)
+		s.setName(element.ID, element.Name)
+		s.addToFolder(idRepositoryObj, parent, element.ID)
+	}
+	if name != element.Name {
+		if err := s.setName(element.ID, name); err != nil {
+			undo()
+			return &res.ErrorRes{
+				Err:        err,
+				StatusCode: http.StatusServiceUnavailable,
+			}
+		}
+	}
+	if err := s.addToFolder(idRepositoryObj, destination, element.ID); err != nil {
+		undo()
+		return &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	// Checked again with the element in the destination, of two crossed
+	// moves at least one sees the other
+	if inside {
+		if errRes := s.checkNotInside(element.ID, destination); errRes != nil {
+			undo()
+			return errRes
+		}
+	}
+	return nil
+}
+
+// takeFromFolder removes the element from the folder, or from the root if
+// folder is nil, false if it was not there
+func (*SystemFileService) takeFromFolder(
+	idObjRepository primitive.ObjectID,
+	folder *models.SystemFile,
+	idElement primitive.ObjectID,
+) (bool, error) {
+	var result *mongo.UpdateResult
+	var err error
+	if folder == nil {
+		result, err = repoModel.Use().UpdateOne(
+			db.Ctx,
+			bson.D{
+				{
+					Key:   "_id",
+					Value: idObjRepository,
+				},
+				{
+					Key:   "system_file",
+					Value: idElement,
+				},
+			},
+			bson.D{{
+				Key: "$pull",
+				Value: bson.M{
+					"system_file": idElement,
+				},
+			}},
+		)
+	} else {
+		result, err = systemFileModel.Use().UpdateOne(
+			db.Ctx,
+			bson.D{
+				{
+					Key:   "_id",
+					Value: folder.ID,
+				},
+				{
+					Key:   "childrens",
+					Value: idElement,
+				},
+			},
+			bson.D{{
+				Key: "$pull",
+				Value: bson.M{
+					"childrens": idElement,
+				},
+			}},
+		)
+	}
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount == 1, nil
+}
+
+// checkNotInside checks the folder is not the element nor is inside it, by
+// the folders containing the folder up to the root
+func (*SystemFileService) checkNotInside(
+	idElement primitive.ObjectID,
+	folder *models.SystemFile,
+) *res.ErrorRes {
+	visited := make(map[primitive.ObjectID]bool)
+	ids := []primitive.ObjectID{folder.ID}
+	for len(ids) > 0 {
+		for _, id := range ids {
+			if id == idElement {
+				return &res.ErrorRes{
+					Err:        errors.New("no puedes mover una carpeta dentro de sí misma"),
+					StatusCode: http.StatusBadRequest,
+				}
+			}
+			visited[id] = true
+		}
+		var parents []models.SystemFile
+
+		opts := options.Find().SetProjection(bson.D{{
+			Key:   "_id",
+			Value: 1,
+		}})
+		cursor, err := systemFileModel.Use().Find(db.Ctx, bson.D{{
+			Key: "childrens",
+			Value: bson.M{
+				"$in": ids,
+			},
+		}}, opts)
+		if err != nil {
+			return &res.ErrorRes{
+				Err:        err,
+				StatusCode: http.StatusServiceUnavailable,
+			}
+		}
+		if err := cursor.All(db.Ctx, &parents); err != nil {
+			return &res.ErrorRes{
+				Err:        err,
+				StatusCode: http.StatusServiceUnavailable,
+			}
+		}
+		ids = nil
+		for _, parent := range parents {
+			if !visited[parent.ID] {
+				ids = append(ids, parent.ID)
+			}
+		}
+	}
+	return nil
+}
+
+func (*SystemFileService) setName(idElement primitive.ObjectID, name string) error {
+	_, err := systemFileModel.Use().UpdateByID(db.Ctx, idElement, bson.D{{
+		Key: "$set",
 		Value: bson.M{
-			"$in": toDelete,
+			"name": name,
 		},
 	}})
+	return err
+}
+
+func (s *SystemFileService) DeleteElement(
+	idRepository,
+	idElement,
+	idUser string,
+) *res.ErrorRes {
+	// IdObjects
+	idRepositoryObj, err := primitive.ObjectIDFromHex(idRepository)
+	if err != nil {
+		return &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	idUserObj, err := primitive.ObjectIDFromHex(idUser)
+	if err != nil {
+		return &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	// Check permission
+	errRes := collaboratorService.CheckPermission(
+		idRepositoryObj,
+		idUserObj,
+		models.COLLABORATOR_WRITE,
+	)
+	if errRes != nil {
+		return errRes
+	}
+	// Get element by id
+	element, errRes := s.GetElementById(idElement)
+	if errRes != nil {
+		return errRes
+	}
+	// Check element in repo
+	isElementInRepo, err := s.isElementInRepo(element, idRepositoryObj)
 	if err != nil {
 		return &res.ErrorRes{
 			Err:        err,
 			StatusCode: http.StatusServiceUnavailable,
 		}
 	}
+	if !isElementInRepo {
+		return &res.ErrorRes{
+			Err:        errors.New("el elemento no pertenece al repositorio"),
+			StatusCode: http.StatusUnauthorized,
+		}
+	}
+	// Delete elements
+	if errRes := s.deleteTree([]primitive.ObjectID{element.ID}); errRes != nil {
+		return errRes
+	}
 	_, err = repoModel.Use().UpdateByID(db.Ctx, idRepositoryObj, bson.D{{
 		Key: "$pull",
 		Value: bson.M{
@@ -550,6 +960,1112 @@ func (s *SystemFileService) DeleteElement(
 	return nil
 }
 
+// CopyTree deep copies the elements and all their childrens, files keep
+// pointing to the same stored content. Returns the ids of the copied roots
+func (s *SystemFileService) CopyTree(
+	roots []primitive.ObjectID,
+) ([]primitive.ObjectID, *res.ErrorRes) {
+	var elements []*models.SystemFile
+	newIds := make(map[primitive.ObjectID]primitive.ObjectID)
+
+	level := roots
+	for len(level) > 0 {
+		var levelElements []*models.SystemFile
+
+		cursor, err := systemFileModel.Use().Find(db.Ctx, bson.D{{
+			Key:   "_id",
+			Value: bson.M{"$in": level},
+		}})
+		if err != nil {
+			return nil, &res.ErrorRes{
+				Err:        err,
+				StatusCode: http.StatusServiceUnavailable,
+			}
+		}
+		if err := cursor.All(db.Ctx, &levelElements); err != nil {
+			return nil, &res.ErrorRes{
+				Err:        err,
+				StatusCode: http.StatusServiceUnavailable,
+			}
+		}
+		level = nil
+		for _, element := range levelElements {
+			if _, copied := newIds[element.ID]; copied {
+				continue
+			}
+			newIds[element.ID] = primitive.NewObjectID()
+			elements = append(elements, element)
+			level = append(level, element.Childrens...)
+		}
+	}
+	if len(elements) == 0 {
+		return nil, nil
+	}
+	// Copies
+	copies := make([]interface{}, 0, len(elements))
+	var contents []string
+	for _, element := range elements {
+		contents = append(contents, s.contents(element)...)
+		var childrens []primitive.ObjectID
+		for _, children := range element.Childrens {
+			if newId, ok := newIds[children]; ok {
+				childrens = append(childrens, newId)
+			}
+		}
+		elementCopy := *element
+		elementCopy.ID = newIds[element.ID]
+		elementCopy.Childrens = childrens
+		copies = append(copies, elementCopy)
+	}
+	if _, err := systemFileModel.Use().InsertMany(db.Ctx, copies); err != nil {
+		return nil, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	if err := storedFileService.Ref(contents...); err != nil {
+		return nil, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	var newRoots []primitive.ObjectID
+	for _, root := range roots {
+		if newId, ok := newIds[root]; ok {
+			newRoots = append(newRoots, newId)
+		}
+	}
+	return newRoots, nil
+}
+
+// deleteTree deletes the elements and all their childrens, releasing
+// the stored files they use
+func (s *SystemFileService) deleteTree(roots []primitive.ObjectID) *res.ErrorRes {
+	var toDelete []primitive.ObjectID
+	var contents []string
+
+	level := roots
+	for len(level) > 0 {
+		var levelElements []*models.SystemFile
+
+		opts := options.Find().SetProjection(bson.D{
+			{Key: "childrens", Value: 1},
+			{Key: "content", Value: 1},
+			{Key: "versions.content", Value: 1},
+		})
+		cursor, err := systemFileModel.Use().Find(db.Ctx, bson.D{{
+			Key:   "_id",
+			Value: bson.M{"$in": level},
+		}}, opts)
+		if err != nil {
+			return &res.ErrorRes{
+				Err:        err,
+				StatusCode: http.StatusServiceUnavailable,
+			}
+		}
+		if err := cursor.All(db.Ctx, &levelElements); err != nil {
+			return &res.ErrorRes{
+				Err:        err,
+				StatusCode: http.StatusServiceUnavailable,
+			}
+		}
+		toDelete = append(toDelete, level...)
+		level = nil
+		for _, element := range levelElements {
+			level = append(level, element.Childrens...)
+			contents = append(contents, s.contents(element)...)
+		}
+	}
+	if len(toDelete) == 0 {
+		return nil
+	}
+	_, err := systemFileModel.Use().DeleteMany(db.Ctx, bson.D{{
+		Key:   "_id",
+		Value: bson.M{"$in": toDelete},
+	}})
+	if err != nil {
+		return &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	if err := storedFileService.Unref(contents...); err != nil {
+		return &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	return nil
+}
+
+// flattenTree returns the files under the roots by their path
+func (*SystemFileService) flattenTree(
+	roots []primitive.ObjectID,
+) (map[string]*models.SystemFile, *res.ErrorRes) {
+	files := make(map[string]*models.SystemFile)
+	folders := make(map[primitive.ObjectID]string)
+
+	level := roots
+	for len(level) > 0 {
+		var levelElements []*models.SystemFile
+
+		cursor, err := systemFileModel.Use().Find(db.Ctx, bson.D{{
+			Key:   "_id",
+			Value: bson.M{"$in": level},
+		}})
+		if err != nil {
+			return nil, &res.ErrorRes{
+				Err:        err,
+				StatusCode: http.StatusServiceUnavailable,
+			}
+		}
+		if err := cursor.All(db.Ctx, &levelElements); err != nil {
+			return nil, &res.ErrorRes{
+				Err:        err,
+				StatusCode: http.StatusServiceUnavailable,
+			}
+		}
+		level = nil
+		for _, element := range levelElements {
+			elementPath := folders[element.ID] + element.Name
+			if !element.IsDirectory {
+				files[elementPath] = element
+				continue
+			}
+			for _, children := range element.Childrens {
+				folders[children] = elementPath + "/"
+				level = append(level, children)
+			}
+		}
+	}
+	return files, nil
+}
+
+// GetElementByPath resolves a slash separated path from the root of the
+// repository. The root itself has no element, so it returns nil
+func (s *SystemFileService) GetElementByPath(
+	idObjRepository primitive.ObjectID,
+	path string,
+) (*models.SystemFile, *res.ErrorRes) {
+	opts := options.FindOne().SetProjection(bson.D{{
+		Key:   "system_file",
+		Value: 1,
+	}})
+	repository, err := repoService.GetRepositoryById(idObjRepository, opts)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, &res.ErrorRes{
+				Err:        errors.New("no existe el repositorio"),
+				StatusCode: http.StatusNotFound,
+			}
+		}
+		return nil, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	var element *models.SystemFile
+
+	childrens := repository.SystemFile
+	for _, name := range strings.Split(path, "/") {
+		if name == "" {
+			continue
+		}
+		if len(childrens) == 0 || (element != nil && !element.IsDirectory) {
+			return nil, &res.ErrorRes{
+				Err:        errors.New("no existe la ruta"),
+				StatusCode: http.StatusNotFound,
+			}
+		}
+		cursor := systemFileModel.Use().FindOne(db.Ctx, bson.D{
+			{
+				Key:   "_id",
+				Value: bson.M{"$in": childrens},
+			},
+			{
+				Key:   "name",
+				Value: name,
+			},
+		})
+		element = nil
+		if err := cursor.Decode(&element); err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				return nil, &res.ErrorRes{
+					Err:        errors.New("no existe la ruta"),
+					StatusCode: http.StatusNotFound,
+				}
+			}
+			return nil, &res.ErrorRes{
+				Err:        err,
+				StatusCode: http.StatusServiceUnavailable,
+			}
+		}
+		childrens = element.Childrens
+	}
+	return element, nil
+}
+
+// GetTree returns the element of the path, folders with their childrens
+func (s *SystemFileService) GetTree(
+	idObjRepository primitive.ObjectID,
+	path,
+	idUser string,
+) (*models.SystemFileRes, *res.ErrorRes) {
+	if errRes := repoService.CheckRepoAccess(idObjRepository, idUser); errRes != nil {
+		return nil, errRes
+	}
+	element, errRes := s.GetElementByPath(idObjRepository, path)
+	if errRes != nil {
+		return nil, errRes
+	}
+	var childrens []primitive.ObjectID
+	tree := &models.SystemFileRes{
+		IsDirectory: true,
+	}
+	if element == nil {
+		// Root
+		repository, err := repoService.GetRepositoryById(idObjRepository)
+		if err != nil {
+			return nil, &res.ErrorRes{
+				Err:        err,
+				StatusCode: http.StatusServiceUnavailable,
+			}
+		}
+		childrens = repository.SystemFile
+		tree.Date = repository.UpdatedDate
+	} else {
+		childrens = element.Childrens
+		tree = &models.SystemFileRes{
+			ID:          element.ID,
+			FileType:    element.FileType,
+			Name:        element.Name,
+			IsDirectory: element.IsDirectory,
+			Date:        element.Date,
+		}
+	}
+	if !tree.IsDirectory || len(childrens) == 0 {
+		return tree, nil
+	}
+	opts := options.Find().SetSort(bson.D{
+		{
+			Key:   "is_directory",
+			Value: -1,
+		},
+		{
+			Key:   "name",
+			Value: 1,
+		},
+	})
+	cursor, err := systemFileModel.Use().Find(db.Ctx, bson.D{{
+		Key:   "_id",
+		Value: bson.M{"$in": childrens},
+	}}, opts)
+	if err != nil {
+		return nil, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	if err := cursor.All(db.Ctx, &tree.Childrens); err != nil {
+		return nil, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	return tree, nil
+}
+
+func (s *SystemFileService) GetRawFile(
+	idObjRepository primitive.ObjectID,
+	path,
+	idUser string,
+) (*utils.ServedFile, *res.ErrorRes) {
+	if errRes := repoService.CheckRepoAccess(idObjRepository, idUser); errRes != nil {
+		return nil, errRes
+	}
+	element, errRes := s.GetElementByPath(idObjRepository, path)
+	if errRes != nil {
+		return nil, errRes
+	}
+	if element == nil || element.IsDirectory {
+		return nil, &res.ErrorRes{
+			Err:        errors.New("la ruta es una carpeta"),
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	return s.servedFile(element, element.Content, element.Date), nil
+}
+
+func (*SystemFileService) newVersion(
+	storedFile *models.StoredFile,
+	idUploader primitive.ObjectID,
+) *models.FileVersion {
+	// The name of the stored file is its hash
+	return systemFileModel.NewVersionModel(storedFile.Name, storedFile.Size, storedFile.Name, idUploader)
+}
+
+// getVersions returns the versions of the file, files uploaded before
+// versions existed get their current content as the first one
+func (s *SystemFileService) getVersions(file *models.SystemFile) ([]models.FileVersion, error) {
+	if len(file.Versions) > 0 || file.Content == "" {
+		return file.Versions, nil
+	}
+	hash, size, err := utils.HashFile(file.Content)
+	if err != nil {
+		return nil, err
+	}
+	version := systemFileModel.NewVersionModel(file.Content, size, hash, primitive.NilObjectID)
+	// Stable ID until the version is stored
+	version.ID = file.ID
+	version.Date = file.Date
+	return []models.FileVersion{*version}, nil
+}
+
+// getRepoFile returns the file if it belongs to the repository
+func (s *SystemFileService) getRepoFile(
+	idRepository,
+	idElement string,
+) (primitive.ObjectID, *models.SystemFile, *res.ErrorRes) {
+	idRepositoryObj, err := primitive.ObjectIDFromHex(idRepository)
+	if err != nil {
+		return primitive.NilObjectID, nil, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	element, errRes := s.GetElementById(idElement)
+	if errRes != nil {
+		return primitive.NilObjectID, nil, errRes
+	}
+	inRepo, err := s.isElementInRepo(element, idRepositoryObj)
+	if err != nil {
+		return primitive.NilObjectID, nil, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	if !inRepo {
+		return primitive.NilObjectID, nil, &res.ErrorRes{
+			Err:        errors.New("el elemento no pertenece al repositorio"),
+			StatusCode: http.StatusUnauthorized,
+		}
+	}
+	if element.IsDirectory {
+		return primitive.NilObjectID, nil, &res.ErrorRes{
+			Err:        errors.New("el elemento es una carpeta"),
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	return idRepositoryObj, element, nil
+}
+
+// pushVersion makes the version the current content of the file, only
+// the last FILE_VERSIONS_LIMIT versions are kept
+func (s *SystemFileService) pushVersion(
+	file *models.SystemFile,
+	version *models.FileVersion,
+) *res.ErrorRes {
+	for retry := 0; retry < PUSH_VERSION_RETRIES; retry++ {
+		// Other version was pushed since the file was read
+		if retry > 0 {
+			var errRes *res.ErrorRes
+			file, errRes = s.GetElementById(file.ID.Hex())
+			if errRes != nil {
+				return errRes
+			}
+		}
+		pushed, errRes := s.tryPushVersion(file, version)
+		if errRes != nil {
+			return errRes
+		}
+		if pushed {
+			return nil
+		}
+	}
+	return &res.ErrorRes{
+		Err:        errors.New("el archivo cambió mientras se actualizaba, intenta nuevamente"),
+		StatusCode: http.StatusConflict,
+	}
+}
+
+// tryPushVersion pushes the version only if the versions of the file are
+// still the ones read, so the references are counted over them
+func (s *SystemFileService) tryPushVersion(
+	file *models.SystemFile,
+	version *models.FileVersion,
+) (bool, *res.ErrorRes) {
+	versions, err := s.getVersions(file)
+	if err != nil {
+		return false, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusInternalServerError,
+		}
+	}
+	// Legacy files store their first version too
+	toPush := []models.FileVersion{*version}
+	filter := bson.D{{
+		Key:   "_id",
+		Value: file.ID,
+	}}
+	if len(file.Versions) == 0 {
+		toPush = append(versions, *version)
+		filter = append(filter, bson.E{
+			Key:   "versions.0",
+			Value: bson.M{"$exists": false},
+		})
+	} else {
+		filter = append(filter, bson.E{
+			Key:   fmt.Sprintf("versions.%d._id", len(file.Versions)-1),
+			Value: file.Versions[len(file.Versions)-1].ID,
+		})
+	}
+	// Stored files used before and after the push
+	updated := &models.SystemFile{
+		Content:  version.Content,
+		Versions: append(append([]models.FileVersion(nil), file.Versions...), toPush...),
+	}
+	if len(updated.Versions) > settingsData.FILE_VERSIONS_LIMIT {
+		updated.Versions = updated.Versions[len(updated.Versions)-settingsData.FILE_VERSIONS_LIMIT:]
+	}
+	added, removed := s.diffContents(s.contents(file), s.contents(updated))
+	result, err := systemFileModel.Use().UpdateOne(db.Ctx, filter, bson.D{
+		{
+			Key: "$set",
+			Value: bson.M{
+				"content": version.Content,
+				"date":    version.Date,
+			},
+		},
+		{
+			Key: "$push",
+			Value: bson.M{
+				"versions": bson.M{
+					"$each":  toPush,
+					"$slice": -settingsData.FILE_VERSIONS_LIMIT,
+				},
+			},
+		},
+	})
+	if err != nil {
+		return false, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	if result.MatchedCount == 0 {
+		return false, nil
+	}
+	err = storedFileService.Ref(added...)
+	if err == nil {
+		err = storedFileService.Unref(removed...)
+	}
+	if err != nil {
+		return false, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	return true, nil
+}
+
+// diffContents returns the stored files only in after and only in before
+func (*SystemFileService) diffContents(before, after []string) (added, removed []string) {
+	inBefore := make(map[string]bool)
+	for _, content := range before {
+		inBefore[content] = true
+	}
+	inAfter := make(map[string]bool)
+	for _, content := range after {
+		inAfter[content] = true
+		if !inBefore[content] {
+			added = append(added, content)
+		}
+	}
+	for _, content := range before {
+		if !inAfter[content] {
+			removed = append(removed, content)
+		}
+	}
+	return added, removed
+}
+
+// ReplaceFile uploads a new version of the file
+func (s *SystemFileService) ReplaceFile(
+	idRepository,
+	idElement,
+	idUser string,
+	file *multipart.FileHeader,
+) (*models.FileVersion, *res.ErrorRes) {
+	idUserObj, err := primitive.ObjectIDFromHex(idUser)
+	if err != nil {
+		return nil, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	idRepositoryObj, element, errRes := s.getRepoFile(idRepository, idElement)
+	if errRes != nil {
+		return nil, errRes
+	}
+	errRes = collaboratorService.CheckPermission(
+		idRepositoryObj,
+		idUserObj,
+		models.COLLABORATOR_WRITE,
+	)
+	if errRes != nil {
+		return nil, errRes
+	}
+	// Upload
+	storedFile, err := storedFileService.Upload(file)
+	if err != nil {
+		return nil, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusInternalServerError,
+		}
+	}
+	// The file takes its own reference when pushed
+	defer storedFileService.Unref(storedFile.Name)
+
+	version := s.newVersion(storedFile, idUserObj)
+	if errRes := s.pushVersion(element, version); errRes != nil {
+		return nil, errRes
+	}
+	return version, nil
+}
+
+func (s *SystemFileService) GetVersions(
+	idRepository,
+	idElement,
+	idUser string,
+) ([]models.FileVersion, *res.ErrorRes) {
+	idRepositoryObj, element, errRes := s.getRepoFile(idRepository, idElement)
+	if errRes != nil {
+		return nil, errRes
+	}
+	if errRes := repoService.CheckRepoAccess(idRepositoryObj, idUser); errRes != nil {
+		return nil, errRes
+	}
+	versions, err := s.getVersions(element)
+	if err != nil {
+		return nil, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusInternalServerError,
+		}
+	}
+	// Newest first
+	sorted := make([]models.FileVersion, 0, len(versions))
+	for i := len(versions) - 1; i >= 0; i-- {
+		sorted = append(sorted, versions[i])
+	}
+	return sorted, nil
+}
+
+func (s *SystemFileService) getVersion(
+	element *models.SystemFile,
+	idVersion string,
+) (*models.FileVersion, *res.ErrorRes) {
+	idVersionObj, err := primitive.ObjectIDFromHex(idVersion)
+	if err != nil {
+		return nil, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	versions, err := s.getVersions(element)
+	if err != nil {
+		return nil, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusInternalServerError,
+		}
+	}
+	for _, version := range versions {
+		if version.ID == idVersionObj {
+			return &version, nil
+		}
+	}
+	return nil, &res.ErrorRes{
+		Err:        errors.New("no existe la versión"),
+		StatusCode: http.StatusNotFound,
+	}
+}
+
+func (s *SystemFileService) GetVersionFile(
+	idRepository,
+	idElement,
+	idVersion,
+	idUser string,
+) (*utils.ServedFile, *res.ErrorRes) {
+	idRepositoryObj, element, errRes := s.getRepoFile(idRepository, idElement)
+	if errRes != nil {
+		return nil, errRes
+	}
+	if errRes := repoService.CheckRepoAccess(idRepositoryObj, idUser); errRes != nil {
+		return nil, errRes
+	}
+	version, errRes := s.getVersion(element, idVersion)
+	if errRes != nil {
+		return nil, errRes
+	}
+	return s.servedFile(element, version.Content, version.Date), nil
+}
+
+// RestoreVersion makes a copy of the version the current one, so the
+// history is never rewritten
+func (s *SystemFileService) RestoreVersion(
+	idRepository,
+	idElement,
+	idVersion,
+	idUser string,
+) (*models.FileVersion, *res.ErrorRes) {
+	idUserObj, err := primitive.ObjectIDFromHex(idUser)
+	if err != nil {
+		return nil, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	idRepositoryObj, element, errRes := s.getRepoFile(idRepository, idElement)
+	if errRes != nil {
+		return nil, errRes
+	}
+	errRes = collaboratorService.CheckPermission(
+		idRepositoryObj,
+		idUserObj,
+		models.COLLABORATOR_WRITE,
+	)
+	if errRes != nil {
+		return nil, errRes
+	}
+	version, errRes := s.getVersion(element, idVersion)
+	if errRes != nil {
+		return nil, errRes
+	}
+	restored := systemFileModel.NewVersionModel(
+		version.Content,
+		version.Size,
+		version.Hash,
+		idUserObj,
+	)
+	if errRes := s.pushVersion(element, restored); errRes != nil {
+		return nil, errRes
+	}
+	return restored, nil
+}
+
+// NewUploadedFile adds the file of a finished resumable upload to the
+// repository, permission and name are checked again as the upload could
+// take days
+func (s *SystemFileService) NewUploadedFile(
+	upload *models.Upload,
+	file io.Reader,
+) (*models.SystemFile, *res.ErrorRes) {
+	errRes := collaboratorService.CheckPermission(
+		upload.Repository,
+		upload.User,
+		models.COLLABORATOR_WRITE,
+	)
+	if errRes != nil {
+		return nil, errRes
+	}
+	var parent string
+	if !upload.Parent.IsZero() {
+		parent = upload.Parent.Hex()
+	}
+	folder, errRes := s.getFolder(upload.Repository, parent)
+	if errRes != nil {
+		return nil, errRes
+	}
+	errRes = s.checkName(upload.Repository, folder, upload.Name, primitive.NilObjectID)
+	if errRes != nil {
+		return nil, errRes
+	}
+	storedFile, err := storedFileService.Store(file)
+	if err != nil {
+		return nil, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusInternalServerError,
+		}
+	}
+	element := systemFileModel.NewArchiveModel(upload.Name, storedFile.Name, false)
+	element.Versions = []models.FileVersion{*s.newVersion(storedFile, upload.User)}
+	if errRes := s.insertElement(upload.Repository, folder, element); errRes != nil {
+		storedFileService.Unref(storedFile.Name)
+		return nil, errRes
+	}
+	return element, nil
+}
+
+// Limits of an imported archive, sizes are of the uncompressed content
+const (
+	IMPORT_MAX_ENTRIES = 5000
+	IMPORT_MAX_SIZE    = 1 << 30
+	// Above it an entry is taken as a zip bomb
+	IMPORT_MAX_RATIO = 200
+)
+
+var (
+	errTooManyEntries  = fmt.Errorf("el archivo tiene más de %d elementos", IMPORT_MAX_ENTRIES)
+	errArchiveTooLarge = errors.New("el archivo descomprimido es demasiado grande")
+)
+
+// checkArchive walks the headers of the archive before anything is
+// extracted
+func (*SystemFileService) checkArchive(archive multipart.File, size int64) *res.ErrorRes {
+	var entries int
+	var total int64
+
+	err := utils.WalkArchive(archive, size, func(entry *utils.ArchiveEntry) error {
+		entries++
+		if entries > IMPORT_MAX_ENTRIES {
+			return errTooManyEntries
+		}
+		total += entry.Size
+		if entry.Size < 0 || total > IMPORT_MAX_SIZE {
+			return errArchiveTooLarge
+		}
+		if entry.CompressedSize > 0 && entry.Size > 1<<20 &&
+			entry.Size/entry.CompressedSize > IMPORT_MAX_RATIO {
+			return errArchiveTooLarge
+		}
+		return nil
+	})
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, errTooManyEntries) || errors.Is(err, errArchiveTooLarge) {
+		return &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusRequestEntityTooLarge,
+		}
+	}
+	if errors.Is(err, utils.ErrUnsupportedArchive) {
+		return &res.ErrorRes{
+			Err:        errors.New("sólo se pueden importar archivos zip o tar.gz"),
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	return &res.ErrorRes{
+		Err:        errors.New("el archivo está dañado"),
+		StatusCode: http.StatusBadRequest,
+	}
+}
+
+func (*SystemFileService) checkArchiveName(name string) *res.ErrorRes {
+	if len(name) > 100 {
+		return &res.ErrorRes{
+			Err:        fmt.Errorf("el nombre %s supera los 100 caracteres", name),
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	return nil
+}
+
+// findChild returns the element of the folder, or of the root if folder
+// is nil, with the name
+func (*SystemFileService) findChild(
+	idObjRepository primitive.ObjectID,
+	folder *models.SystemFile,
+	name string,
+) (*models.SystemFile, *res.ErrorRes) {
+	var childrens []primitive.ObjectID
+	if folder != nil {
+		childrens = folder.Childrens
+	} else {
+		opts := options.FindOne().SetProjection(bson.D{{
+			Key:   "system_file",
+			Value: 1,
+		}})
+		repository, err := repoService.GetRepositoryById(idObjRepository, opts)
+		if err != nil {
+			return nil, &res.ErrorRes{
+				Err:        err,
+				StatusCode: http.StatusServiceUnavailable,
+			}
+		}
+		childrens = repository.SystemFile
+	}
+	if len(childrens) == 0 {
+		return nil, nil
+	}
+	var child *models.SystemFile
+
+	cursor := systemFileModel.Use().FindOne(db.Ctx, bson.D{
+		{
+			Key:   "_id",
+			Value: bson.M{"$in": childrens},
+		},
+		{
+			Key:   "name",
+			Value: name,
+		},
+	})
+	if err := cursor.Decode(&child); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	return child, nil
+}
+
+// insertElement inserts the element into the folder, or into the root if
+// folder is nil
+func (s *SystemFileService) insertElement(
+	idObjRepository primitive.ObjectID,
+	folder *models.SystemFile,
+	element *models.SystemFile,
+) *res.ErrorRes {
+	inserted, err := systemFileModel.Use().InsertOne(db.Ctx, element)
+	if err != nil {
+		return &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	element.ID = inserted.InsertedID.(primitive.ObjectID)
+	if err := s.addToFolder(idObjRepository, folder, element.ID); err != nil {
+		return &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	if folder != nil {
+		folder.Childrens = append(folder.Childrens, element.ID)
+	}
+	return nil
+}
+
+// ensureFolder returns the folder of the path, creating the missing
+// ones. Folders that already exist are merged
+func (s *SystemFileService) ensureFolder(
+	idObjRepository primitive.ObjectID,
+	folders map[string]*models.SystemFile,
+	folderPath string,
+	progress func(*models.ImportEvent),
+) (*models.SystemFile, *res.ErrorRes) {
+	if folder, ok := folders[folderPath]; ok {
+		return folder, nil
+	}
+	parent, errRes := s.ensureFolder(
+		idObjRepository,
+		folders,
+		path.Dir(folderPath),
+		progress,
+	)
+	if errRes != nil {
+		return nil, errRes
+	}
+	name := path.Base(folderPath)
+	if errRes := s.checkArchiveName(name); errRes != nil {
+		return nil, errRes
+	}
+	folder, errRes := s.findChild(idObjRepository, parent, name)
+	if errRes != nil {
+		return nil, errRes
+	}
+	if folder != nil {
+		if !folder.IsDirectory {
+			return nil, &res.ErrorRes{
+				Err:        fmt.Errorf("ya existe un elemento con el nombre %s", name),
+				StatusCode: http.StatusConflict,
+			}
+		}
+		folders[folderPath] = folder
+		progress(&models.ImportEvent{
+			Path:   folderPath,
+			Status: models.IMPORT_MERGED,
+			ID:     folder.ID.Hex(),
+		})
+		return folder, nil
+	}
+	folder = systemFileModel.NewArchiveModel(name, "", true)
+	if errRes := s.insertElement(idObjRepository, parent, folder); errRes != nil {
+		return nil, errRes
+	}
+	folders[folderPath] = folder
+	progress(&models.ImportEvent{
+		Path:   folderPath,
+		Status: models.IMPORT_CREATED,
+		ID:     folder.ID.Hex(),
+	})
+	return folder, nil
+}
+
+func (s *SystemFileService) importFile(
+	idObjRepository,
+	idObjUser primitive.ObjectID,
+	folder *models.SystemFile,
+	name string,
+	entry *utils.ArchiveEntry,
+) (*models.SystemFile, *res.ErrorRes) {
+	if errRes := s.checkArchiveName(name); errRes != nil {
+		return nil, errRes
+	}
+	errRes := s.checkName(idObjRepository, folder, name, primitive.NilObjectID)
+	if errRes != nil {
+		return nil, errRes
+	}
+	reader, err := entry.Open()
+	if err != nil {
+		return nil, &res.ErrorRes{
+			Err:        errors.New("el elemento está dañado"),
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	defer reader.Close()
+	// The checked size is the most that is extracted
+	storedFile, err := storedFileService.Store(io.LimitReader(reader, entry.Size))
+	if err != nil {
+		return nil, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusInternalServerError,
+		}
+	}
+	element := systemFileModel.NewArchiveModel(name, storedFile.Name, false)
+	element.Versions = []models.FileVersion{*s.newVersion(storedFile, idObjUser)}
+	if errRes := s.insertElement(idObjRepository, folder, element); errRes != nil {
+		storedFileService.Unref(storedFile.Name)
+		return nil, errRes
+	}
+	return element, nil
+}
+
+// ImportArchive extracts a zip or tar.gz into the folder, or into the root
+// of the repository. Every entry is reported to progress, entries that
+// fail do not stop the import
+func (s *SystemFileService) ImportArchive(
+	idRepository,
+	parent,
+	idUser string,
+	file *multipart.FileHeader,
+	progress func(*models.ImportEvent),
+) (*models.ImportRes, *res.ErrorRes) {
+	idRepositoryObj, err := primitive.ObjectIDFromHex(idRepository)
+	if err != nil {
+		return nil, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	idUserObj, err := primitive.ObjectIDFromHex(idUser)
+	if err != nil {
+		return nil, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	errRes := collaboratorService.CheckPermission(
+		idRepositoryObj,
+		idUserObj,
+		models.COLLABORATOR_WRITE,
+	)
+	if errRes != nil {
+		return nil, errRes
+	}
+	parentFolder, errRes := s.getFolder(idRepositoryObj, parent)
+	if errRes != nil {
+		return nil, errRes
+	}
+	// Archive
+	archive, err := file.Open()
+	if err != nil {
+		return nil, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusInternalServerError,
+		}
+	}
+	defer archive.Close()
+	if errRes := s.checkArchive(archive, file.Size); errRes != nil {
+		return nil, errRes
+	}
+	// Extract
+	result := &models.ImportRes{}
+	report := func(event *models.ImportEvent) {
+		if event.Status == models.IMPORT_CREATED {
+			result.Created++
+		}
+		progress(event)
+	}
+	fail := func(entryPath string, err error) {
+		result.Failed++
+		progress(&models.ImportEvent{
+			Path:   entryPath,
+			Status: models.IMPORT_FAILED,
+			Error:  err.Error(),
+		})
+	}
+	folders := map[string]*models.SystemFile{".": parentFolder}
+
+	var fatal *res.ErrorRes
+	err = utils.WalkArchive(archive, file.Size, func(entry *utils.ArchiveEntry) error {
+		entryPath, err := utils.CleanArchivePath(entry.Name)
+		if err != nil {
+			fail(entry.Name, errors.New("ruta no permitida"))
+			return nil
+		}
+		if entryPath == "" {
+			return nil
+		}
+		if entry.Irregular {
+			fail(entryPath, errors.New("tipo de elemento no soportado"))
+			return nil
+		}
+
+		var errRes *res.ErrorRes
+		if entry.IsDir {
+			_, errRes = s.ensureFolder(idRepositoryObj, folders, entryPath, report)
+		} else {
+			var folder, element *models.SystemFile
+
+			folder, errRes = s.ensureFolder(
+				idRepositoryObj,
+				folders,
+				path.Dir(entryPath),
+				report,
+			)
+			if errRes == nil {
+				element, errRes = s.importFile(
+					idRepositoryObj,
+					idUserObj,
+					folder,
+					path.Base(entryPath),
+					entry,
+				)
+			}
+			if errRes == nil {
+				report(&models.ImportEvent{
+					Path:   entryPath,
+					Status: models.IMPORT_CREATED,
+					ID:     element.ID.Hex(),
+				})
+			}
+		}
+		if errRes != nil {
+			// Without database there is nothing else to import
+			if errRes.StatusCode == http.StatusServiceUnavailable {
+				fatal = errRes
+				return errRes.Err
+			}
+			fail(entryPath, errRes.Err)
+		}
+		return nil
+	})
+	if fatal != nil {
+		return nil, fatal
+	}
+	if err != nil {
+		return nil, &res.ErrorRes{
+			Err:        errors.New("el archivo está dañado"),
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	result.Done = true
+	return result, nil
+}
+
 func NewSystemFileService() *SystemFileService {
 	return &SystemFileService{}
 }
@@ -0,0 +1,391 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/CPU-commits/USACH.dev-Server/db"
+	"github.com/CPU-commits/USACH.dev-Server/forms"
+	"github.com/CPU-commits/USACH.dev-Server/models"
+	"github.com/CPU-commits/USACH.dev-Server/res"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type TransferService struct{}
+
+func (*TransferService) TransferRepository(
+	idRepository,
+	idUser string,
+	transferForm *forms.TransferRepositoryForm,
+) (primitive.ObjectID, *res.ErrorRes) {
+	idObjRepository, err := primitive.ObjectIDFromHex(idRepository)
+	if err != nil {
+		return primitive.NilObjectID, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	idObjUser, err := primitive.ObjectIDFromHex(idUser)
+	if err != nil {
+		return primitive.NilObjectID, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	errRes := collaboratorService.CheckPermission(
+		idObjRepository,
+		idObjUser,
+		models.COLLABORATOR_OWNER,
+	)
+	if errRes != nil {
+		return primitive.NilObjectID, errRes
+	}
+	// Get new owner
+	user, errRes := userService.GetByUsername(transferForm.Username, false)
+	if errRes != nil {
+		return primitive.NilObjectID, errRes
+	}
+	if user == nil {
+		return primitive.NilObjectID, &res.ErrorRes{
+			Err:        errors.New("no existe el usuario"),
+			StatusCode: http.StatusNotFound,
+		}
+	}
+	if user.ID == idObjUser {
+		return primitive.NilObjectID, &res.ErrorRes{
+			Err:        errors.New("ya eres dueño del repositorio"),
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	// Only one pending transfer by repository
+	exists, err := transferModel.Exists(bson.D{{
+		Key:   "repository",
+		Value: idObjRepository,
+	}})
+	if err != nil {
+		return primitive.NilObjectID, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	if exists {
+		return primitive.NilObjectID, &res.ErrorRes{
+			Err:        errors.New("el repositorio ya tiene una transferencia pendiente"),
+			StatusCode: http.StatusConflict,
+		}
+	}
+	// Insert
+	transfer := transferModel.NewModel(idObjRepository, idObjUser, user.ID)
+	inserted, err := transferModel.Use().InsertOne(db.Ctx, transfer)
+	if err != nil {
+		return primitive.NilObjectID, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	return inserted.InsertedID.(primitive.ObjectID), nil
+}
+
+func (*TransferService) GetTransfers(idUser string) ([]models.TransferRes, *res.ErrorRes) {
+	idObjUser, err := primitive.ObjectIDFromHex(idUser)
+	if err != nil {
+		return nil, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	userProject := bson.A{bson.M{
+		"$project": bson.M{"username": 1, "full_name": 1},
+	}}
+	transfers := []models.TransferRes{}
+
+	cursor, err := transferModel.Use().Aggregate(db.Ctx, mongo.Pipeline{
+		bson.D{{
+			Key: "$match",
+			Value: bson.M{
+				"to": idObjUser,
+			},
+		}},
+		bson.D{{
+			Key:   "$sort",
+			Value: bson.M{"date": -1},
+		}},
+		bson.D{{
+			Key: "$lookup",
+			Value: bson.M{
+				"from":         models.REPOSITORY_COLLECTION,
+				"localField":   "repository",
+				"foreignField": "_id",
+				"as":           "repository",
+				"pipeline": bson.A{
+					bson.M{"$lookup": bson.M{
+						"from":         models.USERS_COLLECTION,
+						"localField":   "owner",
+						"foreignField": "_id",
+						"as":           "owner",
+						"pipeline":     userProject,
+					}},
+					bson.M{"$unwind": bson.M{"path": "$owner"}},
+					bson.M{"$project": bson.M{"name": 1, "owner": 1}},
+				},
+			},
+		}},
+		bson.D{{
+			Key: "$unwind",
+			Value: bson.M{
+				"path": "$repository",
+			},
+		}},
+		bson.D{{
+			Key: "$lookup",
+			Value: bson.M{
+				"from":         models.USERS_COLLECTION,
+				"localField":   "from",
+				"foreignField": "_id",
+				"as":           "from",
+				"pipeline":     userProject,
+			},
+		}},
+		bson.D{{
+			Key: "$unwind",
+			Value: bson.M{
+				"path": "$from",
+			},
+		}},
+	})
+	if err != nil {
+		return nil, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	if err := cursor.All(db.Ctx, &transfers); err != nil {
+		return nil, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	return transfers, nil
+}
+
+func (*TransferService) deleteTransfers(idObjRepository primitive.ObjectID) *res.ErrorRes {
+	_, err := transferModel.Use().DeleteMany(db.Ctx, bson.D{{
+		Key:   "repository",
+		Value: idObjRepository,
+	}})
+	if err != nil {
+		return &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	return nil
+}
+
+func (t *TransferService) AcceptTransfer(idTransfer, idUser string) *res.ErrorRes {
+	idObjTransfer, err := primitive.ObjectIDFromHex(idTransfer)
+	if err != nil {
+		return &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	idObjUser, err := primitive.ObjectIDFromHex(idUser)
+	if err != nil {
+		return &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	// Get transfer
+	var transfer *models.Transfer
+
+	cursor := transferModel.Use().FindOne(db.Ctx, bson.D{
+		{
+			Key:   "_id",
+			Value: idObjTransfer,
+		},
+		{
+			Key:   "to",
+			Value: idObjUser,
+		},
+	})
+	if err := cursor.Decode(&transfer); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return &res.ErrorRes{
+				Err:        errors.New("no existe la transferencia"),
+				StatusCode: http.StatusNotFound,
+			}
+		}
+		return &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	// Get repository
+	opts := options.FindOne().SetProjection(bson.D{
+		{
+			Key:   "owner",
+			Value: 1,
+		},
+		{
+			Key:   "name",
+			Value: 1,
+		},
+	})
+	repository, err := repoService.GetRepositoryById(transfer.Repository, opts)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return &res.ErrorRes{
+				Err:        errors.New("no existe el repositorio"),
+				StatusCode: http.StatusNotFound,
+			}
+		}
+		return &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	if repository.Owner != transfer.From {
+		if errRes := t.deleteTransfers(transfer.Repository); errRes != nil {
+			return errRes
+		}
+		return &res.ErrorRes{
+			Err:        errors.New("el repositorio cambió de dueño"),
+			StatusCode: http.StatusConflict,
+		}
+	}
+	existsRepo, errRes := repoService.ExistsRepoUser(idObjUser, repository.Name)
+	if errRes != nil {
+		return errRes
+	}
+	if existsRepo {
+		return &res.ErrorRes{
+			Err: fmt.Errorf(
+				"ya tienes un repositorio con el nombre %s",
+				repository.Name,
+			),
+			StatusCode: http.StatusConflict,
+		}
+	}
+	// Change owner, the old path redirects to the repository
+	errRes = repoService.removeRedirect(repository.Owner, repository.Name)
+	if errRes != nil {
+		return errRes
+	}
+	result, err := repoModel.Use().UpdateOne(
+		db.Ctx,
+		bson.D{
+			{
+				Key:   "_id",
+				Value: repository.ID,
+			},
+			{
+				Key:   "owner",
+				Value: transfer.From,
+			},
+		},
+		bson.D{
+			{
+				Key: "$set",
+				Value: bson.M{
+					"owner":        idObjUser,
+					"updated_date": primitive.NewDateTimeFromTime(time.Now()),
+				},
+			},
+			{
+				Key: "$push",
+				Value: bson.M{
+					"redirects": repoModel.NewRedirectModel(
+						repository.Owner,
+						repository.Name,
+					),
+				},
+			},
+		},
+	)
+	if err != nil {
+		return &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	if result.MatchedCount == 0 {
+		return &res.ErrorRes{
+			Err:        errors.New("el repositorio cambió de dueño"),
+			StatusCode: http.StatusConflict,
+		}
+	}
+	// The new owner is not a collaborator anymore
+	_, err = collaboratorModel.Use().DeleteOne(db.Ctx, bson.D{
+		{
+			Key:   "repository",
+			Value: repository.ID,
+		},
+		{
+			Key:   "user",
+			Value: idObjUser,
+		},
+	})
+	if err != nil {
+		return &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	return t.deleteTransfers(repository.ID)
+}
+
+// DeclineTransfer is used by the recipient to decline and by the owner
+// to cancel the transfer
+func (*TransferService) DeclineTransfer(idTransfer, idUser string) *res.ErrorRes {
+	idObjTransfer, err := primitive.ObjectIDFromHex(idTransfer)
+	if err != nil {
+		return &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	idObjUser, err := primitive.ObjectIDFromHex(idUser)
+	if err != nil {
+		return &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	result, err := transferModel.Use().DeleteOne(db.Ctx, bson.D{
+		{
+			Key:   "_id",
+			Value: idObjTransfer,
+		},
+		{
+			Key: "$or",
+			Value: bson.A{
+				bson.M{"to": idObjUser},
+				bson.M{"from": idObjUser},
+			},
+		},
+	})
+	if err != nil {
+		return &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	if result.DeletedCount == 0 {
+		return &res.ErrorRes{
+			Err:        errors.New("no existe la transferencia"),
+			StatusCode: http.StatusNotFound,
+		}
+	}
+	return nil
+}
+
+func NewTransferService() *TransferService {
+	return &TransferService{}
+}
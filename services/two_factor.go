@@ -0,0 +1,333 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/CPU-commits/USACH.dev-Server/db"
+	"github.com/CPU-commits/USACH.dev-Server/forms"
+	"github.com/CPU-commits/USACH.dev-Server/models"
+	"github.com/CPU-commits/USACH.dev-Server/res"
+	"github.com/CPU-commits/USACH.dev-Server/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	TWO_FACTOR_ISSUER         = "USACH.dev"
+	TWO_FACTOR_RECOVERY_CODES = 10
+	TWO_FACTOR_MAX_ATTEMPTS   = 5
+)
+
+type TwoFactorService struct{}
+
+func (*TwoFactorService) getUser(idUser string) (*models.User, *res.ErrorRes) {
+	idObjUser, err := primitive.ObjectIDFromHex(idUser)
+	if err != nil {
+		return nil, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	var user *models.User
+
+	cursor := userModel.Use().FindOne(db.Ctx, bson.D{{
+		Key:   "_id",
+		Value: idObjUser,
+	}})
+	if err := cursor.Decode(&user); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, &res.ErrorRes{
+				Err:        errors.New("no existe el usuario"),
+				StatusCode: http.StatusNotFound,
+			}
+		}
+		return nil, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	return user, nil
+}
+
+func (*TwoFactorService) normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.ReplaceAll(code, "-", "")
+}
+
+func (t *TwoFactorService) newRecoveryCodes() (codes []string, hashes []string, err error) {
+	for i := 0; i < TWO_FACTOR_RECOVERY_CODES; i++ {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		code := hex.EncodeToString(b)
+		hash, err := bcrypt.GenerateFromPassword([]byte(code), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, nil, err
+		}
+		codes = append(codes, fmt.Sprintf("%s-%s", code[:5], code[5:]))
+		hashes = append(hashes, string(hash))
+	}
+	return
+}
+
+// checkCode accepts a TOTP code or, if allowRecovery, one of the recovery
+// codes, which is consumed
+func (t *TwoFactorService) checkCode(
+	user *models.User,
+	code string,
+	allowRecovery bool,
+) (bool, *res.ErrorRes) {
+	if user.TwoFactor == nil {
+		return false, nil
+	}
+	// Brute force
+	attempts, err := mem.Incr(TWO_FACTOR_ATTEMPTS+user.ID.Hex(), 15*time.Minute)
+	if err != nil {
+		return false, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	if attempts > TWO_FACTOR_MAX_ATTEMPTS {
+		return false, &res.ErrorRes{
+			Err:        errors.New("demasiados intentos, intenta más tarde"),
+			StatusCode: http.StatusTooManyRequests,
+		}
+	}
+	// TOTP
+	valid, step, err := utils.ValidateTOTP(user.TwoFactor.Secret, code, time.Now())
+	if err != nil {
+		return false, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusInternalServerError,
+		}
+	}
+	if valid {
+		// A code can't be used twice
+		firstUse, err := mem.SetNX(
+			fmt.Sprintf("%s%s%d", TWO_FACTOR_STEP_USED, user.ID.Hex(), step),
+			"1",
+			time.Duration(utils.TOTP_PERIOD*(2*utils.TOTP_SKEW+1))*time.Second,
+		)
+		if err != nil {
+			return false, &res.ErrorRes{
+				Err:        err,
+				StatusCode: http.StatusServiceUnavailable,
+			}
+		}
+		if !firstUse {
+			return false, nil
+		}
+		return true, t.resetAttempts(user)
+	}
+	// Recovery codes
+	if !allowRecovery {
+		return false, nil
+	}
+	normalized := t.normalizeRecoveryCode(code)
+	for _, hash := range user.TwoFactor.RecoveryCodes {
+		if bcrypt.CompareHashAndPassword([]byte(hash), []byte(normalized)) != nil {
+			continue
+		}
+		// Only the request that removes the code uses it
+		result, err := userModel.Use().UpdateOne(
+			db.Ctx,
+			bson.D{
+				{
+					Key:   "_id",
+					Value: user.ID,
+				},
+				{
+					Key:   "two_factor.recovery_codes",
+					Value: hash,
+				},
+			},
+			bson.D{{
+				Key: "$pull",
+				Value: bson.M{
+					"two_factor.recovery_codes": hash,
+				},
+			}},
+		)
+		if err != nil {
+			return false, &res.ErrorRes{
+				Err:        err,
+				StatusCode: http.StatusServiceUnavailable,
+			}
+		}
+		if result.ModifiedCount != 1 {
+			return false, nil
+		}
+		return true, t.resetAttempts(user)
+	}
+	return false, nil
+}
+
+func (*TwoFactorService) resetAttempts(user *models.User) *res.ErrorRes {
+	if err := mem.Delete(TWO_FACTOR_ATTEMPTS + user.ID.Hex()); err != nil {
+		return &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	return nil
+}
+
+func (t *TwoFactorService) Enroll(idUser string) (map[string]interface{}, *res.ErrorRes) {
+	user, errRes := t.getUser(idUser)
+	if errRes != nil {
+		return nil, errRes
+	}
+	if user.TwoFactor != nil && user.TwoFactor.Enabled {
+		return nil, &res.ErrorRes{
+			Err:        errors.New("ya tienes activada la verificación en dos pasos"),
+			StatusCode: http.StatusConflict,
+		}
+	}
+	// New secret, pending until confirmed
+	secret, err := utils.NewTOTPSecret()
+	if err != nil {
+		return nil, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusInternalServerError,
+		}
+	}
+	_, err = userModel.Use().UpdateByID(db.Ctx, user.ID, bson.D{{
+		Key: "$set",
+		Value: bson.M{
+			"two_factor": &models.TwoFactor{
+				Enabled: false,
+				Secret:  secret,
+			},
+		},
+	}})
+	if err != nil {
+		return nil, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+
+	return map[string]interface{}{
+		"secret": secret,
+		"uri":    utils.TOTPURI(secret, TWO_FACTOR_ISSUER, user.Email),
+	}, nil
+}
+
+func (t *TwoFactorService) Confirm(
+	idUser string,
+	codeForm *forms.TwoFactorCodeForm,
+) ([]string, *res.ErrorRes) {
+	user, errRes := t.getUser(idUser)
+	if errRes != nil {
+		return nil, errRes
+	}
+	if user.TwoFactor == nil {
+		return nil, &res.ErrorRes{
+			Err:        errors.New("primero debes iniciar la activación"),
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	if user.TwoFactor.Enabled {
+		return nil, &res.ErrorRes{
+			Err:        errors.New("ya tienes activada la verificación en dos pasos"),
+			StatusCode: http.StatusConflict,
+		}
+	}
+	valid, errRes := t.checkCode(user, codeForm.Code, false)
+	if errRes != nil {
+		return nil, errRes
+	}
+	if !valid {
+		return nil, &res.ErrorRes{
+			Err:        errors.New("el código no es válido"),
+			StatusCode: http.StatusUnauthorized,
+		}
+	}
+	// Enable
+	codes, hashes, err := t.newRecoveryCodes()
+	if err != nil {
+		return nil, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusInternalServerError,
+		}
+	}
+	_, err = userModel.Use().UpdateByID(db.Ctx, user.ID, bson.D{{
+		Key: "$set",
+		Value: bson.M{
+			"two_factor.enabled":        true,
+			"two_factor.recovery_codes": hashes,
+		},
+	}})
+	if err != nil {
+		return nil, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+
+	return codes, nil
+}
+
+func (t *TwoFactorService) Disable(
+	idUser string,
+	disableForm *forms.TwoFactorDisableForm,
+) *res.ErrorRes {
+	user, errRes := t.getUser(idUser)
+	if errRes != nil {
+		return errRes
+	}
+	if user.TwoFactor == nil || !user.TwoFactor.Enabled {
+		return &res.ErrorRes{
+			Err:        errors.New("no tienes activada la verificación en dos pasos"),
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	err := bcrypt.CompareHashAndPassword(
+		[]byte(user.Password),
+		[]byte(disableForm.Password),
+	)
+	if err != nil {
+		return &res.ErrorRes{
+			Err:        errors.New("credenciales inválidas"),
+			StatusCode: http.StatusUnauthorized,
+		}
+	}
+	valid, errRes := t.checkCode(user, disableForm.Code, true)
+	if errRes != nil {
+		return errRes
+	}
+	if !valid {
+		return &res.ErrorRes{
+			Err:        errors.New("el código no es válido"),
+			StatusCode: http.StatusUnauthorized,
+		}
+	}
+	// Disable
+	_, err = userModel.Use().UpdateByID(db.Ctx, user.ID, bson.D{{
+		Key: "$unset",
+		Value: bson.M{
+			"two_factor": "",
+		},
+	}})
+	if err != nil {
+		return &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	return nil
+}
+
+func NewTwoFactorService() *TwoFactorService {
+	return &TwoFactorService{}
+}
@@ -0,0 +1,495 @@
+package services
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/CPU-commits/USACH.dev-Server/db"
+	"github.com/CPU-commits/USACH.dev-Server/models"
+	"github.com/CPU-commits/USACH.dev-Server/res"
+	"github.com/CPU-commits/USACH.dev-Server/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Resumable uploads follow the tus protocol
+const (
+	TUS_VERSION     = "1.0.0"
+	TUS_EXTENSIONS  = "creation,expiration,termination"
+	UPLOAD_MAX_SIZE = 5 << 30
+	// Uploads without new parts in this time are deleted
+	UPLOAD_EXPIRES = 24 * time.Hour
+)
+
+// Storage names of the parts begin with it, they are not stored files
+const UPLOAD_PART_PREFIX = "upload-"
+
+type UploadService struct{}
+
+// CreateUpload starts a resumable upload of a file for the folder of the
+// repository. Metadata needs the filename, and the parent folder if any.
+// An empty file is complete at once, its element is returned
+func (u *UploadService) CreateUpload(
+	idRepository,
+	idUser string,
+	length int64,
+	metadata map[string]string,
+) (*models.Upload, *models.SystemFile, *res.ErrorRes) {
+	idObjRepository, err := primitive.ObjectIDFromHex(idRepository)
+	if err != nil {
+		return nil, nil, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	idObjUser, err := primitive.ObjectIDFromHex(idUser)
+	if err != nil {
+		return nil, nil, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	existsRepo, err := repoModel.Exists(bson.D{{
+		Key:   "_id",
+		Value: idObjRepository,
+	}})
+	if err != nil {
+		return nil, nil, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	if !existsRepo {
+		return nil, nil, &res.ErrorRes{
+			Err:        errors.New("el repositorio no existe"),
+			StatusCode: http.StatusNotFound,
+		}
+	}
+	errRes := collaboratorService.CheckPermission(
+		idObjRepository,
+		idObjUser,
+		models.COLLABORATOR_WRITE,
+	)
+	if errRes != nil {
+		return nil, nil, errRes
+	}
+	if length < 0 {
+		return nil, nil, &res.ErrorRes{
+			Err:        errors.New("el largo de la subida no es válido"),
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	if length > UPLOAD_MAX_SIZE {
+		return nil, nil, &res.ErrorRes{
+			Err:        errors.New("el archivo es demasiado grande"),
+			StatusCode: http.StatusRequestEntityTooLarge,
+		}
+	}
+	// Element
+	name := metadata["filename"]
+	if name == "" {
+		return nil, nil, &res.ErrorRes{
+			Err:        errors.New("la subida necesita el nombre del archivo"),
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	if errRes := systemFileService.checkArchiveName(name); errRes != nil {
+		return nil, nil, errRes
+	}
+	folder, errRes := systemFileService.getFolder(idObjRepository, metadata["parent"])
+	if errRes != nil {
+		return nil, nil, errRes
+	}
+	errRes = systemFileService.checkName(idObjRepository, folder, name, primitive.NilObjectID)
+	if errRes != nil {
+		return nil, nil, errRes
+	}
+	var parent primitive.ObjectID
+	if folder != nil {
+		parent = folder.ID
+	}
+	upload := uploadModel.NewModel(
+		idObjRepository,
+		parent,
+		idObjUser,
+		name,
+		length,
+		UPLOAD_EXPIRES,
+	)
+	if _, err := uploadModel.Use().InsertOne(db.Ctx, upload); err != nil {
+		return nil, nil, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	// Empty files get no parts
+	if length == 0 {
+		element, errRes := u.finishUpload(upload)
+		if errRes != nil {
+			return nil, nil, errRes
+		}
+		return upload, element, nil
+	}
+	return upload, nil, nil
+}
+
+// GetUpload returns the upload, only its user can continue it
+func (*UploadService) GetUpload(
+	idRepository,
+	idUpload,
+	idUser string,
+) (*models.Upload, *res.ErrorRes) {
+	idObjRepository, err := primitive.ObjectIDFromHex(idRepository)
+	if err != nil {
+		return nil, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	idObjUpload, err := primitive.ObjectIDFromHex(idUpload)
+	if err != nil {
+		return nil, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	idObjUser, err := primitive.ObjectIDFromHex(idUser)
+	if err != nil {
+		return nil, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	var upload *models.Upload
+
+	cursor := uploadModel.Use().FindOne(db.Ctx, bson.D{
+		{
+			Key:   "_id",
+			Value: idObjUpload,
+		},
+		{
+			Key:   "repository",
+			Value: idObjRepository,
+		},
+		{
+			Key:   "user",
+			Value: idObjUser,
+		},
+	})
+	if err := cursor.Decode(&upload); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, &res.ErrorRes{
+				Err:        errors.New("no existe la subida"),
+				StatusCode: http.StatusNotFound,
+			}
+		}
+		return nil, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	if upload.Expires.Time().Before(time.Now()) {
+		return nil, &res.ErrorRes{
+			Err:        errors.New("la subida expiró"),
+			StatusCode: http.StatusGone,
+		}
+	}
+	return upload, nil
+}
+
+// partsReader reads the parts of an upload one after the other, only one
+// is open at a time
+type partsReader struct {
+	parts []models.UploadPart
+	file  io.ReadCloser
+}
+
+func (p *partsReader) Read(b []byte) (int, error) {
+	for {
+		if p.file == nil {
+			if len(p.parts) == 0 {
+				return 0, io.EOF
+			}
+			file, _, err := utils.OpenFile(p.parts[0].Name)
+			if err != nil {
+				return 0, err
+			}
+			p.file = file
+			p.parts = p.parts[1:]
+		}
+		n, err := p.file.Read(b)
+		if errors.Is(err, io.EOF) {
+			p.file.Close()
+			p.file = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+func (p *partsReader) Close() error {
+	if p.file == nil {
+		return nil
+	}
+	return p.file.Close()
+}
+
+// WritePart receives the bytes of the upload from offset, size is -1 if the
+// part does not tell it. Every part is saved in the storage, so any server
+// can continue the upload. When the upload is complete its file is added
+// to the repository and returned
+func (u *UploadService) WritePart(
+	upload *models.Upload,
+	offset,
+	size int64,
+	part io.Reader,
+) (*models.SystemFile, *res.ErrorRes) {
+	if offset != upload.Offset {
+		return nil, &res.ErrorRes{
+			Err:        errors.New("el offset no coincide con el de la subida"),
+			StatusCode: http.StatusConflict,
+		}
+	}
+	errTooLarge := &res.ErrorRes{
+		Err:        errors.New("la parte supera el largo de la subida"),
+		StatusCode: http.StatusRequestEntityTooLarge,
+	}
+	remaining := upload.Length - offset
+	if size > remaining {
+		return nil, errTooLarge
+	}
+	name := UPLOAD_PART_PREFIX + upload.ID.Hex() + "-" + primitive.NewObjectID().Hex()
+	// Another part may have been saved since the upload was read
+	filter := bson.D{
+		{
+			Key:   "_id",
+			Value: upload.ID,
+		},
+		{
+			Key:   "offset",
+			Value: offset,
+		},
+	}
+	result, err := uploadModel.Use().UpdateOne(db.Ctx, filter, bson.D{{
+		Key: "$push",
+		Value: bson.M{
+			"pending": name,
+		},
+	}})
+	if err != nil {
+		return nil, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	if result.MatchedCount == 0 {
+		return nil, &res.ErrorRes{
+			Err:        errors.New("el offset no coincide con el de la subida"),
+			StatusCode: http.StatusConflict,
+		}
+	}
+
+	written, errWrite := utils.SaveStream(name, io.LimitReader(part, remaining))
+	// A part without size can be longer too
+	if errWrite == nil && written == remaining {
+		if n, _ := io.ReadFull(part, make([]byte, 1)); n > 0 {
+			u.deletePart(upload.ID, name)
+			return nil, errTooLarge
+		}
+	}
+	// Save what was received, so the client resumes from there. Only
+	// one of the parts sent for the same offset is kept
+	expires := primitive.NewDateTimeFromTime(time.Now().Add(UPLOAD_EXPIRES))
+	update := bson.D{
+		{
+			Key: "$set",
+			Value: bson.M{
+				"offset":  offset + written,
+				"expires": expires,
+			},
+		},
+		{
+			Key: "$pull",
+			Value: bson.M{
+				"pending": name,
+			},
+		},
+	}
+	if written > 0 {
+		update = append(update, bson.E{
+			Key: "$push",
+			Value: bson.M{
+				"parts": models.UploadPart{
+					Name: name,
+					Size: written,
+				},
+			},
+		})
+	}
+	result, err = uploadModel.Use().UpdateOne(db.Ctx, filter, update)
+	if err != nil {
+		return nil, &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	if result.MatchedCount == 0 {
+		u.deletePart(upload.ID, name)
+		return nil, &res.ErrorRes{
+			Err:        errors.New("el offset no coincide con el de la subida"),
+			StatusCode: http.StatusConflict,
+		}
+	}
+	upload.Offset += written
+	upload.Expires = expires
+	if written > 0 {
+		upload.Parts = append(upload.Parts, models.UploadPart{
+			Name: name,
+			Size: written,
+		})
+	}
+	if errWrite != nil {
+		return nil, &res.ErrorRes{
+			Err:        errWrite,
+			StatusCode: http.StatusInternalServerError,
+		}
+	}
+	if upload.Offset < upload.Length {
+		return nil, nil
+	}
+	return u.finishUpload(upload)
+}
+
+// deletePart deletes a part that was not saved in the upload
+func (*UploadService) deletePart(idUpload primitive.ObjectID, name string) {
+	if err := utils.DeleteFile(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return
+	}
+	uploadModel.Use().UpdateOne(
+		db.Ctx,
+		bson.D{{
+			Key:   "_id",
+			Value: idUpload,
+		}},
+		bson.D{{
+			Key: "$pull",
+			Value: bson.M{
+				"pending": name,
+			},
+		}},
+	)
+}
+
+// finishUpload hands the file to the repository, the upload is deleted
+// even if it fails as there is nothing left to resume
+func (u *UploadService) finishUpload(upload *models.Upload) (*models.SystemFile, *res.ErrorRes) {
+	defer u.deleteUpload(upload.ID)
+
+	var size int64
+	for _, part := range upload.Parts {
+		size += part.Size
+	}
+	if size != upload.Length {
+		return nil, &res.ErrorRes{
+			Err:        errors.New("faltan partes de la subida"),
+			StatusCode: http.StatusInternalServerError,
+		}
+	}
+	file := &partsReader{parts: upload.Parts}
+	defer file.Close()
+
+	return systemFileService.NewUploadedFile(upload, file)
+}
+
+// deleteUpload deletes the upload with its parts. A part written after it
+// is deleted by its own request
+func (u *UploadService) deleteUpload(idUpload primitive.ObjectID) error {
+	var upload *models.Upload
+
+	cursor := uploadModel.Use().FindOneAndDelete(db.Ctx, bson.D{{
+		Key:   "_id",
+		Value: idUpload,
+	}})
+	if err := cursor.Decode(&upload); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil
+		}
+		return err
+	}
+	names := upload.Pending
+	for _, part := range upload.Parts {
+		names = append(names, part.Name)
+	}
+	for _, name := range names {
+		if err := utils.DeleteFile(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteUpload cancels the upload
+func (u *UploadService) DeleteUpload(upload *models.Upload) *res.ErrorRes {
+	if err := u.deleteUpload(upload.ID); err != nil {
+		return &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	return nil
+}
+
+// DeleteExpired deletes the abandoned uploads, and the parts left in the
+// folder of the server by requests that stopped
+func (u *UploadService) DeleteExpired() error {
+	var uploads []models.Upload
+
+	cursor, err := uploadModel.Use().Find(db.Ctx, bson.D{{
+		Key: "expires",
+		Value: bson.M{
+			"$lt": primitive.NewDateTimeFromTime(time.Now()),
+		},
+	}})
+	if err != nil {
+		return err
+	}
+	if err := cursor.All(db.Ctx, &uploads); err != nil {
+		return err
+	}
+	for _, upload := range uploads {
+		if err := u.deleteUpload(upload.ID); err != nil {
+			return err
+		}
+	}
+	// Parts being received
+	entries, err := os.ReadDir(settingsData.UPLOADS_FOLDER)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		if time.Since(info.ModTime()) > UPLOAD_EXPIRES {
+			os.Remove(filepath.Join(settingsData.UPLOADS_FOLDER, entry.Name()))
+		}
+	}
+	return nil
+}
+
+func NewUploadService() *UploadService {
+	return &UploadService{}
+}
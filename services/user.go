@@ -1,7 +1,10 @@
 package services
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"io"
 	"mime/multipart"
 	"net/http"
@@ -13,6 +16,7 @@ import (
 	"github.com/CPU-commits/USACH.dev-Server/models"
 	"github.com/CPU-commits/USACH.dev-Server/notifications/email"
 	"github.com/CPU-commits/USACH.dev-Server/res"
+	"github.com/CPU-commits/USACH.dev-Server/settings"
 	"github.com/CPU-commits/USACH.dev-Server/utils"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -93,9 +97,10 @@ func (u *UserService) GetByUsername(username string, getProfile bool) (*models.U
 		bson.D{{
 			Key: "$project",
 			Value: bson.M{
-				"status":   0,
-				"email":    0,
-				"password": 0,
+				"status":     0,
+				"email":      0,
+				"password":   0,
+				"two_factor": 0,
 			},
 		}},
 	}
@@ -109,6 +114,61 @@ func (u *UserService) GetByUsername(username string, getProfile bool) (*models.U
 					"localField":   "profile",
 					"foreignField": "_id",
 					"as":           "profile",
+					"pipeline": bson.A{
+						// Only public repositories are shown pinned
+						bson.D{{
+							Key: "$lookup",
+							Value: bson.M{
+								"from":         models.REPOSITORY_COLLECTION,
+								"localField":   "pinned",
+								"foreignField": "_id",
+								"as":           "pinned_repositories",
+								"pipeline": bson.A{
+									bson.M{"$match": bson.M{"access": "public"}},
+									bson.M{"$project": bson.M{
+										"name":        1,
+										"description": 1,
+										"stars":       1,
+										"tags":        1,
+									}},
+								},
+							},
+						}},
+						// Keep the order chosen by the user
+						bson.D{{
+							Key: "$addFields",
+							Value: bson.M{
+								"pinned": bson.M{
+									"$filter": bson.M{
+										"input": bson.M{
+											"$map": bson.M{
+												"input": bson.M{"$ifNull": bson.A{"$pinned", bson.A{}}},
+												"as":    "id",
+												"in": bson.M{
+													"$arrayElemAt": bson.A{
+														bson.M{"$filter": bson.M{
+															"input": "$pinned_repositories",
+															"as":    "repository",
+															"cond": bson.M{
+																"$eq": bson.A{"$$repository._id", "$$id"},
+															},
+														}},
+														0,
+													},
+												},
+											},
+										},
+										"as":   "repository",
+										"cond": bson.M{"$ne": bson.A{bson.M{"$type": "$$repository"}, "missing"}},
+									},
+								},
+							},
+						}},
+						bson.D{{
+							Key:   "$project",
+							Value: bson.M{"pinned_repositories": 0},
+						}},
+					},
 				},
 			}},
 			bson.D{{
@@ -154,33 +214,179 @@ func (u *UserService) GetUser(username string, getProfile bool) (*models.UserRes
 	if err != nil {
 		return nil, err
 	}
+	if user == nil {
+		return nil, nil
+	}
+	// Follows
+	followers, following, errCount := followService.CountFollows(user.ID)
+	if errCount != nil {
+		return nil, &res.ErrorRes{
+			Err:        errCount,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	user.Followers = followers
+	user.Following = following
 
 	return user, nil
 }
 
-func (uS *UserService) GetAvatar(username string, w io.Writer) *res.ErrorRes {
+func (*UserService) avatarFile(avatar string, size int) string {
+	return fmt.Sprintf("%s_%d.png", avatar, size)
+}
+
+// GetAvatar returns the smallest thumbnail at least as big as size
+func (uS *UserService) GetAvatar(username string, size int) (*utils.ServedFile, *res.ErrorRes) {
 	user, err := uS.GetByUsername(username, true)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if user == nil {
+		return nil, &res.ErrorRes{
+			Err:        errors.New("no existe el usuario"),
+			StatusCode: http.StatusNotFound,
+		}
+	}
+	if user.Profile == nil || user.Profile.Avatar == "" {
+		return nil, &res.ErrorRes{
+			Err:        errors.New("el usuario no tiene avatar"),
+			StatusCode: http.StatusNotFound,
+		}
+	}
+	// Avatars uploaded before thumbnails existed
+	nameFile := user.Profile.Avatar
+	if len(user.Profile.AvatarSizes) > 0 {
+		sizes := user.Profile.AvatarSizes
+		avatarSize := sizes[len(sizes)-1]
+		for _, s := range sizes {
+			if s >= size {
+				avatarSize = s
+				break
+			}
+		}
+		nameFile = uS.avatarFile(user.Profile.Avatar, avatarSize)
+	}
+	// A new avatar is a new file
+	return &utils.ServedFile{
+		NameFile: nameFile,
+		Hash:     nameFile,
+	}, nil
+}
+
+// processAvatar stores every thumbnail of the avatar and returns its name
+func (uS *UserService) processAvatar(avatarFile *multipart.FileHeader) (string, *res.ErrorRes) {
+	file, err := avatarFile.Open()
+	if err != nil {
+		return "", &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusBadRequest,
+		}
 	}
-	if user.Profile != nil {
-		avatar, err := utils.GetFile(user.Profile.Avatar)
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return "", &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	img, err := utils.DecodeImage(data)
+	if err != nil {
+		return "", &res.ErrorRes{
+			Err:        errors.New("el avatar debe ser una imagen jpeg, png, gif o webp"),
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	// Thumbnails of the same image are shared
+	hash := sha256.Sum256(data)
+	avatar := hex.EncodeToString(hash[:])
+	for _, size := range models.AVATAR_SIZES {
+		thumbnail, err := utils.EncodePNG(utils.SquareThumbnail(img, size))
+		if err == nil {
+			err = storedFileService.storeAs(uS.avatarFile(avatar, size), thumbnail)
+		}
 		if err != nil {
-			return &res.ErrorRes{
+			return "", &res.ErrorRes{
 				Err:        err,
 				StatusCode: http.StatusInternalServerError,
 			}
 		}
-		w.Write(avatar)
 	}
+	return avatar, nil
+}
+
+// avatarFiles returns the stored files of the avatar, legacy avatars are
+// a single file
+func (uS *UserService) avatarFiles(profile *models.Profile) []string {
+	if profile == nil || profile.Avatar == "" {
+		return nil
+	}
+	if len(profile.AvatarSizes) == 0 {
+		return []string{profile.Avatar}
+	}
+	var files []string
+	for _, size := range profile.AvatarSizes {
+		files = append(files, uS.avatarFile(profile.Avatar, size))
+	}
+	return files
+}
+
+// deleteAvatar releases the files of a replaced avatar, errors are ignored
+func (uS *UserService) deleteAvatar(profile *models.Profile) {
+	storedFileService.Unref(uS.avatarFiles(profile)...)
+}
 
+func (u *UserService) getEmailDomain(email string) *settings.EmailDomain {
+	at := strings.LastIndex(email, "@")
+	if at == -1 {
+		return nil
+	}
+	emailDomain := strings.ToLower(email[at+1:])
+	for _, domain := range settingsData.EMAIL_DOMAINS {
+		if domain.Domain == emailDomain {
+			return &domain
+		}
+	}
 	return nil
 }
 
+func (u *UserService) newUsername(
+	email string,
+	domain *settings.EmailDomain,
+) (string, *res.ErrorRes) {
+	username := email[:strings.LastIndex(email, "@")]
+	if domain.Username == settings.USERNAME_LOCAL_SUFFIX {
+		username = fmt.Sprintf("%s_%s", username, domain.Suffix)
+	}
+	// Same local part on another domain, number it
+	candidate := username
+	for i := 2; i <= 100; i++ {
+		exists, err := userModel.Exists(bson.D{{
+			Key:   "username",
+			Value: candidate,
+		}})
+		if err != nil {
+			return "", &res.ErrorRes{
+				Err:        err,
+				StatusCode: http.StatusServiceUnavailable,
+			}
+		}
+		if !exists {
+			return candidate, nil
+		}
+		candidate = fmt.Sprintf("%s%d", username, i)
+	}
+	return "", &res.ErrorRes{
+		Err:        errors.New("no se pudo generar un nombre de usuario"),
+		StatusCode: http.StatusConflict,
+	}
+}
+
 func (u *UserService) CreateUser(userForm *forms.UserForm) *res.ErrorRes {
-	if !strings.Contains(userForm.Email, "@usach.cl") {
+	domain := u.getEmailDomain(userForm.Email)
+	if domain == nil {
 		return &res.ErrorRes{
-			Err:        errors.New("el correo debe ser usach"),
+			Err:        errors.New("el correo debe pertenecer a una institución permitida"),
 			StatusCode: http.StatusBadRequest,
 		}
 	}
@@ -215,11 +421,20 @@ func (u *UserService) CreateUser(userForm *forms.UserForm) *res.ErrorRes {
 			StatusCode: http.StatusServiceUnavailable,
 		}
 	}
+	username, errRes := u.newUsername(userForm.Email, domain)
+	if errRes != nil {
+		return errRes
+	}
+	role := models.USER
+	if domain.Role != "" {
+		role = domain.Role
+	}
 	newUserModel := userModel.NewModel(
 		userForm.FullName,
 		userForm.Email,
+		username,
 		string(passwordHashed),
-		models.USER,
+		role,
 	)
 	// Insert model
 	insertedUser, err := userModel.Use().InsertOne(db.Ctx, newUserModel)
@@ -271,7 +486,10 @@ func (u *UserService) CreateUser(userForm *forms.UserForm) *res.ErrorRes {
 	return nil
 }
 
-func (u *UserService) ActivateUser(token string) *res.ErrorRes {
+func (u *UserService) getValidToken(
+	token,
+	permission string,
+) (*models.UserToken, *res.ErrorRes) {
 	// Search token
 	var userToken *models.UserToken
 
@@ -281,12 +499,12 @@ func (u *UserService) ActivateUser(token string) *res.ErrorRes {
 	}})
 	if err := cursor.Decode(&userToken); err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
-			return &res.ErrorRes{
+			return nil, &res.ErrorRes{
 				Err:        errors.New("el token no es válido"),
 				StatusCode: http.StatusUnauthorized,
 			}
 		} else {
-			return &res.ErrorRes{
+			return nil, &res.ErrorRes{
 				Err:        err,
 				StatusCode: http.StatusServiceUnavailable,
 			}
@@ -295,25 +513,33 @@ func (u *UserService) ActivateUser(token string) *res.ErrorRes {
 	// Check if is not expired
 	now := time.Now()
 	if now.After(userToken.FinishDate.Time()) {
-		return &res.ErrorRes{
+		return nil, &res.ErrorRes{
 			Err:        errors.New("el token no es válido"),
 			StatusCode: http.StatusUnauthorized,
 		}
 	}
 	// Check permissions
 	flag := false
-	for _, permission := range userToken.Permissions {
-		if permission == models.PERMISSION_CONFIRM_USER {
+	for _, p := range userToken.Permissions {
+		if p == permission {
 			flag = true
 			break
 		}
 	}
 	if !flag {
-		return &res.ErrorRes{
+		return nil, &res.ErrorRes{
 			Err:        errors.New("el token no es válido"),
 			StatusCode: http.StatusUnauthorized,
 		}
 	}
+	return userToken, nil
+}
+
+func (u *UserService) ActivateUser(token string) *res.ErrorRes {
+	userToken, errRes := u.getValidToken(token, models.PERMISSION_CONFIRM_USER)
+	if errRes != nil {
+		return errRes
+	}
 	// Active
 	_, err := userModel.Use().UpdateByID(db.Ctx, userToken.User, bson.D{{
 		Key: "$set",
@@ -330,7 +556,7 @@ func (u *UserService) ActivateUser(token string) *res.ErrorRes {
 	// Get user
 	var user models.User
 
-	cursor = userModel.Use().FindOne(db.Ctx, bson.D{{
+	cursor := userModel.Use().FindOne(db.Ctx, bson.D{{
 		Key:   "_id",
 		Value: userToken.User,
 	}})
@@ -344,7 +570,218 @@ func (u *UserService) ActivateUser(token string) *res.ErrorRes {
 	return nil
 }
 
-func (*UserService) UpdateProfile(
+func (u *UserService) ForgotPassword(forgotForm *forms.ForgotPasswordForm) *res.ErrorRes {
+	user, errRes := u.FindByEmail(forgotForm.Email)
+	if errRes != nil {
+		// Don't reveal if the email is registered
+		if errRes.StatusCode == http.StatusNotFound {
+			return nil
+		}
+		return errRes
+	}
+	if !user.Status {
+		return nil
+	}
+	// Only one reset token alive per user
+	_, err := usersTokenModel.Use().DeleteMany(db.Ctx, bson.D{
+		{
+			Key:   "user",
+			Value: user.ID,
+		},
+		{
+			Key:   "permissions",
+			Value: models.PERMISSION_RESET_PASSWORD,
+		},
+	})
+	if err != nil {
+		return &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	// Create token to reset password
+	finishDate := time.Now().Add(time.Hour)
+	userToken, err := usersTokenModel.NewModel(
+		user.ID,
+		primitive.NewDateTimeFromTime(finishDate),
+		[]string{models.PERMISSION_RESET_PASSWORD},
+	)
+	if err != nil {
+		return &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusInternalServerError,
+		}
+	}
+	_, err = usersTokenModel.Use().InsertOne(db.Ctx, userToken)
+	if err != nil {
+		return &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	// Send email to reset password
+	err = email.SendEmail(&email.MailConfig{
+		From:     "info@usach.dev",
+		To:       user.Email,
+		Subject:  "Restablece tu contraseña - USACH.dev",
+		Template: email.TEMPLATE_RESET_PASSWORD,
+		TemplateParams: map[string]string{
+			"{{ CLIENT_URL }}":  "https://usach.dev",
+			"{{ RESET_TOKEN }}": userToken.Token,
+		},
+	})
+	if err != nil {
+		return &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+
+	return nil
+}
+
+func (u *UserService) ResetPassword(resetForm *forms.ResetPasswordForm) *res.ErrorRes {
+	userToken, errRes := u.getValidToken(
+		resetForm.Token,
+		models.PERMISSION_RESET_PASSWORD,
+	)
+	if errRes != nil {
+		return errRes
+	}
+	// Hash new password
+	passwordHashed, err := bcrypt.GenerateFromPassword(
+		[]byte(resetForm.Password),
+		bcrypt.DefaultCost,
+	)
+	if err != nil {
+		return &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	_, err = userModel.Use().UpdateByID(db.Ctx, userToken.User, bson.D{{
+		Key: "$set",
+		Value: bson.M{
+			"password": string(passwordHashed),
+		},
+	}})
+	if err != nil {
+		return &res.ErrorRes{
+			Err:        errors.New("no se pudo cambiar tu contraseña, intenta nuevamente"),
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	// Invalidate all user tokens
+	_, err = usersTokenModel.Use().DeleteMany(db.Ctx, bson.D{{
+		Key:   "user",
+		Value: userToken.User,
+	}})
+	if err != nil {
+		return &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+	// Close all user sessions
+	if errRes := sessionService.RevokeAll(userToken.User.Hex()); errRes != nil {
+		return errRes
+	}
+
+	return nil
+}
+
+// profileUpdate returns the fields to set and unset from the form
+func (*UserService) profileUpdate(
+	idObjUser primitive.ObjectID,
+	profile *forms.ProfileForm,
+) (bson.D, bson.D, *res.ErrorRes) {
+	var set, unset bson.D
+	if profile == nil {
+		return set, unset, nil
+	}
+	setOrUnset := func(key, value string) {
+		if value == "" {
+			unset = append(unset, bson.E{Key: key, Value: ""})
+		} else {
+			set = append(set, bson.E{Key: key, Value: value})
+		}
+	}
+	if profile.Description != "" {
+		set = append(set, bson.E{
+			Key:   "description",
+			Value: profile.Description,
+		})
+	}
+	// Media
+	if profile.Instagram != nil {
+		setOrUnset("media.instagram", strings.TrimPrefix(*profile.Instagram, "@"))
+	}
+	if profile.Github != nil {
+		setOrUnset("media.github", strings.TrimPrefix(*profile.Github, "@"))
+	}
+	if profile.Twitter != nil {
+		setOrUnset("media.twitter", strings.TrimPrefix(*profile.Twitter, "@"))
+	}
+	if profile.Career != nil {
+		setOrUnset("career", strings.TrimSpace(*profile.Career))
+	}
+	if profile.Website != nil {
+		setOrUnset("website", *profile.Website)
+	}
+	if profile.EntryYear != nil {
+		if *profile.EntryYear == 0 {
+			unset = append(unset, bson.E{Key: "entry_year", Value: ""})
+		} else {
+			set = append(set, bson.E{Key: "entry_year", Value: *profile.EntryYear})
+		}
+	}
+	// Pinned repositories
+	if profile.Pinned != nil {
+		pinned := []primitive.ObjectID{}
+		for _, idRepository := range *profile.Pinned {
+			if idRepository == "" {
+				continue
+			}
+			idObjRepository, _ := primitive.ObjectIDFromHex(idRepository)
+			repeated, _ := utils.AnyMatch(pinned, func(x interface{}) bool {
+				return x.(primitive.ObjectID) == idObjRepository
+			})
+			if !repeated {
+				pinned = append(pinned, idObjRepository)
+			}
+		}
+		if len(pinned) == 0 {
+			unset = append(unset, bson.E{Key: "pinned", Value: ""})
+		} else {
+			owned, err := repoModel.Use().CountDocuments(db.Ctx, bson.D{
+				{
+					Key:   "_id",
+					Value: bson.M{"$in": pinned},
+				},
+				{
+					Key:   "owner",
+					Value: idObjUser,
+				},
+			})
+			if err != nil {
+				return nil, nil, &res.ErrorRes{
+					Err:        err,
+					StatusCode: http.StatusServiceUnavailable,
+				}
+			}
+			if int(owned) != len(pinned) {
+				return nil, nil, &res.ErrorRes{
+					Err:        errors.New("solo puedes fijar tus propios repositorios"),
+					StatusCode: http.StatusBadRequest,
+				}
+			}
+			set = append(set, bson.E{Key: "pinned", Value: pinned})
+		}
+	}
+	return set, unset, nil
+}
+
+func (u *UserService) UpdateProfile(
 	idUser string,
 	profile *forms.ProfileForm,
 	avatarFile *multipart.FileHeader,
@@ -357,30 +794,45 @@ func (*UserService) UpdateProfile(
 			StatusCode: http.StatusBadRequest,
 		}
 	}
-	// Upload avatar
-	var avatar string
-
-	if avatarFile != nil {
-		avatar, err = utils.UploadFile(avatarFile)
-		if err != nil {
-			return &res.ErrorRes{
-				Err:        err,
-				StatusCode: http.StatusInternalServerError,
-			}
-		}
+	set, unset, errRes := u.profileUpdate(idObjUser, profile)
+	if errRes != nil {
+		return errRes
 	}
-	// Set profile
-	exists, err := profileModel.Exists(bson.D{{
+	// Current profile
+	var oldProfile *models.Profile
+
+	cursor := profileModel.Use().FindOne(db.Ctx, bson.D{{
 		Key:   "user",
 		Value: idObjUser,
 	}})
-	if err != nil {
+	if err := cursor.Decode(&oldProfile); err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
 		return &res.ErrorRes{
 			Err:        err,
 			StatusCode: http.StatusServiceUnavailable,
 		}
 	}
-	if !exists {
+	// Upload avatar
+	var avatar string
+
+	if avatarFile != nil {
+		avatar, errRes = u.processAvatar(avatarFile)
+		if errRes != nil {
+			return errRes
+		}
+		set = append(
+			set,
+			bson.E{
+				Key:   "avatar",
+				Value: avatar,
+			},
+			bson.E{
+				Key:   "avatar_sizes",
+				Value: models.AVATAR_SIZES,
+			},
+		)
+	}
+	// Set profile
+	if oldProfile == nil {
 		modelProfile := profileModel.NewModel(
 			idObjUser,
 			profile,
@@ -412,35 +864,30 @@ func (*UserService) UpdateProfile(
 				StatusCode: http.StatusServiceUnavailable,
 			}
 		}
-	} else {
-		var update bson.D
-		if profile != nil && profile.Description != "" {
-			update = append(update, bson.E{
-				Key:   "description",
-				Value: profile.Description,
-			})
-		}
-		if avatar != "" {
-			update = append(update, bson.E{
-				Key:   "avatar",
-				Value: avatar,
-			})
-		}
-
-		_, err := profileModel.Use().UpdateOne(db.Ctx, bson.D{{
-			Key:   "user",
-			Value: idObjUser,
-		}}, bson.D{{
-			Key:   "$set",
-			Value: update,
-		}})
-		if err != nil {
-			return &res.ErrorRes{
-				Err:        err,
-				StatusCode: http.StatusServiceUnavailable,
-			}
+	}
+	var update bson.D
+	if len(set) > 0 {
+		update = append(update, bson.E{Key: "$set", Value: set})
+	}
+	if len(unset) > 0 {
+		update = append(update, bson.E{Key: "$unset", Value: unset})
+	}
+	if len(update) == 0 {
+		return nil
+	}
+	_, err = profileModel.Use().UpdateOne(db.Ctx, bson.D{{
+		Key:   "user",
+		Value: idObjUser,
+	}}, update)
+	if err != nil {
+		return &res.ErrorRes{
+			Err:        err,
+			StatusCode: http.StatusServiceUnavailable,
 		}
 	}
+	if avatar != "" {
+		u.deleteAvatar(oldProfile)
+	}
 	return nil
 }
 
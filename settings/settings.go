@@ -1,9 +1,12 @@
 package settings
 
 import (
+	"encoding/json"
 	"log"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"sync"
 
 	"github.com/joho/godotenv"
@@ -12,6 +15,33 @@ import (
 var lock = &sync.Mutex{}
 var singleSettingsInstace *settings
 
+// Username rules
+const (
+	// juan.perez@usach.cl -> juan.perez
+	USERNAME_LOCAL = "local"
+	// juan.perez@uchile.cl -> juan.perez_uchile
+	USERNAME_LOCAL_SUFFIX = "local_suffix"
+)
+
+// Institutional email domain allowed to register
+type EmailDomain struct {
+	Domain   string `json:"domain"`
+	Username string `json:"username"`
+	// Suffix for USERNAME_LOCAL_SUFFIX, defaults to the first label of Domain
+	Suffix string `json:"suffix,omitempty"`
+	// Role given on registration, defaults to the user role
+	Role string `json:"role,omitempty"`
+}
+
+// Storage drivers of the uploaded files
+const (
+	STORAGE_LOCAL = "local"
+	// S3 or any compatible service, like MinIO
+	STORAGE_S3 = "s3"
+)
+
+const defaultEmailDomains = `[{"domain":"usach.cl","username":"local"}]`
+
 type settings struct {
 	JWT_SECRET_KEY      string
 	JWT_SECRET_REFRESH  string
@@ -32,6 +62,49 @@ type settings struct {
 	REDIS_URI           string
 	REDIS_PASS          string
 	REDIS_DB            int
+	EMAIL_DOMAINS       []EmailDomain
+	// Versions kept by file, older ones are deleted
+	FILE_VERSIONS_LIMIT int
+
+	// Where uploaded files are kept, MEDIA_FOLDER is used by the local one
+	STORAGE_DRIVER string
+	// Empty for AWS, the URL of the service for S3 compatible ones
+	AWS_ENDPOINT          string
+	AWS_ACCESS_KEY_ID     string
+	AWS_SECRET_ACCESS_KEY string
+	// Parts of resumable uploads while they are received, the storage
+	// keeps them after
+	UPLOADS_FOLDER string
+}
+
+func parseEmailDomains(raw string) []EmailDomain {
+	if raw == "" {
+		raw = defaultEmailDomains
+	}
+	var domains []EmailDomain
+	if err := json.Unmarshal([]byte(raw), &domains); err != nil {
+		panic("EMAIL_DOMAINS Must be a JSON array")
+	}
+	for i, domain := range domains {
+		if domain.Domain == "" {
+			panic("EMAIL_DOMAINS Every domain needs a name")
+		}
+		domains[i].Domain = strings.ToLower(domain.Domain)
+		switch domain.Username {
+		case "":
+			domains[i].Username = USERNAME_LOCAL
+		case USERNAME_LOCAL, USERNAME_LOCAL_SUFFIX:
+		default:
+			panic("EMAIL_DOMAINS Unknown username rule " + domain.Username)
+		}
+		if domain.Role != "" && domain.Role != "a" && domain.Role != "b" {
+			panic("EMAIL_DOMAINS Unknown role " + domain.Role)
+		}
+		if domains[i].Username == USERNAME_LOCAL_SUFFIX && domain.Suffix == "" {
+			domains[i].Suffix = strings.Split(domains[i].Domain, ".")[0]
+		}
+	}
+	return domains
 }
 
 func newSettings() *settings {
@@ -43,8 +116,32 @@ func newSettings() *settings {
 	if err != nil {
 		panic("REDIS_DB Must be a int")
 	}
+	fileVersionsLimit := 10
+	if limit := os.Getenv("FILE_VERSIONS_LIMIT"); limit != "" {
+		fileVersionsLimit, err = strconv.Atoi(limit)
+		if err != nil || fileVersionsLimit < 1 {
+			panic("FILE_VERSIONS_LIMIT Must be a positive int")
+		}
+	}
+	storageDriver := os.Getenv("STORAGE_DRIVER")
+	switch storageDriver {
+	case "":
+		storageDriver = STORAGE_LOCAL
+	case STORAGE_LOCAL:
+	case STORAGE_S3:
+		if os.Getenv("AWS_BUCKET") == "" || os.Getenv("AWS_REGION") == "" {
+			panic("STORAGE_DRIVER s3 needs AWS_BUCKET and AWS_REGION")
+		}
+	default:
+		panic("STORAGE_DRIVER Must be local or s3")
+	}
+	uploadsFolder := os.Getenv("UPLOADS_FOLDER")
+	if uploadsFolder == "" {
+		uploadsFolder = filepath.Join(os.TempDir(), "uploads")
+	}
 	return &settings{
 		JWT_SECRET_KEY:      os.Getenv("JWT_SECRET_KEY"),
+		JWT_SECRET_REFRESH:  os.Getenv("JWT_SECRET_REFRESH"),
 		MONGO_DB:            os.Getenv("MONGO_DB"),
 		MONGO_ROOT_USERNAME: os.Getenv("MONGO_ROOT_USERNAME"),
 		MONGO_ROOT_PASSWORD: os.Getenv("MONGO_ROOT_PASSWORD"),
@@ -62,6 +159,14 @@ func newSettings() *settings {
 		REDIS_URI:           os.Getenv("REDIS_URI"),
 		REDIS_PASS:          os.Getenv("REDIS_PASS"),
 		REDIS_DB:            redisDB,
+		EMAIL_DOMAINS:       parseEmailDomains(os.Getenv("EMAIL_DOMAINS")),
+		FILE_VERSIONS_LIMIT: fileVersionsLimit,
+
+		STORAGE_DRIVER:        storageDriver,
+		AWS_ENDPOINT:          os.Getenv("AWS_ENDPOINT"),
+		AWS_ACCESS_KEY_ID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		AWS_SECRET_ACCESS_KEY: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		UPLOADS_FOLDER:        uploadsFolder,
 	}
 }
 
@@ -14,6 +14,10 @@ func (s *Stack) Set(key, value string, exp time.Duration) error {
 	return s.redisClient.Set(ctx, key, value, exp).Err()
 }
 
+func (s *Stack) SetNX(key, value string, exp time.Duration) (bool, error) {
+	return s.redisClient.SetNX(ctx, key, value, exp).Result()
+}
+
 func (s *Stack) Get(key string) (string, error) {
 	return s.redisClient.Get(ctx, key).Result()
 }
@@ -22,6 +26,44 @@ func (s *Stack) Delete(keys ...string) error {
 	return s.redisClient.Del(ctx, keys...).Err()
 }
 
+func (s *Stack) Incr(key string, exp time.Duration) (int64, error) {
+	value, err := s.redisClient.Incr(ctx, key).Result()
+	if err != nil {
+		return 0, err
+	}
+	if value == 1 {
+		if err := s.redisClient.Expire(ctx, key, exp).Err(); err != nil {
+			return 0, err
+		}
+	}
+	return value, nil
+}
+
+func (s *Stack) Expire(key string, exp time.Duration) error {
+	return s.redisClient.Expire(ctx, key, exp).Err()
+}
+
+// Sets
+func (s *Stack) SAdd(key string, members ...string) error {
+	values := make([]interface{}, len(members))
+	for i, member := range members {
+		values[i] = member
+	}
+	return s.redisClient.SAdd(ctx, key, values...).Err()
+}
+
+func (s *Stack) SMembers(key string) ([]string, error) {
+	return s.redisClient.SMembers(ctx, key).Result()
+}
+
+func (s *Stack) SRem(key string, members ...string) error {
+	values := make([]interface{}, len(members))
+	for i, member := range members {
+		values[i] = member
+	}
+	return s.redisClient.SRem(ctx, key, values...).Err()
+}
+
 func NewStack() *Stack {
 	return &Stack{
 		redisClient: rdb,
@@ -0,0 +1,243 @@
+package utils
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"mime/multipart"
+	"path"
+	"strings"
+	"time"
+)
+
+var (
+	ErrUnsupportedArchive = errors.New("unsupported archive")
+	ErrUnsafePath         = errors.New("unsafe path")
+)
+
+var (
+	zipMagic  = []byte("PK\x03\x04")
+	gzipMagic = []byte{0x1f, 0x8b}
+)
+
+type ArchiveEntry struct {
+	Name  string
+	IsDir bool
+	// Symlinks, devices and the like
+	Irregular bool
+	Size      int64
+	// Zero when unknown
+	CompressedSize int64
+	// Only valid inside the walk callback
+	Open func() (io.ReadCloser, error)
+}
+
+// WalkArchive calls fn with every entry of a zip or tar.gz archive, in
+// the order they are stored
+func WalkArchive(file multipart.File, size int64, fn func(*ArchiveEntry) error) error {
+	magic := make([]byte, 4)
+	if _, err := file.ReadAt(magic, 0); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	if bytes.HasPrefix(magic, zipMagic) {
+		return walkZip(file, size, fn)
+	}
+	if bytes.HasPrefix(magic, gzipMagic) {
+		return walkTarGz(file, fn)
+	}
+	return ErrUnsupportedArchive
+}
+
+func walkZip(file multipart.File, size int64, fn func(*ArchiveEntry) error) error {
+	reader, err := zip.NewReader(file, size)
+	if err != nil {
+		return err
+	}
+	for _, zipFile := range reader.File {
+		zipFile := zipFile
+		mode := zipFile.Mode()
+		err := fn(&ArchiveEntry{
+			Name:           zipFile.Name,
+			IsDir:          mode.IsDir(),
+			Irregular:      !mode.IsDir() && !mode.IsRegular(),
+			Size:           int64(zipFile.UncompressedSize64),
+			CompressedSize: int64(zipFile.CompressedSize64),
+			Open:           zipFile.Open,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func walkTarGz(file multipart.File, fn func(*ArchiveEntry) error) error {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	gzipReader, err := gzip.NewReader(file)
+	if err != nil {
+		return err
+	}
+	defer gzipReader.Close()
+
+	reader := tar.NewReader(gzipReader)
+	for {
+		header, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		// PAX global headers carry no element
+		if header.Typeflag == tar.TypeXGlobalHeader {
+			continue
+		}
+		isDir := header.Typeflag == tar.TypeDir
+		err = fn(&ArchiveEntry{
+			Name:      header.Name,
+			IsDir:     isDir,
+			Irregular: !isDir && header.Typeflag != tar.TypeReg,
+			Size:      header.Size,
+			Open: func() (io.ReadCloser, error) {
+				return io.NopCloser(reader), nil
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// CleanArchivePath returns the slash separated path of an entry, paths
+// that could leave the folder they are extracted to are rejected
+func CleanArchivePath(name string) (string, error) {
+	name = strings.ReplaceAll(name, "\\", "/")
+	if strings.HasPrefix(name, "/") || (len(name) > 1 && name[1] == ':') {
+		return "", ErrUnsafePath
+	}
+	for _, part := range strings.Split(name, "/") {
+		if part == ".." {
+			return "", ErrUnsafePath
+		}
+	}
+	cleaned := path.Clean(name)
+	if cleaned == "." {
+		return "", nil
+	}
+	return cleaned, nil
+}
+
+// Formats of downloaded archives
+const (
+	ARCHIVE_ZIP    = "zip"
+	ARCHIVE_TAR_GZ = "tar.gz"
+)
+
+var ErrUnsupportedFormat = errors.New("unsupported format")
+
+// ArchiveWriter writes the entries as they come, so the archive is never
+// held in memory
+type ArchiveWriter interface {
+	AddFolder(name string, modified time.Time) error
+	AddFile(name string, modified time.Time, size int64, r io.Reader) error
+	Close() error
+}
+
+type zipArchive struct {
+	writer *zip.Writer
+}
+
+func (z *zipArchive) AddFolder(name string, modified time.Time) error {
+	_, err := z.writer.CreateHeader(&zip.FileHeader{
+		Name:     name + "/",
+		Modified: modified,
+	})
+	return err
+}
+
+func (z *zipArchive) AddFile(name string, modified time.Time, size int64, r io.Reader) error {
+	w, err := z.writer.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: modified,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, r)
+	return err
+}
+
+func (z *zipArchive) Close() error {
+	return z.writer.Close()
+}
+
+type tarGzArchive struct {
+	gzip *gzip.Writer
+	tar  *tar.Writer
+}
+
+func (t *tarGzArchive) AddFolder(name string, modified time.Time) error {
+	return t.tar.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeDir,
+		Name:     name + "/",
+		Mode:     0755,
+		ModTime:  modified,
+	})
+}
+
+func (t *tarGzArchive) AddFile(name string, modified time.Time, size int64, r io.Reader) error {
+	err := t.tar.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     size,
+		Mode:     0644,
+		ModTime:  modified,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.CopyN(t.tar, r, size)
+	return err
+}
+
+func (t *tarGzArchive) Close() error {
+	if err := t.tar.Close(); err != nil {
+		return err
+	}
+	return t.gzip.Close()
+}
+
+func NewArchiveWriter(format string, w io.Writer) (ArchiveWriter, error) {
+	switch format {
+	case ARCHIVE_ZIP:
+		return &zipArchive{writer: zip.NewWriter(w)}, nil
+	case ARCHIVE_TAR_GZ:
+		gzipWriter := gzip.NewWriter(w)
+		return &tarGzArchive{
+			gzip: gzipWriter,
+			tar:  tar.NewWriter(gzipWriter),
+		}, nil
+	}
+	return nil, ErrUnsupportedFormat
+}
+
+func ArchiveContentType(format string) string {
+	if format == ARCHIVE_TAR_GZ {
+		return "application/gzip"
+	}
+	return "application/zip"
+}
+
+// SafeArchiveName keeps a name as a single entry of an archive path
+func SafeArchiveName(name string) string {
+	if name == "" || name == "." || name == ".." {
+		return "_"
+	}
+	return strings.NewReplacer("/", "_", "\\", "_").Replace(name)
+}
@@ -0,0 +1,203 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	// Lines of context around each change
+	DIFF_CONTEXT = 3
+	// Above this number of edits the diff is not worth showing
+	DIFF_MAX_EDITS = 2000
+)
+
+var ErrDiffTooLarge = errors.New("diff too large")
+
+type diffLine struct {
+	kind byte
+	text string
+}
+
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// myers returns the shortest edit script from a to b, E. Myers "An O(ND)
+// difference algorithm and its variations"
+func myers(a, b []string) ([]diffLine, error) {
+	n, m := len(a), len(b)
+	max := n + m
+	offset := max + 1
+	v := make([]int, 2*max+3)
+	// Frontier of every d, only the diagonals it reached
+	var trace [][]int
+
+	for d := 0; d <= max; d++ {
+		if d > DIFF_MAX_EDITS {
+			return nil, ErrDiffTooLarge
+		}
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return backtrack(a, b, trace, d), nil
+			}
+		}
+		trace = append(trace, append([]int(nil), v[offset-d:offset+d+1]...))
+	}
+	return nil, nil
+}
+
+func backtrack(a, b []string, trace [][]int, d int) []diffLine {
+	var lines []diffLine
+	x, y := len(a), len(b)
+
+	for ; d > 0; d-- {
+		prev := trace[d-1]
+		at := func(k int) int { return prev[k+d-1] }
+		k := x - y
+
+		var prevK int
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := at(prevK)
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			lines = append(lines, diffLine{' ', a[x-1]})
+			x--
+			y--
+		}
+		if x == prevX {
+			lines = append(lines, diffLine{'+', b[y-1]})
+			y--
+		} else {
+			lines = append(lines, diffLine{'-', a[x-1]})
+			x--
+		}
+	}
+	for x > 0 && y > 0 {
+		lines = append(lines, diffLine{' ', a[x-1]})
+		x--
+		y--
+	}
+	// Reverse
+	for i, j := 0, len(lines)-1; i < j; i, j = i+1, j-1 {
+		lines[i], lines[j] = lines[j], lines[i]
+	}
+	return lines
+}
+
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprint(start + 1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+// UnifiedDiff returns the changes from one text to the other in the
+// unified format, empty if both are equal
+func UnifiedDiff(fromName, toName, from, to string) (string, error) {
+	if from == to {
+		return "", nil
+	}
+	a, b := splitLines(from), splitLines(to)
+	// Common prefix and suffix are not part of the search
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix &&
+		a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	edits, err := myers(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])
+	if err != nil {
+		return "", err
+	}
+	lines := make([]diffLine, 0, prefix+len(edits)+suffix)
+	for _, line := range a[:prefix] {
+		lines = append(lines, diffLine{' ', line})
+	}
+	lines = append(lines, edits...)
+	for _, line := range a[len(a)-suffix:] {
+		lines = append(lines, diffLine{' ', line})
+	}
+	// Line of each text where every diff line starts
+	aLines := make([]int, len(lines)+1)
+	bLines := make([]int, len(lines)+1)
+	for i, line := range lines {
+		aLines[i+1], bLines[i+1] = aLines[i], bLines[i]
+		if line.kind != '+' {
+			aLines[i+1]++
+		}
+		if line.kind != '-' {
+			bLines[i+1]++
+		}
+	}
+
+	var diff strings.Builder
+	fmt.Fprintf(&diff, "--- %s\n+++ %s\n", fromName, toName)
+	for i := 0; i < len(lines); {
+		if lines[i].kind == ' ' {
+			i++
+			continue
+		}
+		start := i - DIFF_CONTEXT
+		if start < 0 {
+			start = 0
+		}
+		end := i + 1
+		for j := i + 1; j < len(lines); j++ {
+			if lines[j].kind != ' ' {
+				end = j + 1
+			} else if j-end >= 2*DIFF_CONTEXT {
+				break
+			}
+		}
+		end += DIFF_CONTEXT
+		if end > len(lines) {
+			end = len(lines)
+		}
+		fmt.Fprintf(
+			&diff,
+			"@@ -%s +%s @@\n",
+			hunkRange(aLines[start], aLines[end]-aLines[start]),
+			hunkRange(bLines[start], bLines[end]-bLines[start]),
+		)
+		for _, line := range lines[start:end] {
+			diff.WriteByte(line.kind)
+			diff.WriteString(line.text)
+			if !strings.HasSuffix(line.text, "\n") {
+				diff.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		i = end
+	}
+	return diff.String(), nil
+}
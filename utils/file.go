@@ -2,46 +2,142 @@ package utils
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"io"
-	"io/fs"
-	"mime/multipart"
 	"os"
-	"path/filepath"
-	"strings"
-
-	"github.com/google/uuid"
 )
 
-func UploadFile(fileHeader *multipart.FileHeader) (string, error) {
-	uniqueID, err := uuid.NewUUID()
-	if err != nil {
-		return "", nil
+// HashedContent is a content already read once to know its SHA-256, so
+// it can be stored by it
+type HashedContent struct {
+	Hash string
+	Size int64
+	file io.ReadSeeker
+	temp *os.File
+}
+
+// HashContent hashes r, contents that can not seek are copied to a
+// temporary file meanwhile. It must be closed
+func HashContent(r io.Reader) (*HashedContent, error) {
+	content := &HashedContent{}
+	file, ok := r.(io.ReadSeeker)
+	if !ok {
+		temp, err := os.CreateTemp("", "media-*")
+		if err != nil {
+			return nil, err
+		}
+		content.temp = temp
+		file = temp
+		r = io.TeeReader(r, temp)
+	}
+	hash := sha256.New()
+	size, err := io.Copy(hash, r)
+	if err == nil {
+		_, err = file.Seek(0, io.SeekStart)
 	}
-	ext := strings.Split(fileHeader.Filename, ".")
-	nameFile := uniqueID.String() + "." + ext[len(ext)-1]
-	// To buffer
-	openFile, err := fileHeader.Open()
 	if err != nil {
-		return "", err
+		content.Close()
+		return nil, err
 	}
-	buf := bytes.NewBuffer(nil)
-	if _, err := io.Copy(buf, openFile); err != nil {
-		return "", err
+	content.Hash = hex.EncodeToString(hash.Sum(nil))
+	content.Size = size
+	content.file = file
+	return content, nil
+}
+
+// Store saves the content named by its hash
+func (c *HashedContent) Store() error {
+	if _, err := c.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	return storage.Put(c.Hash, c.file, c.Size)
+}
+
+func (c *HashedContent) Close() error {
+	if c.temp == nil {
+		return nil
 	}
+	c.temp.Close()
+	return os.Remove(c.temp.Name())
+}
 
-	path := filepath.Join(settingsData.MEDIA_FOLDER, nameFile)
-	err = os.WriteFile(path, buf.Bytes(), fs.FileMode(os.O_CREATE))
+// SaveStream stores r by the name with the bytes received, even if it was
+// cut. It goes through a temporary file to know the size
+func SaveStream(nameFile string, r io.Reader) (int64, error) {
+	if err := os.MkdirAll(settingsData.UPLOADS_FOLDER, 0755); err != nil {
+		return 0, err
+	}
+	temp, err := os.CreateTemp(settingsData.UPLOADS_FOLDER, "part-*")
 	if err != nil {
-		return "", err
+		return 0, err
 	}
+	defer os.Remove(temp.Name())
+	defer temp.Close()
 
-	return nameFile, nil
+	size, errRead := io.Copy(temp, r)
+	if size == 0 {
+		return 0, errRead
+	}
+	if _, err := temp.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	if err := storage.Put(nameFile, temp, size); err != nil {
+		return 0, err
+	}
+	return size, errRead
+}
+
+// OpenFile returns the stored file to be read as a stream, with its size
+func OpenFile(nameFile string) (io.ReadCloser, int64, error) {
+	return storage.Open(nameFile)
 }
 
 func GetFile(nameFile string) ([]byte, error) {
-	return os.ReadFile(filepath.Join(settingsData.MEDIA_FOLDER, nameFile))
+	file, _, err := storage.Open(nameFile)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return io.ReadAll(file)
 }
 
 func DeleteFile(nameFile string) error {
-	return os.Remove(filepath.Join(settingsData.MEDIA_FOLDER, nameFile))
+	return storage.Delete(nameFile)
+}
+
+// HashFile returns the SHA-256 and the size of a stored file
+func HashFile(nameFile string) (string, int64, error) {
+	file, _, err := storage.Open(nameFile)
+	if err != nil {
+		return "", 0, err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), size, nil
+}
+
+func FileSize(nameFile string) (int64, error) {
+	return storage.Stat(nameFile)
+}
+
+func SaveFile(nameFile string, data []byte) error {
+	return storage.Put(nameFile, bytes.NewReader(data), int64(len(data)))
+}
+
+// ListFiles calls fn with the name of every stored file
+func ListFiles(fn func(nameFile string) error) error {
+	return storage.List(fn)
+}
+
+// PresignedURL returns a temporary URL to download the stored file
+// directly from the storage, empty if the storage has none
+func PresignedURL(nameFile, fileName, contentType string) (string, error) {
+	return storage.PresignedURL(nameFile, fileName, contentType)
 }
@@ -0,0 +1,244 @@
+package utils
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/CPU-commits/USACH.dev-Server/utils/sigv4"
+)
+
+// Timeouts of the requests to the bucket, bodies are streamed so there
+// is no limit to read them
+const (
+	S3_DIAL_TIMEOUT            = 10 * time.Second
+	S3_RESPONSE_HEADER_TIMEOUT = 30 * time.Second
+)
+
+// Bucket of S3 or of a compatible service, requests are signed with
+// AWS Signature Version 4
+type s3Storage struct {
+	client   *http.Client
+	signer   *sigv4.Signer
+	endpoint *url.URL
+	bucket   string
+	// Bucket in the path instead of the host, compatible services
+	// like MinIO need it
+	pathStyle bool
+}
+
+func newS3Storage(endpoint, bucket, region, accessKey, secretKey string) *s3Storage {
+	pathStyle := endpoint != ""
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", region)
+	}
+	endpointURL, err := url.Parse(endpoint)
+	if err != nil || endpointURL.Host == "" {
+		panic("AWS_ENDPOINT Must be an URL")
+	}
+	return &s3Storage{
+		client: &http.Client{
+			Transport: &http.Transport{
+				Proxy: http.ProxyFromEnvironment,
+				DialContext: (&net.Dialer{
+					Timeout:   S3_DIAL_TIMEOUT,
+					KeepAlive: 30 * time.Second,
+				}).DialContext,
+				TLSHandshakeTimeout:   S3_DIAL_TIMEOUT,
+				ResponseHeaderTimeout: S3_RESPONSE_HEADER_TIMEOUT,
+				ExpectContinueTimeout: time.Second,
+				IdleConnTimeout:       90 * time.Second,
+				MaxIdleConnsPerHost:   10,
+			},
+		},
+		signer: &sigv4.Signer{
+			AccessKey: accessKey,
+			SecretKey: secretKey,
+			Region:    region,
+			Service:   "s3",
+		},
+		endpoint:  endpointURL,
+		bucket:    bucket,
+		pathStyle: pathStyle,
+	}
+}
+
+func (s *s3Storage) objectURL(nameFile string, query url.Values) *url.URL {
+	objectURL := *s.endpoint
+	objectPath := "/" + nameFile
+	if s.pathStyle {
+		objectPath = "/" + s.bucket + "/" + nameFile
+		if nameFile == "" {
+			objectPath = "/" + s.bucket
+		}
+	} else {
+		objectURL.Host = s.bucket + "." + objectURL.Host
+	}
+	objectURL.Path = objectPath
+	objectURL.RawPath = sigv4.Encode(objectPath, true)
+	objectURL.RawQuery = sigv4.Query(query)
+	return &objectURL
+}
+
+type s3ErrorRes struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+func (s *s3Storage) newRequest(
+	method,
+	nameFile string,
+	query url.Values,
+	body io.Reader,
+	size int64,
+) (*http.Request, error) {
+	req, err := http.NewRequest(method, s.objectURL(nameFile, query).String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = size
+		if size == 0 {
+			req.Body = http.NoBody
+		}
+	}
+	return req, nil
+}
+
+func (s *s3Storage) do(
+	method,
+	nameFile string,
+	query url.Values,
+	body io.Reader,
+	size int64,
+) (*http.Response, error) {
+	req, err := s.newRequest(method, nameFile, query, body, size)
+	if err != nil {
+		return nil, err
+	}
+	return s.send(req, nameFile)
+}
+
+func (s *s3Storage) send(req *http.Request, nameFile string) (*http.Response, error) {
+	s.signer.Sign(req, time.Now())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%w: %s", fs.ErrNotExist, nameFile)
+	}
+	var errorRes s3ErrorRes
+	xml.NewDecoder(resp.Body).Decode(&errorRes)
+	return nil, fmt.Errorf("s3: %s %s %s", resp.Status, errorRes.Code, errorRes.Message)
+}
+
+func (s *s3Storage) Put(nameFile string, r io.Reader, size int64) error {
+	resp, err := s.do(http.MethodPut, nameFile, nil, r, size)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (s *s3Storage) Open(nameFile string) (io.ReadCloser, int64, error) {
+	resp, err := s.do(http.MethodGet, nameFile, nil, nil, 0)
+	if err != nil {
+		return nil, 0, err
+	}
+	return resp.Body, resp.ContentLength, nil
+}
+
+func (s *s3Storage) OpenAt(nameFile string, offset int64) (io.ReadCloser, error) {
+	req, err := s.newRequest(http.MethodGet, nameFile, nil, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	resp, err := s.send(req, nameFile)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (s *s3Storage) Stat(nameFile string) (int64, error) {
+	resp, err := s.do(http.MethodHead, nameFile, nil, nil, 0)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.ContentLength, nil
+}
+
+func (s *s3Storage) Delete(nameFile string) error {
+	resp, err := s.do(http.MethodDelete, nameFile, nil, nil, 0)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+type s3ListRes struct {
+	Contents []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+func (s *s3Storage) List(fn func(nameFile string) error) error {
+	query := url.Values{"list-type": {"2"}}
+	for {
+		resp, err := s.do(http.MethodGet, "", query, nil, 0)
+		if err != nil {
+			return err
+		}
+		var list s3ListRes
+		err = xml.NewDecoder(resp.Body).Decode(&list)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+		for _, object := range list.Contents {
+			if err := fn(object.Key); err != nil {
+				return err
+			}
+		}
+		if !list.IsTruncated {
+			return nil
+		}
+		query.Set("continuation-token", list.NextContinuationToken)
+	}
+}
+
+func (s *s3Storage) PresignedURL(nameFile, fileName, contentType string) (string, error) {
+	query := url.Values{}
+	if fileName != "" {
+		query.Set("response-content-disposition", mime.FormatMediaType(
+			"attachment",
+			map[string]string{"filename": fileName},
+		))
+	}
+	if contentType != "" {
+		query.Set("response-content-type", contentType)
+	}
+	return s.signer.Presign(
+		s.objectURL(nameFile, query),
+		time.Now(),
+		PRESIGNED_URL_EXPIRES,
+	), nil
+}
@@ -0,0 +1,98 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// ServedFile is a stored file to answer a request with
+type ServedFile struct {
+	NameFile string
+	// Name of the file for the user, its extension gives the type if
+	// there is no ContentType
+	Name        string
+	ContentType string
+	// SHA-256 of the content, stored files never change so legacy ones
+	// use their name
+	Hash     string
+	Modified time.Time
+}
+
+var errNegativeOffset = errors.New("negative offset")
+
+// fileReader reads a stored file from any offset, the file is opened
+// again after a seek
+type fileReader struct {
+	nameFile string
+	size     int64
+	offset   int64
+	body     io.ReadCloser
+}
+
+func (f *fileReader) Read(p []byte) (int, error) {
+	if f.offset >= f.size {
+		return 0, io.EOF
+	}
+	if f.body == nil {
+		body, err := storage.OpenAt(f.nameFile, f.offset)
+		if err != nil {
+			return 0, err
+		}
+		f.body = body
+	}
+	n, err := f.body.Read(p)
+	f.offset += int64(n)
+	return n, err
+}
+
+func (f *fileReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += f.size
+	}
+	if offset < 0 {
+		return 0, errNegativeOffset
+	}
+	if offset != f.offset {
+		f.Close()
+		f.offset = offset
+	}
+	return offset, nil
+}
+
+func (f *fileReader) Close() error {
+	if f.body == nil {
+		return nil
+	}
+	err := f.body.Close()
+	f.body = nil
+	return err
+}
+
+// ServeFile answers with the file supporting byte ranges, also multiple
+// ones, and conditional requests by ETag or modification date
+func ServeFile(w http.ResponseWriter, r *http.Request, file *ServedFile) error {
+	size, err := storage.Stat(file.NameFile)
+	if err != nil {
+		return err
+	}
+	reader := &fileReader{
+		nameFile: file.NameFile,
+		size:     size,
+	}
+	defer reader.Close()
+
+	if file.ContentType != "" {
+		w.Header().Set("Content-Type", file.ContentType)
+	}
+	if file.Hash != "" {
+		w.Header().Set("ETag", fmt.Sprintf("%q", file.Hash))
+	}
+	http.ServeContent(w, r, file.Name, file.Modified, reader)
+	return nil
+}
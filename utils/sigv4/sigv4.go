@@ -0,0 +1,174 @@
+// Package sigv4 signs requests to S3, or to a compatible service, with
+// AWS Signature Version 4
+package sigv4
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	ALGORITHM = "AWS4-HMAC-SHA256"
+	// The body is streamed, so it is not part of the signature
+	UNSIGNED_PAYLOAD = "UNSIGNED-PAYLOAD"
+)
+
+const (
+	dateFormat     = "20060102"
+	dateTimeFormat = "20060102T150405Z"
+)
+
+type Signer struct {
+	AccessKey string
+	SecretKey string
+	Region    string
+	Service   string
+}
+
+// Encode escapes as the signature expects, everything but the
+// unreserved characters of RFC 3986
+func Encode(value string, keepSlash bool) string {
+	var encoded strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (keepSlash && c == '/') {
+			encoded.WriteByte(c)
+		} else {
+			fmt.Fprintf(&encoded, "%%%02X", c)
+		}
+	}
+	return encoded.String()
+}
+
+// Query returns the query sorted and escaped as the signature expects
+func Query(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var params []string
+	for _, key := range keys {
+		values := append([]string(nil), query[key]...)
+		sort.Strings(values)
+		for _, value := range values {
+			params = append(params, Encode(key, false)+"="+Encode(value, false))
+		}
+	}
+	return strings.Join(params, "&")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func (s *Signer) scope(now time.Time) string {
+	return fmt.Sprintf(
+		"%s/%s/%s/aws4_request",
+		now.Format(dateFormat),
+		s.Region,
+		s.Service,
+	)
+}
+
+func (s *Signer) signature(now time.Time, canonicalRequest string) string {
+	hashedRequest := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		ALGORITHM,
+		now.Format(dateTimeFormat),
+		s.scope(now),
+		hex.EncodeToString(hashedRequest[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.SecretKey), now.Format(dateFormat))
+	key = hmacSHA256(key, s.Region)
+	key = hmacSHA256(key, s.Service)
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+// Sign adds the Authorization header, signing the host and every header
+// of the request. The body is only signed if X-Amz-Content-Sha256 has
+// its hash
+func (s *Signer) Sign(req *http.Request, now time.Time) {
+	now = now.UTC()
+	req.Header.Set("X-Amz-Date", now.Format(dateTimeFormat))
+	if req.Header.Get("X-Amz-Content-Sha256") == "" {
+		req.Header.Set("X-Amz-Content-Sha256", UNSIGNED_PAYLOAD)
+	}
+	headers := map[string]string{
+		"host": req.URL.Host,
+	}
+	for key, values := range req.Header {
+		trimmed := make([]string, len(values))
+		for i, value := range values {
+			trimmed[i] = strings.Join(strings.Fields(value), " ")
+		}
+		headers[strings.ToLower(key)] = strings.Join(trimmed, ",")
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		Encode(req.URL.Path, true),
+		Query(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		req.Header.Get("X-Amz-Content-Sha256"),
+	}, "\n")
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		ALGORITHM,
+		s.AccessKey,
+		s.scope(now),
+		signedHeaders,
+		s.signature(now, canonicalRequest),
+	))
+}
+
+// Presign returns the URL with the signature in its query, so a GET can
+// be made without credentials until it expires
+func (s *Signer) Presign(u *url.URL, now time.Time, expires time.Duration) string {
+	now = now.UTC()
+	query := u.Query()
+	query.Set("X-Amz-Algorithm", ALGORITHM)
+	query.Set("X-Amz-Credential", s.AccessKey+"/"+s.scope(now))
+	query.Set("X-Amz-Date", now.Format(dateTimeFormat))
+	query.Set("X-Amz-Expires", fmt.Sprint(int(expires.Seconds())))
+	query.Set("X-Amz-SignedHeaders", "host")
+
+	presigned := *u
+	presigned.RawPath = Encode(u.Path, true)
+	presigned.RawQuery = Query(query)
+	canonicalRequest := strings.Join([]string{
+		http.MethodGet,
+		presigned.RawPath,
+		presigned.RawQuery,
+		"host:" + u.Host,
+		"",
+		"host",
+		UNSIGNED_PAYLOAD,
+	}, "\n")
+	presigned.RawQuery += "&X-Amz-Signature=" + s.signature(now, canonicalRequest)
+	return presigned.String()
+}
@@ -0,0 +1,136 @@
+package utils
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/CPU-commits/USACH.dev-Server/settings"
+)
+
+// Time a presigned URL can be used
+const PRESIGNED_URL_EXPIRES = 15 * time.Minute
+
+// Storage keeps the uploaded files by their unique name
+type Storage interface {
+	Put(nameFile string, r io.Reader, size int64) error
+	// Open returns the file to be read as a stream, with its size
+	Open(nameFile string) (io.ReadCloser, int64, error)
+	// OpenAt returns the file to be read from the offset
+	OpenAt(nameFile string, offset int64) (io.ReadCloser, error)
+	Stat(nameFile string) (int64, error)
+	Delete(nameFile string) error
+	// List calls fn with the name of every stored file
+	List(fn func(nameFile string) error) error
+	// PresignedURL returns an URL to download the file without going
+	// through the API, empty if the backend has no URLs
+	PresignedURL(nameFile, fileName, contentType string) (string, error)
+}
+
+var storage = newStorage()
+
+func newStorage() Storage {
+	if settingsData.STORAGE_DRIVER == settings.STORAGE_S3 {
+		return newS3Storage(
+			settingsData.AWS_ENDPOINT,
+			settingsData.AWS_BUCKET,
+			settingsData.AWS_REGION,
+			settingsData.AWS_ACCESS_KEY_ID,
+			settingsData.AWS_SECRET_ACCESS_KEY,
+		)
+	}
+	return &localStorage{folder: settingsData.MEDIA_FOLDER}
+}
+
+// Suffix of the files being written
+const localTempSuffix = ".tmp"
+
+// Files in a folder of the server
+type localStorage struct {
+	folder string
+}
+
+// Put writes to a temporary file that takes the name once complete, so
+// a partial file is never seen by its name
+func (l *localStorage) Put(nameFile string, r io.Reader, size int64) error {
+	file, err := os.CreateTemp(l.folder, "."+nameFile+".*"+localTempSuffix)
+	if err != nil {
+		return err
+	}
+	// Temporary files are only readable by their owner
+	err = file.Chmod(0644)
+	if err == nil {
+		_, err = io.Copy(file, r)
+	}
+	if errClose := file.Close(); err == nil {
+		err = errClose
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), filepath.Join(l.folder, nameFile))
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+	return nil
+}
+
+func (l *localStorage) Open(nameFile string) (io.ReadCloser, int64, error) {
+	file, err := os.Open(filepath.Join(l.folder, nameFile))
+	if err != nil {
+		return nil, 0, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, 0, err
+	}
+	return file, info.Size(), nil
+}
+
+func (l *localStorage) OpenAt(nameFile string, offset int64) (io.ReadCloser, error) {
+	file, err := os.Open(filepath.Join(l.folder, nameFile))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return file, nil
+}
+
+func (l *localStorage) Stat(nameFile string) (int64, error) {
+	info, err := os.Stat(filepath.Join(l.folder, nameFile))
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+func (l *localStorage) Delete(nameFile string) error {
+	return os.Remove(filepath.Join(l.folder, nameFile))
+}
+
+func (l *localStorage) List(fn func(nameFile string) error) error {
+	entries, err := os.ReadDir(l.folder)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		// Files being written
+		if entry.IsDir() || strings.HasSuffix(entry.Name(), localTempSuffix) {
+			continue
+		}
+		if err := fn(entry.Name()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (*localStorage) PresignedURL(nameFile, fileName, contentType string) (string, error) {
+	return "", nil
+}